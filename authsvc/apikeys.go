@@ -0,0 +1,142 @@
+package main
+
+import (
+	"log"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/vladimirvivien/go-grpc/protobuf"
+	"github.com/vladimirvivien/go-grpc/util"
+)
+
+// adminPolicy restricts the API key and token management
+// methods to callers granted the admin scopes.
+var adminPolicy = &util.Policy{
+	Methods: map[string][]string{
+		"/protobuf.Auth/CreateApiKey": {"apikeys.admin"},
+		"/protobuf.Auth/ListApiKeys":  {"apikeys.admin"},
+		"/protobuf.Auth/RevokeApiKey": {"apikeys.admin"},
+		"/protobuf.Auth/RevokeToken":  {"tokens.revoke"},
+	},
+}
+
+// CreateApiKey creates a new API key granted the requested scopes.
+// The key is returned only once, the service only stores its hash.
+func (s *AuthService) CreateApiKey(
+	ctx context.Context,
+	req *pb.CreateApiKeyRequest,
+) (*pb.CreateApiKeyResponse, error) {
+	if req.GetName() == "" || len(req.GetScopes()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "missing key name or scopes")
+	}
+	for _, scope := range req.GetScopes() {
+		if !knownScope(scope) {
+			return nil, status.Errorf(codes.InvalidArgument, "unknown scope %s", scope)
+		}
+	}
+	key, rec, err := s.keys.Create(req.GetName(), req.GetScopes())
+	if err != nil {
+		log.Println(err)
+		return nil, status.Error(codes.Internal, "failed to create api key")
+	}
+	log.Printf("API key %s (%s) created", rec.ID, rec.Name)
+	s.audit.record(ctx, "apikey.create", caller(ctx), rec.ID)
+	return &pb.CreateApiKeyResponse{Key: key, Info: apiKeyInfo(rec)}, nil
+}
+
+// ListApiKeys returns all API keys, including revoked ones
+func (s *AuthService) ListApiKeys(
+	ctx context.Context,
+	req *pb.ListApiKeysRequest,
+) (*pb.ApiKeyList, error) {
+	list := new(pb.ApiKeyList)
+	for _, rec := range s.keys.List() {
+		list.Items = append(list.Items, apiKeyInfo(rec))
+	}
+	return list, nil
+}
+
+// RevokeApiKey revokes the API key with the requested id
+func (s *AuthService) RevokeApiKey(
+	ctx context.Context,
+	req *pb.RevokeApiKeyRequest,
+) (*pb.ApiKey, error) {
+	if req.GetId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing key id")
+	}
+	rec, err := s.keys.Revoke(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	log.Printf("API key %s (%s) revoked", rec.ID, rec.Name)
+	s.audit.record(ctx, "apikey.revoke", caller(ctx), rec.ID)
+	return apiKeyInfo(rec), nil
+}
+
+func apiKeyInfo(rec *util.ApiKeyRecord) *pb.ApiKey {
+	return &pb.ApiKey{
+		Id:      rec.ID,
+		Name:    rec.Name,
+		Scopes:  rec.Scopes,
+		Created: rec.Created.Unix(),
+		Revoked: rec.Revoked,
+	}
+}
+
+// caller returns the subject of the identity in ctx
+func caller(ctx context.Context) string {
+	if id, ok := util.IdentityFromContext(ctx); ok {
+		return id.Subject
+	}
+	return ""
+}
+
+// knownScope returns true if scope is granted by any role
+func knownScope(scope string) bool {
+	for _, scopes := range roleScopes {
+		for _, s := range scopes {
+			if s == scope {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// adminUnaryIntercept validates the JWT token of callers of the
+// admin methods and enforces the admin policy. Login is not
+// intercepted since callers have no token yet.
+func (s *AuthService) adminUnaryIntercept(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if _, ok := adminPolicy.Methods[info.FullMethod]; !ok {
+		return handler(ctx, req)
+	}
+
+	meta, _ := metadata.FromIncomingContext(ctx)
+	authString := meta["authorization"]
+	if len(authString) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "missing authorization")
+	}
+	jwtToken, err := parseToken(authString[0])
+	if err != nil || !jwtToken.Valid {
+		return nil, status.Error(codes.Unauthenticated, "bad token")
+	}
+	if s.revoked.isRevoked(jwtToken) {
+		return nil, status.Error(codes.Unauthenticated, "token revoked")
+	}
+	id, err := util.IdentityFromJwt(jwtToken)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	ctx = util.NewIdentityContext(ctx, id)
+	return util.AuthzUnaryIntercept(adminPolicy)(ctx, req, info, handler)
+}
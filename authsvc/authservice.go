@@ -1,44 +1,86 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"net"
+	"strings"
 	"time"
 
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
 
 	"golang.org/x/crypto/bcrypt"
 
 	jwt "github.com/dgrijalva/jwt-go"
 	pb "github.com/vladimirvivien/go-grpc/protobuf"
+	"github.com/vladimirvivien/go-grpc/util"
+	"github.com/vladimirvivien/go-grpc/util/config"
+	"github.com/vladimirvivien/go-grpc/util/logging"
+	"github.com/vladimirvivien/go-grpc/util/metrics"
+	"github.com/vladimirvivien/go-grpc/util/tracing"
 )
 
 const (
-	uname       = "vector"
-	name        = "Vic Vector"
-	port        = ":50052"
-	secret      = "a1b2c3d"
-	pwd         = "abc123"
-	srvCertFile = "./../certs/server.crt"
-	srvKeyFile  = "./../certs/server.key"
+	uname = "vector"
+	name  = "Vic Vector"
+	pwd   = "abc123"
 )
 
+var (
+	// secret signing the issued tokens, set from the configuration
+	secret []byte
+
+	// tokenLifetime sets the exp claim of issued tokens
+	tokenLifetime time.Duration
+)
+
+// roleScopes maps a user role to the scopes granted
+// to the role. The scopes are carried in the JWT token
+// and enforced by the services' authorization policy.
+var roleScopes = map[string][]string{
+	"viewer": {"currency.read"},
+	"editor": {"currency.read", "currency.write"},
+	"admin":  {"apikeys.admin", "tokens.revoke"},
+	// frontends serve users, their calls may be critical
+	"frontend": {util.CriticalScope},
+}
+
 type user struct {
 	uname,
 	name string
-	pwd []byte
+	pwd   []byte
+	roles []string
+}
+
+// scopes returns the unique scopes granted to the user's roles
+func (u *user) scopes() []string {
+	var scopes []string
+	seen := make(map[string]bool)
+	for _, role := range u.roles {
+		for _, scope := range roleScopes[role] {
+			if !seen[scope] {
+				seen[scope] = true
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	return scopes
 }
 
 type AuthService struct {
 	*user
+	keys    *util.ApiKeyStore
+	revoked *revocations
+	guard   *loginGuard
+	audit   *auditLog
 }
 
-func newAuthService() *AuthService {
-	return new(AuthService)
+func newAuthService(keys *util.ApiKeyStore, revoked *revocations, audit *auditLog) *AuthService {
+	return &AuthService{keys: keys, revoked: revoked, guard: newLoginGuard(), audit: audit}
 }
 
 // loadUser creates 1 user which will be used
@@ -53,6 +95,7 @@ func (s *AuthService) loadUser() error {
 		uname: "vector",
 		name:  "Vic Vector",
 		pwd:   hash,
+		roles: []string{"editor", "admin", "frontend"},
 	}
 	s.user = u
 	return nil
@@ -62,20 +105,41 @@ func (s *AuthService) loadUser() error {
 // in-memory in variabe uname and only works for 1 user.
 // In a realworld example, a database or some store would
 // be used for storing the username and hashed password.
+// Attempts are tracked per username and per peer address,
+// both are locked out after repeated failures.
 func (s *AuthService) Login(ctx context.Context, req *pb.AuthRequest) (*pb.AuthResponse, error) {
 	log.Println("Authorizing user", req.GetUname())
 	if req.GetUname() == "" || req.GetPwd() == "" {
 		log.Println("Auth failed for user", req.GetUname())
 		return nil, status.Errorf(codes.InvalidArgument, "missing uname or password")
 	}
+
+	keys := []string{"user:" + req.GetUname(), "peer:" + peerAddr(ctx)}
+	// the attempt counts as failed until the password is verified
+	if wait := s.guard.begin(keys...); wait > 0 {
+		log.Println("login locked out for user", req.GetUname())
+		s.audit.record(ctx, "login.locked", req.GetUname(), wait.Round(time.Second).String())
+		return nil, lockedOutError(wait)
+	}
+
 	if req.GetUname() != uname {
 		log.Println("missing uname")
+		s.audit.record(ctx, "login.failure", req.GetUname(), "unknown user")
 		return nil, status.Error(codes.PermissionDenied, "invalid user")
 	}
 	if err := bcrypt.CompareHashAndPassword(s.user.pwd, []byte(req.GetPwd())); err != nil {
 		log.Println("auth failed")
+		s.audit.record(ctx, "login.failure", req.GetUname(), "bad password")
 		return nil, status.Error(codes.PermissionDenied, "auth failed")
 	}
+	s.guard.succeed(keys...)
+
+	// the jti claim identifies the token for revocation
+	jti, err := newTokenID()
+	if err != nil {
+		log.Println(err)
+		return nil, status.Error(codes.Internal, "internal login problem")
+	}
 
 	// create jwt token
 	// see reserved claims https://tools.ietf.org/html/rfc7519#section-4.1
@@ -83,50 +147,122 @@ func (s *AuthService) Login(ctx context.Context, req *pb.AuthRequest) (*pb.AuthR
 	token := jwt.NewWithClaims(
 		jwt.SigningMethodHS256,
 		jwt.MapClaims{
-			"exp":  time.Now().Add(time.Minute * 20).Unix(),
+			"exp":  time.Now().Add(tokenLifetime).Unix(),
+			"jti":  jti,
 			"sub":  uname,
 			"iss":  "authservice",
 			"aud":  "user",
 			"name": name,
+			// roles and scope are used for authorization
+			"roles": s.user.roles,
+			"scope": strings.Join(s.user.scopes(), " "),
 		},
 	)
 
 	// this example uses a simple string secret. You can also
 	// use JWT package to specify an RSA public cert here as well.
-	tokenString, err := token.SignedString([]byte(secret))
+	tokenString, err := token.SignedString(secret)
 
 	if err != nil {
 		log.Println(err)
 		return nil, status.Error(codes.Internal, "internal login problem")
 	}
 
-	log.Printf("User %s logged in OK, JWT token: %s\n", uname, tokenString)
+	s.audit.record(ctx, "login.success", uname, "jti "+jti)
+	log.Printf("User %s logged in OK, JWT token: %s\n", uname, util.RedactToken(tokenString))
 	return &pb.AuthResponse{Token: tokenString}, nil
 }
 
+// parseToken validates a token issued by the service
+func parseToken(tokenString string) (*jwt.Token, error) {
+	return jwt.Parse(
+		tokenString,
+		func(token *jwt.Token) (interface{}, error) {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, fmt.Errorf("bad signing method")
+			}
+			return secret, nil
+		},
+	)
+}
+
 func main() {
-	authService := newAuthService()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	secret = []byte(cfg.Auth.Secret)
+	tokenLifetime = cfg.Auth.TokenLifetime
+
+	shutdownTracing, err := tracing.Init("authsvc", cfg.Auth.Trace)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer shutdownTracing(context.Background())
+
+	keys, err := util.NewApiKeyStore(cfg.Auth.APIKeyFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	audit, err := newAuditLog(cfg.Auth.AuditFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	revoked, err := newRevocations(cfg.Auth.RevokedFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	authService := newAuthService(keys, revoked, audit)
 	if err := authService.loadUser(); err != nil {
 		log.Fatal(err)
 	}
 
-	lstnr, err := net.Listen("tcp", port)
+	go authService.guard.sweep(time.Minute)
+
+	lstnr, err := net.Listen("tcp", cfg.Auth.Addr)
 	if err != nil {
 		log.Fatal("failed to start server:", err)
 	}
 
-	tlsCreds, err := credentials.NewServerTLSFromFile(srvCertFile, srvKeyFile)
+	// certificates are reloaded when renewed on disk
+	certs, err := util.NewCertReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile, "")
 	if err != nil {
 		log.Fatal(err)
 	}
+	go certs.Watch(cfg.TLS.CertReload, nil)
+	tlsCreds := certs.ServerCreds(false)
+
+	// interceptors run in the order they are added (see util.ServerChain)
+	logOpts := logging.Options{}
+	chain := util.NewServerChain().
+		Add(util.RecoveryUnaryIntercept(), util.RecoveryStreamIntercept()).
+		Add(tracing.UnaryServerIntercept(), tracing.StreamServerIntercept()).
+		Add(logging.UnaryServerIntercept(logOpts), logging.StreamServerIntercept(logOpts)).
+		Add(metrics.UnaryServerIntercept(), metrics.StreamServerIntercept()).
+		Add(authService.adminUnaryIntercept, nil)
 
 	// setup and register currency service
-	authServer := grpc.NewServer(grpc.Creds(tlsCreds))
+	authServer := grpc.NewServer(
+		grpc.Creds(tlsCreds),
+		grpc.UnaryInterceptor(chain.UnaryInterceptor()),
+		grpc.StreamInterceptor(chain.StreamInterceptor()),
+	)
 	pb.RegisterAuthServer(authServer, authService)
 
+	// the service is ready, it is reported SERVING right away
+	hs := util.RegisterHealth(authServer, nil, util.AuthServiceName)
+	stopped := util.StopOnSignal(authServer, hs, cfg.Auth.Drain)
+
+	// let tools (i.e. curctl list, grpcurl) discover the services
+	reflection.Register(authServer)
+
+	// expose metrics on a local /metrics endpoint
+	metrics.Serve(cfg.Auth.MetricsAddr)
+
 	// start service's server
-	log.Println("starting auth service on", port)
+	log.Println("starting auth service on", cfg.Auth.Addr)
 	if err := authServer.Serve(lstnr); err != nil {
 		log.Fatal(err)
 	}
+	<-stopped
 }
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// failed attempts allowed before a key is locked out
+	maxFailures = 3
+	// first lockout period, doubled with each subsequent failure
+	baseLockout = 2 * time.Second
+	maxLockout  = 15 * time.Minute
+	// failures are forgotten after this period without attempts
+	failureTTL = time.Hour
+)
+
+type attempts struct {
+	failures    int
+	last        time.Time
+	lockedUntil time.Time
+}
+
+// loginGuard tracks failed login attempts per key (username
+// or peer address) and locks out a key, for an exponentially
+// growing period, once it exceeds maxFailures.
+type loginGuard struct {
+	mtx   sync.Mutex
+	byKey map[string]*attempts
+}
+
+func newLoginGuard() *loginGuard {
+	return &loginGuard{byKey: make(map[string]*attempts)}
+}
+
+// begin counts an attempt for each key, as a failure until the
+// attempt succeeds (see succeed), before the password is checked, so
+// that attempts sent in parallel cannot pass the lockout. It returns
+// the time left before any of the keys is unlocked, without counting
+// the attempt, or zero once the attempt is counted.
+func (g *loginGuard) begin(keys ...string) time.Duration {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	var wait time.Duration
+	now := time.Now()
+	for _, key := range keys {
+		a, ok := g.byKey[key]
+		if !ok {
+			continue
+		}
+		if left := a.lockedUntil.Sub(now); left > wait {
+			wait = left
+		}
+	}
+	if wait > 0 {
+		return wait
+	}
+
+	for _, key := range keys {
+		a, ok := g.byKey[key]
+		if !ok {
+			a = new(attempts)
+			g.byKey[key] = a
+		}
+		a.failures++
+		a.last = now
+		if a.failures >= maxFailures {
+			lockout := baseLockout << uint(a.failures-maxFailures)
+			if lockout > maxLockout || lockout <= 0 {
+				lockout = maxLockout
+			}
+			a.lockedUntil = now.Add(lockout)
+		}
+	}
+	return 0
+}
+
+// succeed forgets the failed attempts of each key, and
+// the lockout of the keys, on a successful attempt
+func (g *loginGuard) succeed(keys ...string) {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	for _, key := range keys {
+		delete(g.byKey, key)
+	}
+}
+
+// sweep periodically removes the keys that have not failed
+// within failureTTL and are no longer locked out.
+func (g *loginGuard) sweep(interval time.Duration) {
+	for range time.Tick(interval) {
+		g.mtx.Lock()
+		now := time.Now()
+		for key, a := range g.byKey {
+			if now.Sub(a.last) > failureTTL && now.After(a.lockedUntil) {
+				delete(g.byKey, key)
+			}
+		}
+		g.mtx.Unlock()
+	}
+}
+
+// lockedOutError returns a ResourceExhausted status that
+// tells the caller, with a RetryInfo detail, when to retry.
+func lockedOutError(wait time.Duration) error {
+	stat := status.New(codes.ResourceExhausted, "too many failed login attempts")
+	statDetail, err := stat.WithDetails(&errdetails.RetryInfo{
+		RetryDelay: ptypes.DurationProto(wait),
+	})
+	if err != nil {
+		return stat.Err()
+	}
+	return statDetail.Err()
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/vladimirvivien/go-grpc/protobuf"
+)
+
+// revocations is the list of revoked token ids (jti) along with
+// the expiry of their tokens. The list is saved to a file so that
+// it survives restarts, and new entries are broadcast to the
+// subscribers of WatchRevocations.
+type revocations struct {
+	mtx   sync.Mutex
+	file  string
+	byJti map[string]int64
+	subs  map[chan *pb.Revocation]struct{}
+}
+
+func newRevocations(file string) (*revocations, error) {
+	r := &revocations{
+		file:  file,
+		byJti: make(map[string]int64),
+		subs:  make(map[chan *pb.Revocation]struct{}),
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return r, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &r.byJti); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// revoke adds jti to the list and notifies the subscribers
+func (r *revocations) revoke(jti string, expires int64) (*pb.Revocation, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.prune()
+	r.byJti[jti] = expires
+	data, err := json.Marshal(r.byJti)
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(r.file, data, 0600); err != nil {
+		return nil, err
+	}
+
+	rev := &pb.Revocation{Jti: jti, Expires: expires}
+	for sub := range r.subs {
+		select {
+		case sub <- rev:
+		default:
+			// a subscriber that falls behind is dropped, it
+			// receives the whole list again when it resubscribes
+			delete(r.subs, sub)
+			close(sub)
+		}
+	}
+	return rev, nil
+}
+
+// isRevoked returns true if the jti claim of token was revoked
+func (r *revocations) isRevoked(token *jwt.Token) bool {
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return false
+	}
+	jti, _ := claims["jti"].(string)
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	_, ok = r.byJti[jti]
+	return ok
+}
+
+// prune drops the entries of expired tokens, must be
+// called with the lock held.
+func (r *revocations) prune() {
+	now := time.Now().Unix()
+	for jti, expires := range r.byJti {
+		if expires < now {
+			delete(r.byJti, jti)
+		}
+	}
+}
+
+// subscribe returns the current list and a channel
+// that receives the revocations that follow.
+func (r *revocations) subscribe() ([]*pb.Revocation, chan *pb.Revocation) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.prune()
+	var list []*pb.Revocation
+	for jti, expires := range r.byJti {
+		list = append(list, &pb.Revocation{Jti: jti, Expires: expires})
+	}
+	sub := make(chan *pb.Revocation, 64)
+	r.subs[sub] = struct{}{}
+	return list, sub
+}
+
+func (r *revocations) unsubscribe(sub chan *pb.Revocation) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if _, ok := r.subs[sub]; ok {
+		delete(r.subs, sub)
+		close(sub)
+	}
+}
+
+// RevokeToken revokes a token, identified by the token itself
+// or by its jti, until the token expires.
+func (s *AuthService) RevokeToken(
+	ctx context.Context,
+	req *pb.RevokeTokenRequest,
+) (*pb.Revocation, error) {
+	jti := req.GetJti()
+	// without the token, its expiry is unknown so the
+	// jti is kept for the longest token lifetime
+	expires := time.Now().Add(tokenLifetime).Unix()
+	if req.GetToken() != "" {
+		token, err := parseToken(req.GetToken())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid token")
+		}
+		claims := token.Claims.(jwt.MapClaims)
+		jti, _ = claims["jti"].(string)
+		if exp, ok := claims["exp"].(float64); ok {
+			expires = int64(exp)
+		}
+	}
+	if jti == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing token jti")
+	}
+
+	rev, err := s.revoked.revoke(jti, expires)
+	if err != nil {
+		log.Println(err)
+		return nil, status.Error(codes.Internal, "failed to revoke token")
+	}
+	log.Println("token revoked, jti", jti)
+	s.audit.record(ctx, "token.revoke", caller(ctx), jti)
+	return rev, nil
+}
+
+// WatchRevocations streams the revocation list to resource
+// servers. The list is sent first, followed by new revocations.
+// Entries only carry token ids, not tokens, so the feed does
+// not require authentication.
+func (s *AuthService) WatchRevocations(
+	req *pb.WatchRevocationsRequest,
+	stream pb.Auth_WatchRevocationsServer,
+) error {
+	list, sub := s.revoked.subscribe()
+	defer s.revoked.unsubscribe(sub)
+	log.Println("revocation feed subscriber joined:", peerAddr(stream.Context()))
+
+	for _, rev := range list {
+		if err := stream.Send(rev); err != nil {
+			return err
+		}
+	}
+	for {
+		select {
+		case rev, ok := <-sub:
+			if !ok {
+				return status.Error(codes.Unavailable, "subscriber fell behind, resubscribe")
+			}
+			if err := stream.Send(rev); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+// newTokenID returns a random id for the jti claim
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/vladimirvivien/go-grpc/util"
+)
+
+// certgen creates a development CA along with server and client
+// certificates signed by that CA. By default, the files are written
+// to the certs directory used by the examples:
+//
+//	ca.pem, ca-key.pem, server.crt, server.key, client.crt, client.key
+func main() {
+	outDir := flag.String("out", "./../certs", "directory where files are written")
+	reuseCA := flag.Bool("reuse-ca", false, "issue certificates from the existing ca.pem/ca-key.pem")
+	caCN := flag.String("ca-cn", "go-grpc dev CA", "common name of the CA")
+	caLife := flag.Duration("ca-lifetime", 5*365*24*time.Hour, "lifetime of the CA certificate")
+	srvCN := flag.String("server-cn", "localhost", "common name of the server certificate")
+	srvSANs := flag.String("server-san", "localhost,127.0.0.1", "comma-separated DNS, IP, or URI SANs of the server certificate")
+	cltCN := flag.String("client-cn", "batch-job", "common name of the client certificate")
+	cltSANs := flag.String("client-san", "", "comma-separated DNS, IP, or URI SANs of the client certificate")
+	cltOU := flag.String("client-ou", "editor", "comma-separated OUs (roles) of the client certificate")
+	life := flag.Duration("lifetime", 365*24*time.Hour, "lifetime of the server and client certificates")
+	flag.Parse()
+
+	if err := os.MkdirAll(*outDir, 0700); err != nil {
+		log.Fatal(err)
+	}
+	caCert := filepath.Join(*outDir, "ca.pem")
+	caKey := filepath.Join(*outDir, "ca-key.pem")
+
+	var ca *util.CertKeyPair
+	var err error
+	if *reuseCA {
+		ca, err = util.LoadCA(caCert, caKey)
+	} else {
+		ca, err = util.NewCA(util.CertOptions{CommonName: *caCN, Lifetime: *caLife})
+		if err == nil {
+			err = ca.WriteFiles(caCert, caKey)
+		}
+	}
+	if err != nil {
+		log.Fatal("ca: ", err)
+	}
+	log.Println("using CA", ca.Cert.Subject.CommonName, "expires", ca.Cert.NotAfter)
+
+	srvOpts := util.CertOptions{CommonName: *srvCN, Lifetime: *life}
+	srvOpts.DNSNames, srvOpts.IPAddresses, srvOpts.URIs = parseSANs(*srvSANs)
+	srv, err := ca.NewServerCert(srvOpts)
+	if err != nil {
+		log.Fatal("server cert: ", err)
+	}
+	if err := srv.WriteFiles(filepath.Join(*outDir, "server.crt"), filepath.Join(*outDir, "server.key")); err != nil {
+		log.Fatal(err)
+	}
+	log.Println("created server certificate, expires", srv.Cert.NotAfter)
+
+	cltOpts := util.CertOptions{CommonName: *cltCN, OrgUnits: splitList(*cltOU), Lifetime: *life}
+	cltOpts.DNSNames, cltOpts.IPAddresses, cltOpts.URIs = parseSANs(*cltSANs)
+	clt, err := ca.NewClientCert(cltOpts)
+	if err != nil {
+		log.Fatal("client cert: ", err)
+	}
+	if err := clt.WriteFiles(filepath.Join(*outDir, "client.crt"), filepath.Join(*outDir, "client.key")); err != nil {
+		log.Fatal(err)
+	}
+	log.Println("created client certificate, expires", clt.Cert.NotAfter)
+}
+
+// parseSANs sorts a comma-separated list of SANs into DNS names,
+// IP addresses, and URIs (values containing "://").
+func parseSANs(list string) (dns []string, ips []net.IP, uris []*url.URL) {
+	for _, san := range splitList(list) {
+		if ip := net.ParseIP(san); ip != nil {
+			ips = append(ips, ip)
+			continue
+		}
+		if strings.Contains(san, "://") {
+			u, err := url.Parse(san)
+			if err != nil {
+				log.Fatalf("invalid URI SAN %q: %v", san, err)
+			}
+			uris = append(uris, u)
+			continue
+		}
+		dns = append(dns, san)
+	}
+	return
+}
+
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
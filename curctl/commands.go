@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/jsonpb"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	pb "github.com/vladimirvivien/go-grpc/protobuf"
+	"github.com/vladimirvivien/go-grpc/util"
+)
+
+// currencyRequest returns the request for a currency code or number
+func currencyRequest(arg string) *pb.CurrencyRequest {
+	arg = strings.TrimSpace(arg)
+	if num, err := strconv.Atoi(arg); err == nil {
+		return &pb.CurrencyRequest{Number: int32(num)}
+	}
+	return &pb.CurrencyRequest{Code: strings.ToUpper(arg)}
+}
+
+// oneArg returns the single argument of command cmd
+func oneArg(cmd string, args []string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("%s expects one argument, a currency code or number", cmd)
+	}
+	return args[0], nil
+}
+
+// get prints the currencies matching the code or number in args
+func get(ctx context.Context, client pb.CurrencyServiceClient, out *printer, args []string) error {
+	arg, err := oneArg("get", args)
+	if err != nil {
+		return err
+	}
+	curList, err := client.GetCurrencyList(ctx, currencyRequest(arg))
+	if err != nil {
+		return err
+	}
+	return out.currencies(curList)
+}
+
+// stream prints the currencies matching the code
+// or number in args as they are streamed
+func stream(ctx context.Context, client pb.CurrencyServiceClient, out *printer, args []string) error {
+	arg, err := oneArg("stream", args)
+	if err != nil {
+		return err
+	}
+	curStream, err := client.GetCurrencyStream(ctx, currencyRequest(arg))
+	if err != nil {
+		return err
+	}
+	for {
+		cur, err := curStream.Recv()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if err := out.currency(cur); err != nil {
+			return err
+		}
+	}
+}
+
+// saveFromFile streams the currencies of a file to the server then
+// prints the saved currencies. A .csv file has the layout of
+// curdata.csv, a .json file holds a CurrencyList (as printed by get).
+func saveFromFile(ctx context.Context, client pb.CurrencyServiceClient, out *printer, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("save-from-file expects one argument, a .csv or .json file")
+	}
+	items, err := readCurrencies(args[0])
+	if err != nil {
+		return err
+	}
+
+	saveStream, err := client.SaveCurrencyStream(ctx)
+	if err != nil {
+		return err
+	}
+	for _, cur := range items {
+		if err := saveStream.Send(cur); err != nil {
+			// the cause of the failure is returned by CloseAndRecv
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+	}
+	curList, err := saveStream.CloseAndRecv()
+	if err != nil {
+		return err
+	}
+	return out.currencies(curList)
+}
+
+// readCurrencies reads the currencies of a .csv or .json file
+func readCurrencies(path string) ([]*pb.Currency, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return util.LoadPbFromCsv(path)
+	case ".json":
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		curList := new(pb.CurrencyList)
+		if err := jsonpb.Unmarshal(file, curList); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return curList.GetItems(), nil
+	default:
+		return nil, fmt.Errorf("%s: unsupported file type, expecting .csv or .json", path)
+	}
+}
+
+// findInteractive sends a request for each code or number read,
+// one per line, from in and prints the currencies found as they
+// are streamed back. It returns once in is closed (i.e. ctrl-d).
+func findInteractive(ctx context.Context, client pb.CurrencyServiceClient, out *printer, in io.Reader) error {
+	findStream, err := client.FindCurrencyStream(ctx)
+	if err != nil {
+		return err
+	}
+
+	sendErr := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			if err := findStream.Send(currencyRequest(line)); err != nil {
+				sendErr <- err
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			sendErr <- err
+			return
+		}
+		sendErr <- findStream.CloseSend()
+	}()
+
+	for {
+		cur, err := findStream.Recv()
+		if err != nil {
+			if err == io.EOF {
+				return <-sendErr
+			}
+			return err
+		}
+		if err := out.currency(cur); err != nil {
+			return err
+		}
+	}
+}
+
+// convert prints the ISO number of a currency code,
+// or the code of a currency number
+func convert(ctx context.Context, client pb.CurrencyServiceClient, out *printer, args []string) error {
+	arg, err := oneArg("convert", args)
+	if err != nil {
+		return err
+	}
+	req := currencyRequest(arg)
+	curList, err := client.GetCurrencyList(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	// currencies are listed once per country, keep the first match
+	for _, cur := range curList.GetItems() {
+		if (req.GetCode() != "" && cur.GetCode() == req.GetCode()) ||
+			(req.GetNumber() != 0 && cur.GetNumber() == req.GetNumber()) {
+			return out.conversion(cur)
+		}
+	}
+	return fmt.Errorf("no currency found for %q", arg)
+}
+
+// list prints the services of the server, or the methods of
+// the named service, as reported by server reflection
+func list(ctx context.Context, conn *grpc.ClientConn, out *printer, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("list expects at most one argument, a service name")
+	}
+	refl, err := newReflectClient(ctx, conn)
+	if err != nil {
+		return err
+	}
+	defer refl.close()
+
+	if len(args) == 0 {
+		services, err := refl.listServices()
+		if err != nil {
+			return err
+		}
+		return out.names(services)
+	}
+	methods, err := refl.listMethods(args[0])
+	if err != nil {
+		return err
+	}
+	return out.names(methods)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	pb "github.com/vladimirvivien/go-grpc/protobuf"
+	"github.com/vladimirvivien/go-grpc/util"
+)
+
+const usage = `curctl calls the currency service from the command line.
+
+Usage:
+	curctl [flags] <command> [arguments]
+
+Commands:
+	get <code|number>          get the matching currencies (GetCurrencyList)
+	stream <code|number>       stream the matching currencies (GetCurrencyStream)
+	save-from-file <file>      save the currencies of a .csv or .json file (SaveCurrencyStream)
+	find-interactive           find the currencies of the codes or numbers read from stdin (FindCurrencyStream)
+	convert <code|number>      convert a currency code to its ISO number, or a number to its code
+	login                      login to the auth service and print the token
+	list [service]             list the services, or the methods of a service, using server reflection
+
+Flags:
+`
+
+// options are the global flags of curctl
+type options struct {
+	addr     string
+	authAddr string
+	caFile   string
+	insecure bool
+	token    string
+	apiKey   string
+	user     string
+	pwd      string
+	output   string
+	timeout  time.Duration
+}
+
+func main() {
+	opts := new(options)
+	flag.StringVar(&opts.addr, "addr", "127.0.0.1:50051", "address of the currency server")
+	flag.StringVar(&opts.authAddr, "auth-addr", "127.0.0.1:50052", "address of the auth service")
+	flag.StringVar(&opts.caFile, "ca", "./../certs/ca.pem", "CA certificate used to verify the servers")
+	flag.BoolVar(&opts.insecure, "insecure", false, "connect without TLS (i.e. the grpc example server)")
+	flag.StringVar(&opts.token, "token", "", "JWT token sent with each call")
+	flag.StringVar(&opts.apiKey, "api-key", "", "API key sent with each call, instead of a token")
+	flag.StringVar(&opts.user, "user", "vector", "user name used to login")
+	flag.StringVar(&opts.pwd, "pwd", "", "password used to login, when set a token is obtained before each command")
+	flag.StringVar(&opts.output, "o", "table", "output format: table or json")
+	flag.DurationVar(&opts.timeout, "timeout", 10*time.Second, "timeout of the command (find-interactive is not bounded)")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if opts.output != "table" && opts.output != "json" {
+		log.Fatalf("unknown output format %q", opts.output)
+	}
+
+	cmd, args := flag.Arg(0), flag.Args()[1:]
+	if err := run(opts, cmd, args); err != nil {
+		fmt.Fprintln(os.Stderr, "curctl:", err)
+		os.Exit(1)
+	}
+}
+
+// run executes command cmd with its arguments
+func run(opts *options, cmd string, args []string) error {
+	ctx := context.Background()
+	if cmd != "find-interactive" {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+		defer cancel()
+	}
+	out := newPrinter(os.Stdout, opts.output)
+
+	if cmd == "login" {
+		token, err := login(ctx, opts)
+		if err != nil {
+			return err
+		}
+		return out.token(token)
+	}
+
+	conn, err := dial(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	client := pb.NewCurrencyServiceClient(conn)
+
+	switch cmd {
+	case "get":
+		return get(ctx, client, out, args)
+	case "stream":
+		return stream(ctx, client, out, args)
+	case "save-from-file":
+		return saveFromFile(ctx, client, out, args)
+	case "find-interactive":
+		return findInteractive(ctx, client, out, os.Stdin)
+	case "convert":
+		return convert(ctx, client, out, args)
+	case "list":
+		return list(ctx, conn, out, args)
+	default:
+		return fmt.Errorf("unknown command %q, see curctl -h", cmd)
+	}
+}
+
+// transportCreds returns the dial option of the transport security
+func transportCreds(opts *options) (grpc.DialOption, error) {
+	if opts.insecure {
+		return grpc.WithInsecure(), nil
+	}
+	tlsCreds, err := credentials.NewClientTLSFromFile(opts.caFile, "")
+	if err != nil {
+		return nil, err
+	}
+	return grpc.WithTransportCredentials(tlsCreds), nil
+}
+
+// dial connects to the currency server with the credentials set by
+// the flags: a token, an api key, or a token obtained from login.
+func dial(ctx context.Context, opts *options) (*grpc.ClientConn, error) {
+	transport, err := transportCreds(opts)
+	if err != nil {
+		return nil, err
+	}
+	dialOpts := []grpc.DialOption{transport}
+
+	token := opts.token
+	if token == "" && opts.pwd != "" {
+		if token, err = login(ctx, opts); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case token != "":
+		dialOpts = append(dialOpts, grpc.WithPerRPCCredentials(util.NewJwtCreds(token)))
+	case opts.apiKey != "":
+		dialOpts = append(dialOpts, grpc.WithPerRPCCredentials(util.NewApiKeyCreds(opts.apiKey)))
+	}
+	return grpc.Dial(opts.addr, dialOpts...)
+}
+
+// login obtains a token from the auth service
+func login(ctx context.Context, opts *options) (string, error) {
+	if opts.pwd == "" {
+		return "", fmt.Errorf("login requires flag -pwd")
+	}
+	transport, err := transportCreds(opts)
+	if err != nil {
+		return "", err
+	}
+	conn, err := grpc.Dial(opts.authAddr, transport)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	resp, err := pb.NewAuthClient(conn).Login(ctx, &pb.AuthRequest{Uname: opts.user, Pwd: opts.pwd})
+	if err != nil {
+		return "", err
+	}
+	return resp.GetToken(), nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/golang/protobuf/jsonpb"
+
+	pb "github.com/vladimirvivien/go-grpc/protobuf"
+)
+
+// printer prints the results of the commands as a table,
+// or as JSON (using the protobuf JSON mapping for messages)
+type printer struct {
+	w      io.Writer
+	json   bool
+	header bool // table header already printed
+}
+
+func newPrinter(w io.Writer, format string) *printer {
+	return &printer{w: w, json: format == "json"}
+}
+
+const rowFormat = "%-50s%-30s%-6s%s\n"
+
+func (p *printer) row(cur *pb.Currency) {
+	if !p.header {
+		fmt.Fprintf(p.w, rowFormat, "COUNTRY", "NAME", "CODE", "NUMBER")
+		p.header = true
+	}
+	fmt.Fprintf(p.w, rowFormat, cur.GetCountry(), cur.GetName(), cur.GetCode(), fmt.Sprint(cur.GetNumber()))
+}
+
+// currencies prints a list of currencies, as a CurrencyList
+// object in JSON so that it can be read by save-from-file
+func (p *printer) currencies(curList *pb.CurrencyList) error {
+	if p.json {
+		m := jsonpb.Marshaler{Indent: "  "}
+		if err := m.Marshal(p.w, curList); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintln(p.w)
+		return err
+	}
+	for _, cur := range curList.GetItems() {
+		p.row(cur)
+	}
+	return nil
+}
+
+// currency prints a currency received from a stream,
+// as a single line of JSON
+func (p *printer) currency(cur *pb.Currency) error {
+	if p.json {
+		m := jsonpb.Marshaler{}
+		if err := m.Marshal(p.w, cur); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintln(p.w)
+		return err
+	}
+	p.row(cur)
+	return nil
+}
+
+// conversion prints the code and number of a currency
+func (p *printer) conversion(cur *pb.Currency) error {
+	if p.json {
+		return p.encode(map[string]interface{}{"code": cur.GetCode(), "number": cur.GetNumber()})
+	}
+	_, err := fmt.Fprintf(p.w, "%s = %d\n", cur.GetCode(), cur.GetNumber())
+	return err
+}
+
+// token prints a login token
+func (p *printer) token(token string) error {
+	if p.json {
+		return p.encode(map[string]string{"token": token})
+	}
+	_, err := fmt.Fprintln(p.w, token)
+	return err
+}
+
+// names prints a list of names, one per line
+func (p *printer) names(names []string) error {
+	if p.json {
+		return p.encode(names)
+	}
+	for _, name := range names {
+		if _, err := fmt.Fprintln(p.w, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *printer) encode(v interface{}) error {
+	enc := json.NewEncoder(p.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+)
+
+// reflectClient queries the server reflection service
+// over a single ServerReflectionInfo stream
+type reflectClient struct {
+	stream rpb.ServerReflection_ServerReflectionInfoClient
+}
+
+func newReflectClient(ctx context.Context, conn *grpc.ClientConn) (*reflectClient, error) {
+	stream, err := rpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &reflectClient{stream: stream}, nil
+}
+
+func (r *reflectClient) close() {
+	r.stream.CloseSend()
+}
+
+// call sends a reflection request and returns its response
+func (r *reflectClient) call(req *rpb.ServerReflectionRequest) (*rpb.ServerReflectionResponse, error) {
+	if err := r.stream.Send(req); err != nil {
+		return nil, err
+	}
+	resp, err := r.stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	if errResp := resp.GetErrorResponse(); errResp != nil {
+		return nil, fmt.Errorf("reflection: %s", errResp.GetErrorMessage())
+	}
+	return resp, nil
+}
+
+// listServices returns the sorted names of the services of the server
+func (r *reflectClient) listServices() ([]string, error) {
+	resp, err := r.call(&rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_ListServices{ListServices: "*"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, service := range resp.GetListServicesResponse().GetService() {
+		names = append(names, service.GetName())
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// listMethods returns the full names of the methods of service
+// (i.e. protobuf.CurrencyService.GetCurrencyList), as grpcurl does
+func (r *reflectClient) listMethods(service string) ([]string, error) {
+	resp, err := r.call(&rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: service},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the file defining the service comes first, followed by its
+	// dependencies; look for the service in all of them regardless
+	for _, raw := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+		file := new(descriptor.FileDescriptorProto)
+		if err := proto.Unmarshal(raw, file); err != nil {
+			return nil, err
+		}
+		for _, svc := range file.GetService() {
+			name := svc.GetName()
+			if file.GetPackage() != "" {
+				name = file.GetPackage() + "." + name
+			}
+			if name != service {
+				continue
+			}
+			var methods []string
+			for _, method := range svc.GetMethod() {
+				methods = append(methods, name+"."+method.GetName())
+			}
+			return methods, nil
+		}
+	}
+	return nil, fmt.Errorf("service %q not found", service)
+}
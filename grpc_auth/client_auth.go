@@ -14,6 +14,8 @@ import (
 	"google.golang.org/grpc/metadata"
 
 	pb "github.com/vladimirvivien/go-grpc/protobuf"
+	"github.com/vladimirvivien/go-grpc/util"
+	"github.com/vladimirvivien/go-grpc/util/logging"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/status"
@@ -265,14 +267,20 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	log.Printf("login ok: token %s\n", token)
+	log.Printf("login ok: token %s\n", util.RedactToken(token))
+
+	// interceptors run in the order they are added (see util.ClientChain)
+	logOpts := logging.Options{}
+	chain := util.NewClientChain().
+		Add(logging.UnaryClientIntercept(logOpts), logging.StreamClientIntercept(logOpts)).
+		Add(authUnaryIntercept, authStreamIntercept)
 
 	// setup insecure connection
 	conn, err := grpc.Dial(
 		serverAddr,
 		grpc.WithTransportCredentials(tlsCreds),
-		grpc.WithUnaryInterceptor(authUnaryIntercept),
-		grpc.WithStreamInterceptor(authStreamIntercept),
+		grpc.WithUnaryInterceptor(chain.UnaryInterceptor()),
+		grpc.WithStreamInterceptor(chain.StreamInterceptor()),
 	)
 
 	if err != nil {
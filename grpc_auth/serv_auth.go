@@ -1,10 +1,12 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net"
+	"time"
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
@@ -13,17 +15,32 @@ import (
 
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
 
 	jwt "github.com/dgrijalva/jwt-go"
 	pb "github.com/vladimirvivien/go-grpc/protobuf"
 	"github.com/vladimirvivien/go-grpc/util"
+	"github.com/vladimirvivien/go-grpc/util/config"
+	"github.com/vladimirvivien/go-grpc/util/logging"
+	"github.com/vladimirvivien/go-grpc/util/metrics"
 )
 
 const (
-	port        = ":50051"
-	dataFile    = "./../curdata.csv"
-	srvCertFile = "./../certs/server.crt"
-	srvKeyFile  = "./../certs/server.key"
+	keysReload = 5 * time.Second
+)
+
+var (
+	// secret verifying the tokens signed by the auth service
+	jwtSecret []byte
+
+	// authorization policy loaded at startup
+	policy *util.Policy
+
+	// api keys managed by the auth service
+	apiKeys *util.ApiKeyStore
+
+	// tokens revoked by the auth service
+	revoked = util.NewRevocationList()
 )
 
 // CurrencyService implements the pb CurrencyServiceServer interface
@@ -47,7 +64,7 @@ func (c *CurrencyService) GetCurrencyList(
 			"must provide currency number or code",
 		)
 	}
-	items := c.ds.Search(req.GetCode(), req.GetNumber())
+	items := c.ds.Search(ctx, req.GetCode(), req.GetNumber())
 	return &pb.CurrencyList{Items: items}, nil
 }
 
@@ -64,7 +81,7 @@ func (c *CurrencyService) GetCurrencyStream(
 		)
 	}
 
-	items := c.ds.Search(req.GetCode(), req.GetNumber())
+	items := c.ds.Search(stream.Context(), req.GetCode(), req.GetNumber())
 
 	for _, cur := range items {
 		if err := stream.Send(cur); err != nil {
@@ -87,7 +104,9 @@ func (c *CurrencyService) SaveCurrencyStream(
 		if err != nil {
 			// if done, close sream and return result
 			if err == io.EOF {
-				c.ds.Add(curList.Items)
+				if err := c.ds.Add(curList.Items); err != nil {
+					return status.Errorf(codes.Internal, "failed to save currencies: %v", err)
+				}
 				return stream.SendAndClose(curList)
 			}
 			return err
@@ -132,7 +151,7 @@ func (c *CurrencyService) FindCurrencyStream(
 			)
 		}
 
-		items := c.ds.Search(req.GetCode(), req.GetNumber())
+		items := c.ds.Search(stream.Context(), req.GetCode(), req.GetNumber())
 		for _, cur := range items {
 			if err := stream.Send(cur); err != nil {
 				return err
@@ -142,38 +161,52 @@ func (c *CurrencyService) FindCurrencyStream(
 }
 
 // authUnaryIntercept intercepts incoming requests to validate
-// jwt token from metadata header "authorization"
+// jwt token from metadata header "authorization". Once validated,
+// the request is handed to the policy interceptor for authorization.
 func authUnaryIntercept(
 	ctx context.Context,
 	req interface{},
 	info *grpc.UnaryServerInfo,
 	handler grpc.UnaryHandler,
 ) (resp interface{}, err error) {
-	if err := auth(ctx); err != nil {
+	// health checks are made by probes without credentials
+	if util.IsHealthMethod(info.FullMethod) {
+		return handler(ctx, req)
+	}
+	ctx, err = auth(ctx)
+	if err != nil {
 		return nil, err
 	}
-	log.Println("authorization OK")
-	return handler(ctx, req)
+	log.Println("authentication OK")
+	return util.AuthzUnaryIntercept(policy)(ctx, req, info, handler)
 }
 
-// streamAuthIntercept intercepts to validate authorization
+// streamAuthIntercept intercepts to validate authentication
+// then authorization of stream methods.
 func streamAuthIntercept(
 	server interface{},
 	stream grpc.ServerStream,
 	info *grpc.StreamServerInfo,
 	handler grpc.StreamHandler,
 ) error {
-	if err := auth(stream.Context()); err != nil {
+	if util.IsHealthMethod(info.FullMethod) {
+		return handler(server, stream)
+	}
+	ctx, err := auth(stream.Context())
+	if err != nil {
 		return err
 	}
-	log.Println("authorization OK")
-	return handler(server, stream)
+	log.Println("authentication OK")
+	stream = util.WrapServerStream(stream, ctx)
+	return util.AuthzStreamIntercept(policy)(server, stream, info, handler)
 }
 
-func auth(ctx context.Context) error {
+// auth validates the jwt token, or the api key, and returns
+// a context that carries the identity of the caller.
+func auth(ctx context.Context) (context.Context, error) {
 	meta, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
-		return status.Errorf(
+		return nil, status.Errorf(
 			codes.InvalidArgument,
 			"missing context",
 		)
@@ -181,7 +214,23 @@ func auth(ctx context.Context) error {
 
 	authString, ok := meta["authorization"]
 	if !ok {
-		return status.Errorf(
+		// api keys are used by callers that cannot login
+		if key, ok := meta["x-api-key"]; ok {
+			id, err := apiKeys.Verify(key[0])
+			if err != nil {
+				return nil, status.Error(codes.Unauthenticated, err.Error())
+			}
+			log.Println("found api key", id.Subject)
+			return util.NewIdentityContext(ctx, id), nil
+		}
+		// callers authenticated with a client certificate (mTLS)
+		// do not need a token, scopes are granted to their roles.
+		if id, ok := util.IdentityFromPeer(ctx); ok {
+			log.Println("found client certificate for", id.Subject)
+			id.Scopes = policy.ScopesFor(id.Roles)
+			return util.NewIdentityContext(ctx, id), nil
+		}
+		return nil, status.Errorf(
 			codes.Unauthenticated,
 			"missing authorization",
 		)
@@ -195,47 +244,118 @@ func auth(ctx context.Context) error {
 				return nil, fmt.Errorf("bad signing method")
 			}
 			// additional validation goes here.
-			return []byte("a1b2c3d"), nil
+			return jwtSecret, nil
 		},
 	)
 
-	if jwtToken.Valid {
-		return nil
+	// malformed tokens are returned as nil
+	if err != nil || !jwtToken.Valid {
+		return nil, status.Error(codes.Unauthenticated, "bad token")
+	}
+	if revoked.Revoked(jwtToken) {
+		return nil, status.Error(codes.Unauthenticated, "token revoked")
 	}
+	id, err := util.IdentityFromJwt(jwtToken)
 	if err != nil {
-		return status.Error(codes.Internal, err.Error())
+		return nil, status.Error(codes.Unauthenticated, err.Error())
 	}
-	return status.Error(codes.Internal, "bad token")
+	return util.NewIdentityContext(ctx, id), nil
 }
 
 func main() {
-	ds := util.NewDataStore(dataFile)
-	if err := ds.Load(); err != nil {
+	mtls := flag.Bool("mtls", false, "require client certificates signed by the CA")
+	cfg, err := config.Load()
+	if err != nil {
 		log.Fatal(err)
 	}
+	jwtSecret = []byte(cfg.Auth.Secret)
 
-	lstnr, err := net.Listen("tcp", port)
+	ds := util.NewDataStore(cfg.Currency.DataFile)
+	if err := ds.OpenLog(cfg.Currency.WALFile); err != nil {
+		log.Fatal(err)
+	}
+	metrics.RegisterDataStore(ds)
+
+	policy, err = util.LoadPolicy(cfg.Currency.PolicyFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// api keys are reloaded when changed by the auth service
+	apiKeys, err = util.NewApiKeyStore(cfg.Currency.APIKeyFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go apiKeys.Watch(keysReload, nil)
+
+	lstnr, err := net.Listen("tcp", cfg.Currency.Addr)
 	if err != nil {
 		log.Fatal("failed to start server:", err)
 	}
 
-	tlsCreds, err := credentials.NewServerTLSFromFile(srvCertFile, srvKeyFile)
+	// certificates are reloaded when renewed on disk
+	ca := ""
+	if *mtls {
+		ca = cfg.TLS.CAFile
+	}
+	certs, err := util.NewCertReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile, ca)
 	if err != nil {
 		log.Fatal(err)
 	}
+	go certs.Watch(cfg.TLS.CertReload, nil)
+	tlsCreds := certs.ServerCreds(*mtls)
+
+	// follow the auth service's token revocation feed
+	authCreds, err := credentials.NewClientTLSFromFile(cfg.TLS.CAFile, "")
+	if err != nil {
+		log.Fatal(err)
+	}
+	authConn, err := grpc.Dial(cfg.Currency.AuthAddr, grpc.WithTransportCredentials(authCreds))
+	if err != nil {
+		log.Fatal(err)
+	}
+	go revoked.Follow(pb.NewAuthClient(authConn), nil)
+
+	// interceptors run in the order they are added (see util.ServerChain)
+	logOpts := logging.Options{}
+	chain := util.NewServerChain().
+		Add(util.RecoveryUnaryIntercept(), util.RecoveryStreamIntercept()).
+		Add(logging.UnaryServerIntercept(logOpts), logging.StreamServerIntercept(logOpts)).
+		Add(metrics.UnaryServerIntercept(), metrics.StreamServerIntercept()).
+		Add(authUnaryIntercept, streamAuthIntercept)
 
 	// setup and register currency service
 	curService := newCurrencyService(ds)
 	grpcServer := grpc.NewServer(
 		grpc.Creds(tlsCreds),
-		grpc.UnaryInterceptor(authUnaryIntercept),
-		grpc.StreamInterceptor(streamAuthIntercept),
+		grpc.UnaryInterceptor(chain.UnaryInterceptor()),
+		grpc.StreamInterceptor(chain.StreamInterceptor()),
 	)
 	pb.RegisterCurrencyServiceServer(grpcServer, curService)
 
+	// the service reports SERVING once its data is loaded
+	hs := util.RegisterHealth(grpcServer, ds, util.CurrencyServiceName)
+	// the write-ahead log is flushed once the pending calls are done
+	stopped := util.StopOnSignal(grpcServer, hs, cfg.Currency.Drain, ds.Close)
+
+	// let tools (i.e. curctl list, grpcurl) discover the services
+	reflection.Register(grpcServer)
+
+	// load the data in the background, then reload it when modified
+	go func() {
+		if err := ds.Load(); err != nil {
+			log.Fatal(err)
+		}
+		ds.Watch(cfg.Currency.DataReload, nil)
+	}()
+
+	// expose metrics on a local /metrics endpoint
+	metrics.Serve(cfg.Currency.MetricsAddr)
+
 	// start service's server
-	log.Println("starting secure currency rpc service on", port)
+	log.Println("starting secure currency rpc service on", cfg.Currency.Addr)
 	if err := grpcServer.Serve(lstnr); err != nil {
 		log.Fatal(err)
 	}
+	<-stopped
 }
@@ -11,13 +11,15 @@ import (
 
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
 
 	pb "github.com/vladimirvivien/go-grpc/protobuf"
 	"github.com/vladimirvivien/go-grpc/util"
+	"github.com/vladimirvivien/go-grpc/util/config"
+	"github.com/vladimirvivien/go-grpc/util/logging"
+	"github.com/vladimirvivien/go-grpc/util/metrics"
 )
 
-const port = ":50051"
-
 // CurrencyService implements the pb CurrencyServiceServer interface
 type CurrencyService struct {
 	mtex sync.Mutex
@@ -160,26 +162,51 @@ func (c *CurrencyService) FindCurrencyStream(
 }
 
 func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// load data into protobuf structures
-	data, err := util.LoadPbFromCsv("./../curdata.csv")
+	data, err := util.LoadPbFromCsv(cfg.Currency.DataFile)
 	if err != nil {
 		log.Fatal(err) // dont start
 	}
 
-	lstnr, err := net.Listen("tcp", port)
+	lstnr, err := net.Listen("tcp", cfg.Currency.Addr)
 	if err != nil {
 		log.Fatal("failed to start server:", err)
 	}
 
+	// interceptors run in the order they are added (see util.ServerChain)
+	logOpts := logging.Options{}
+	chain := util.NewServerChain().
+		Add(util.RecoveryUnaryIntercept(), util.RecoveryStreamIntercept()).
+		Add(logging.UnaryServerIntercept(logOpts), logging.StreamServerIntercept(logOpts)).
+		Add(metrics.UnaryServerIntercept(), metrics.StreamServerIntercept())
+
 	// setup and register currency service
 	curService := newCurrencyService(data)
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(
+		grpc.UnaryInterceptor(chain.UnaryInterceptor()),
+		grpc.StreamInterceptor(chain.StreamInterceptor()),
+	)
 	pb.RegisterCurrencyServiceServer(grpcServer, curService)
 
+	// the data is loaded, the service is reported SERVING right away
+	hs := util.RegisterHealth(grpcServer, nil, util.CurrencyServiceName)
+	stopped := util.StopOnSignal(grpcServer, hs, cfg.Currency.Drain)
+
+	// let tools (i.e. curctl list, grpcurl) discover the services
+	reflection.Register(grpcServer)
+
+	// expose metrics on a local /metrics endpoint
+	metrics.Serve(cfg.Currency.MetricsAddr)
+
 	// start service's server
-	log.Println("starting currency rpc service on", port)
+	log.Println("starting currency rpc service on", cfg.Currency.Addr)
 	if err := grpcServer.Serve(lstnr); err != nil {
 		log.Fatal(err)
 	}
+	<-stopped
 }
@@ -6,21 +6,16 @@ import (
 	"net"
 
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/status"
 
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
 
 	pb "github.com/vladimirvivien/go-grpc/protobuf"
 	"github.com/vladimirvivien/go-grpc/util"
-)
-
-const (
-	port        = ":50051"
-	dataFile    = "./../curdata.csv"
-	srvCertFile = "./../certs/server.crt"
-	srvKeyFile  = "./../certs/server.key"
+	"github.com/vladimirvivien/go-grpc/util/config"
+	"github.com/vladimirvivien/go-grpc/util/metrics"
 )
 
 // CurrencyService implements the pb CurrencyServiceServer interface
@@ -44,7 +39,7 @@ func (c *CurrencyService) GetCurrencyList(
 			"must provide currency number or code",
 		)
 	}
-	items := c.ds.Search(req.GetCode(), req.GetNumber())
+	items := c.ds.Search(ctx, req.GetCode(), req.GetNumber())
 	return &pb.CurrencyList{Items: items}, nil
 }
 
@@ -61,7 +56,7 @@ func (c *CurrencyService) GetCurrencyStream(
 		)
 	}
 
-	items := c.ds.Search(req.GetCode(), req.GetNumber())
+	items := c.ds.Search(stream.Context(), req.GetCode(), req.GetNumber())
 
 	for _, cur := range items {
 		if err := stream.Send(cur); err != nil {
@@ -84,7 +79,9 @@ func (c *CurrencyService) SaveCurrencyStream(
 		if err != nil {
 			// if done, close sream and return result
 			if err == io.EOF {
-				c.ds.Add(curList.Items)
+				if err := c.ds.Add(curList.Items); err != nil {
+					return status.Errorf(codes.Internal, "failed to save currencies: %v", err)
+				}
 				return stream.SendAndClose(curList)
 			}
 			return err
@@ -129,7 +126,7 @@ func (c *CurrencyService) FindCurrencyStream(
 			)
 		}
 
-		items := c.ds.Search(req.GetCode(), req.GetNumber())
+		items := c.ds.Search(stream.Context(), req.GetCode(), req.GetNumber())
 		for _, cur := range items {
 			if err := stream.Send(cur); err != nil {
 				return err
@@ -165,33 +162,69 @@ func streamLogIntercept(
 }
 
 func main() {
-	ds := util.NewDataStore(dataFile)
-	if err := ds.Load(); err != nil {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ds := util.NewDataStore(cfg.Currency.DataFile)
+	if err := ds.OpenLog(cfg.Currency.WALFile); err != nil {
 		log.Fatal(err)
 	}
+	metrics.RegisterDataStore(ds)
 
-	lstnr, err := net.Listen("tcp", port)
+	lstnr, err := net.Listen("tcp", cfg.Currency.Addr)
 	if err != nil {
 		log.Fatal("failed to start server:", err)
 	}
 
-	tlsCreds, err := credentials.NewServerTLSFromFile(srvCertFile, srvKeyFile)
+	// certificates are reloaded when renewed on disk
+	certs, err := util.NewCertReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile, "")
 	if err != nil {
 		log.Fatal(err)
 	}
+	go certs.Watch(cfg.TLS.CertReload, nil)
+	tlsCreds := certs.ServerCreds(false)
+
+	// recover from panics then log each call, more interceptors
+	// can be added to the chain, they run in the order they are added
+	chain := util.NewServerChain().
+		Add(util.RecoveryUnaryIntercept(), util.RecoveryStreamIntercept()).
+		Add(unaryLogIntercept, streamLogIntercept).
+		Add(metrics.UnaryServerIntercept(), metrics.StreamServerIntercept())
 
 	// setup and register currency service
 	curService := newCurrencyService(ds)
 	grpcServer := grpc.NewServer(
 		grpc.Creds(tlsCreds),
-		grpc.UnaryInterceptor(unaryLogIntercept),   // register log interceptor
-		grpc.StreamInterceptor(streamLogIntercept), // add stream log interceptor
+		grpc.UnaryInterceptor(chain.UnaryInterceptor()),
+		grpc.StreamInterceptor(chain.StreamInterceptor()),
 	)
 	pb.RegisterCurrencyServiceServer(grpcServer, curService)
 
+	// the service reports SERVING once its data is loaded
+	hs := util.RegisterHealth(grpcServer, ds, util.CurrencyServiceName)
+	// the write-ahead log is flushed once the pending calls are done
+	stopped := util.StopOnSignal(grpcServer, hs, cfg.Currency.Drain, ds.Close)
+
+	// let tools (i.e. curctl list, grpcurl) discover the services
+	reflection.Register(grpcServer)
+
+	// load the data in the background, then reload it when modified
+	go func() {
+		if err := ds.Load(); err != nil {
+			log.Fatal(err)
+		}
+		ds.Watch(cfg.Currency.DataReload, nil)
+	}()
+
+	// expose metrics on a local /metrics endpoint
+	metrics.Serve(cfg.Currency.MetricsAddr)
+
 	// start service's server
-	log.Println("starting secure currency rpc service on", port)
+	log.Println("starting secure currency rpc service on", cfg.Currency.Addr)
 	if err := grpcServer.Serve(lstnr); err != nil {
 		log.Fatal(err)
 	}
+	<-stopped
 }
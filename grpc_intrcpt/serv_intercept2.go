@@ -0,0 +1,211 @@
+package main
+
+import (
+	"io"
+	"log"
+	"log/slog"
+	"net"
+	"os"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+
+	pb "github.com/vladimirvivien/go-grpc/protobuf"
+	"github.com/vladimirvivien/go-grpc/util"
+	"github.com/vladimirvivien/go-grpc/util/config"
+	"github.com/vladimirvivien/go-grpc/util/logging"
+	"github.com/vladimirvivien/go-grpc/util/metrics"
+)
+
+// CurrencyService implements the pb CurrencyServiceServer interface
+type CurrencyService struct {
+	ds *util.DataStore
+}
+
+func newCurrencyService(ds *util.DataStore) *CurrencyService {
+	return &CurrencyService{ds: ds}
+}
+
+// GetCurrencyList searches (by Code or Number) and return CurrencyList
+func (c *CurrencyService) GetCurrencyList(
+	ctx context.Context,
+	req *pb.CurrencyRequest,
+) (*pb.CurrencyList, error) {
+
+	if req.GetNumber() == 0 && req.GetCode() == "" {
+		return nil, status.Errorf(
+			codes.InvalidArgument,
+			"must provide currency number or code",
+		)
+	}
+	items := c.ds.Search(ctx, req.GetCode(), req.GetNumber())
+	return &pb.CurrencyList{Items: items}, nil
+}
+
+// GetCurrencyStream returns matching Currencies as a server stream
+func (c *CurrencyService) GetCurrencyStream(
+	req *pb.CurrencyRequest,
+	stream pb.CurrencyService_GetCurrencyStreamServer,
+) error {
+
+	if req.GetNumber() == 0 && req.GetCode() == "" {
+		return status.Errorf(
+			codes.InvalidArgument,
+			"must provide currency number or code",
+		)
+	}
+
+	items := c.ds.Search(stream.Context(), req.GetCode(), req.GetNumber())
+
+	for _, cur := range items {
+		if err := stream.Send(cur); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SaveCurrencyStream adds Currency values from a stream to currency items
+func (c *CurrencyService) SaveCurrencyStream(
+	stream pb.CurrencyService_SaveCurrencyStreamServer,
+) error {
+
+	curList := new(pb.CurrencyList)
+	for {
+		cur, err := stream.Recv()
+
+		if err != nil {
+			// if done, close sream and return result
+			if err == io.EOF {
+				if err := c.ds.Add(curList.Items); err != nil {
+					return status.Errorf(codes.Internal, "failed to save currencies: %v", err)
+				}
+				return stream.SendAndClose(curList)
+			}
+			return err
+		}
+
+		if cur.GetName() == "" ||
+			cur.Code == "" ||
+			cur.Number == 0 || cur.Country == "" {
+
+			return status.Errorf(
+				codes.InvalidArgument,
+				"invalid request, must provide number or code",
+			)
+		}
+
+		curList.Items = append(curList.Items, cur)
+	}
+
+}
+
+// FindCurrencyStream sends a stream of CurrencyRequest while
+// streaming Currency values from server.
+func (c *CurrencyService) FindCurrencyStream(
+	stream pb.CurrencyService_FindCurrencyStreamServer,
+) error {
+
+	for {
+		req, err := stream.Recv()
+
+		if err != nil {
+			if err == io.EOF {
+				return nil // we're done
+			}
+			return err
+		}
+
+		// validate req
+		if req.GetNumber() == 0 && req.GetCode() == "" {
+			return status.Errorf(
+				codes.InvalidArgument,
+				"invalid request, must provide number or code",
+			)
+		}
+
+		items := c.ds.Search(stream.Context(), req.GetCode(), req.GetNumber())
+		for _, cur := range items {
+			if err := stream.Send(cur); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ds := util.NewDataStore(cfg.Currency.DataFile)
+	if err := ds.OpenLog(cfg.Currency.WALFile); err != nil {
+		log.Fatal(err)
+	}
+	metrics.RegisterDataStore(ds)
+
+	lstnr, err := net.Listen("tcp", cfg.Currency.Addr)
+	if err != nil {
+		log.Fatal("failed to start server:", err)
+	}
+
+	// certificates are reloaded when renewed on disk
+	certs, err := util.NewCertReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile, "")
+	if err != nil {
+		log.Fatal(err)
+	}
+	go certs.Watch(cfg.TLS.CertReload, nil)
+	tlsCreds := certs.ServerCreds(false)
+
+	// structured (JSON) logging of each call, payloads are
+	// logged with sensitive fields redacted
+	logOpts := logging.Options{
+		Logger:      slog.New(slog.NewJSONHandler(os.Stderr, nil)),
+		LogPayloads: true,
+	}
+	chain := util.NewServerChain().
+		Add(util.RecoveryUnaryIntercept(), util.RecoveryStreamIntercept()).
+		Add(logging.UnaryServerIntercept(logOpts), logging.StreamServerIntercept(logOpts)).
+		Add(metrics.UnaryServerIntercept(), metrics.StreamServerIntercept())
+
+	// setup and register currency service
+	curService := newCurrencyService(ds)
+	grpcServer := grpc.NewServer(
+		grpc.Creds(tlsCreds),
+		grpc.UnaryInterceptor(chain.UnaryInterceptor()),
+		grpc.StreamInterceptor(chain.StreamInterceptor()),
+	)
+	pb.RegisterCurrencyServiceServer(grpcServer, curService)
+
+	// the service reports SERVING once its data is loaded
+	hs := util.RegisterHealth(grpcServer, ds, util.CurrencyServiceName)
+	// the write-ahead log is flushed once the pending calls are done
+	stopped := util.StopOnSignal(grpcServer, hs, cfg.Currency.Drain, ds.Close)
+
+	// let tools (i.e. curctl list, grpcurl) discover the services
+	reflection.Register(grpcServer)
+
+	// load the data in the background, then reload it when modified
+	go func() {
+		if err := ds.Load(); err != nil {
+			log.Fatal(err)
+		}
+		ds.Watch(cfg.Currency.DataReload, nil)
+	}()
+
+	// expose metrics on a local /metrics endpoint
+	metrics.Serve(cfg.Currency.MetricsAddr)
+
+	// start service's server
+	log.Println("starting secure currency rpc service on", cfg.Currency.Addr)
+	if err := grpcServer.Serve(lstnr); err != nil {
+		log.Fatal(err)
+	}
+	<-stopped
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"net"
 	"time"
 
 	"golang.org/x/net/context"
@@ -14,31 +13,21 @@ import (
 
 	pb "github.com/vladimirvivien/go-grpc/protobuf"
 	"github.com/vladimirvivien/go-grpc/util"
+	"github.com/vladimirvivien/go-grpc/util/config"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/status"
 )
 
-const (
-	server         = "127.0.0.1"
-	serverPort     = "50051"
-	authServer     = server
-	authPort       = "50052"
-	certFile       = "./../certs/ca.pem"
-	maxRcvdMsgSize = 1024 * 1024 // 1 MB limit
-	maxSendMsgSize = 500 * 1024  // 500K send limit
-
-)
-
 var (
 	token string
 )
 
 // call auth service to get token
-func login(client pb.AuthClient) (string, error) {
+func login(client pb.AuthClient, uname, pwd string) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5000*time.Millisecond)
 	defer cancel()
-	user := &pb.AuthRequest{Uname: "vector", Pwd: "abc123"}
+	user := &pb.AuthRequest{Uname: uname, Pwd: pwd}
 	authResp, err := client.Login(ctx, user)
 	if err != nil {
 		return "", err
@@ -50,6 +39,8 @@ func login(client pb.AuthClient) (string, error) {
 func printUSD(client pb.CurrencyServiceClient) {
 	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
 	defer cancel()
+	// lookups serve users, they are shed last under load
+	ctx = util.NewCriticalityContext(ctx, util.CriticalityCritical)
 
 	curReq := &pb.CurrencyRequest{Code: "USD"}
 	curList, err := client.GetCurrencyList(ctx, curReq)
@@ -108,6 +99,8 @@ func printEUR(client pb.CurrencyServiceClient) {
 func addCurrencies(client pb.CurrencyServiceClient) {
 	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
 	defer cancel()
+	// bulk imports can be retried later, they are shed first under load
+	ctx = util.NewCriticalityContext(ctx, util.CriticalitySheddable)
 
 	currencies := []*pb.Currency{
 		&pb.Currency{Country: "HAITI", Name: "Gourde", Code: "HTG", Number: 332},
@@ -212,17 +205,19 @@ func findCurrencies(client pb.CurrencyServiceClient) {
 }
 
 func main() {
-	authAddr := net.JoinHostPort(authServer, authPort)
-	serverAddr := net.JoinHostPort(server, serverPort)
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// setup tls creds
-	tlsCreds, err := credentials.NewClientTLSFromFile(certFile, "")
+	tlsCreds, err := credentials.NewClientTLSFromFile(cfg.TLS.CAFile, "")
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	authConn, err := grpc.Dial(
-		authAddr,
+		cfg.Client.AuthAddr,
 		grpc.WithTransportCredentials(tlsCreds),
 		grpc.WithBackoffConfig(
 			grpc.BackoffConfig{MaxDelay: time.Second * 7},
@@ -234,7 +229,7 @@ func main() {
 	authClient := pb.NewAuthClient(authConn)
 
 	// get token from auth service
-	token, err = login(authClient)
+	token, err = login(authClient, cfg.Client.User, cfg.Client.Password)
 	if err != nil {
 		log.Fatal("login failed:", err)
 	}
@@ -243,19 +238,22 @@ func main() {
 
 	// setup connection to server
 	conn, err := grpc.Dial(
-		serverAddr,
+		cfg.Client.ServerAddr,
 		grpc.WithTransportCredentials(tlsCreds),
 		grpc.WithPerRPCCredentials(jwtCreds),
 		grpc.WithDefaultCallOptions(
-			grpc.MaxCallRecvMsgSize(maxRcvdMsgSize),
+			grpc.MaxCallRecvMsgSize(cfg.Client.MaxRecvMsgSize),
 		),
 		grpc.WithDefaultCallOptions(
-			grpc.MaxCallSendMsgSize(maxSendMsgSize),
+			grpc.MaxCallSendMsgSize(cfg.Client.MaxSendMsgSize),
 		),
 		grpc.WithDefaultCallOptions(grpc.FailFast(false)),
 		grpc.WithBackoffConfig(
 			grpc.BackoffConfig{MaxDelay: time.Second * 7},
 		),
+		// send the criticality of the calls
+		grpc.WithUnaryInterceptor(util.CriticalityUnaryClientIntercept()),
+		grpc.WithStreamInterceptor(util.CriticalityStreamClientIntercept()),
 	)
 
 	if err != nil {
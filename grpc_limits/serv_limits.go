@@ -14,17 +14,23 @@ import (
 	"golang.org/x/net/context"
 	"golang.org/x/net/netutil"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
 
 	jwt "github.com/dgrijalva/jwt-go"
 	pb "github.com/vladimirvivien/go-grpc/protobuf"
 	"github.com/vladimirvivien/go-grpc/util"
+	"github.com/vladimirvivien/go-grpc/util/concurrency"
+	"github.com/vladimirvivien/go-grpc/util/config"
+	"github.com/vladimirvivien/go-grpc/util/logging"
+	"github.com/vladimirvivien/go-grpc/util/metrics"
 )
 
-const (
-	port        = ":50051"
-	dataFile    = "./../curdata.csv"
-	srvCertFile = "./../certs/server.crt"
-	srvKeyFile  = "./../certs/server.key"
+var (
+	// secret verifying the tokens signed by the auth service
+	jwtSecret []byte
+
+	// tokens revoked by the auth service
+	revoked = util.NewRevocationList()
 )
 
 // CurrencyService implements the pb CurrencyServiceServer interface
@@ -48,7 +54,7 @@ func (c *CurrencyService) GetCurrencyList(
 			"must provide currency number or code",
 		)
 	}
-	items := c.ds.Search(req.GetCode(), req.GetNumber())
+	items := c.ds.Search(ctx, req.GetCode(), req.GetNumber())
 	return &pb.CurrencyList{Items: items}, nil
 }
 
@@ -65,7 +71,7 @@ func (c *CurrencyService) GetCurrencyStream(
 		)
 	}
 
-	items := c.ds.Search(req.GetCode(), req.GetNumber())
+	items := c.ds.Search(stream.Context(), req.GetCode(), req.GetNumber())
 
 	for _, cur := range items {
 		if err := stream.Send(cur); err != nil {
@@ -88,7 +94,9 @@ func (c *CurrencyService) SaveCurrencyStream(
 		if err != nil {
 			// if done, close sream and return result
 			if err == io.EOF {
-				c.ds.Add(curList.Items)
+				if err := c.ds.Add(curList.Items); err != nil {
+					return status.Errorf(codes.Internal, "failed to save currencies: %v", err)
+				}
 				return stream.SendAndClose(curList)
 			}
 			return err
@@ -133,7 +141,7 @@ func (c *CurrencyService) FindCurrencyStream(
 			)
 		}
 
-		items := c.ds.Search(req.GetCode(), req.GetNumber())
+		items := c.ds.Search(stream.Context(), req.GetCode(), req.GetNumber())
 		for _, cur := range items {
 			if err := stream.Send(cur); err != nil {
 				return err
@@ -143,14 +151,20 @@ func (c *CurrencyService) FindCurrencyStream(
 }
 
 // authUnaryIntercept intercepts incoming requests to validate
-// jwt token from metadata header "authorization"
+// jwt token from metadata header "authorization", and attaches the
+// identity of the caller, which grants the criticality of its calls
 func authUnaryIntercept(
 	ctx context.Context,
 	req interface{},
 	info *grpc.UnaryServerInfo,
 	handler grpc.UnaryHandler,
 ) (resp interface{}, err error) {
-	if err := auth(ctx); err != nil {
+	// health checks are made by probes without credentials
+	if util.IsHealthMethod(info.FullMethod) {
+		return handler(ctx, req)
+	}
+	ctx, err = auth(ctx)
+	if err != nil {
 		return nil, err
 	}
 	log.Println("authorization OK")
@@ -164,17 +178,23 @@ func streamAuthIntercept(
 	info *grpc.StreamServerInfo,
 	handler grpc.StreamHandler,
 ) error {
-	if err := auth(stream.Context()); err != nil {
+	if util.IsHealthMethod(info.FullMethod) {
+		return handler(server, stream)
+	}
+	ctx, err := auth(stream.Context())
+	if err != nil {
 		return err
 	}
 	log.Println("authorization OK")
-	return handler(server, stream)
+	return handler(server, util.WrapServerStream(stream, ctx))
 }
 
-func auth(ctx context.Context) error {
+// auth validates the jwt token and returns a
+// context that carries the identity of the caller.
+func auth(ctx context.Context) (context.Context, error) {
 	meta, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
-		return status.Errorf(
+		return nil, status.Errorf(
 			codes.InvalidArgument,
 			"missing context",
 		)
@@ -182,7 +202,7 @@ func auth(ctx context.Context) error {
 
 	authString, ok := meta["authorization"]
 	if !ok {
-		return status.Errorf(
+		return nil, status.Errorf(
 			codes.Unauthenticated,
 			"missing authorization",
 		)
@@ -196,52 +216,120 @@ func auth(ctx context.Context) error {
 				return nil, fmt.Errorf("bad signing method")
 			}
 			// additional validation goes here.
-			return []byte("a1b2c3d"), nil
+			return jwtSecret, nil
 		},
 	)
 
-	if jwtToken.Valid {
-		return nil
+	// malformed tokens are returned as nil
+	if err != nil || !jwtToken.Valid {
+		return nil, status.Error(codes.Unauthenticated, "bad token")
+	}
+	if revoked.Revoked(jwtToken) {
+		return nil, status.Error(codes.Unauthenticated, "token revoked")
 	}
+	id, err := util.IdentityFromJwt(jwtToken)
 	if err != nil {
-		return status.Error(codes.Internal, err.Error())
+		return nil, status.Error(codes.Unauthenticated, err.Error())
 	}
-	return status.Error(codes.Internal, "bad token")
+	return util.NewIdentityContext(ctx, id), nil
 }
 
 func main() {
-	ds := util.NewDataStore(dataFile)
-	if err := ds.Load(); err != nil {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	jwtSecret = []byte(cfg.Auth.Secret)
+
+	ds := util.NewDataStore(cfg.Currency.DataFile)
+	if err := ds.OpenLog(cfg.Currency.WALFile); err != nil {
 		log.Fatal(err)
 	}
+	metrics.RegisterDataStore(ds)
 
-	tlsCreds, err := credentials.NewServerTLSFromFile(srvCertFile, srvKeyFile)
+	// certificates are reloaded when renewed on disk
+	certs, err := util.NewCertReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile, "")
 	if err != nil {
 		log.Fatal(err)
 	}
+	go certs.Watch(cfg.TLS.CertReload, nil)
+	tlsCreds := certs.ServerCreds(false)
+
+	// follow the auth service's token revocation feed
+	authCreds, err := credentials.NewClientTLSFromFile(cfg.TLS.CAFile, "")
+	if err != nil {
+		log.Fatal(err)
+	}
+	authConn, err := grpc.Dial(cfg.Currency.AuthAddr, grpc.WithTransportCredentials(authCreds))
+	if err != nil {
+		log.Fatal(err)
+	}
+	go revoked.Follow(pb.NewAuthClient(authConn), nil)
+
+	// the number of calls handled at once adapts to their latency,
+	// the calls over the limit are shed before they are handled
+	limiter := concurrency.NewLimiter(concurrency.Options{
+		Initial:      cfg.Currency.ConcurrencyLimit,
+		Min:          cfg.Currency.ConcurrencyMin,
+		Max:          cfg.Currency.ConcurrencyMax,
+		Tolerance:    cfg.Currency.LatencyTolerance,
+		QueueTimeout: cfg.Currency.ConcurrencyQueueTimeout,
+	})
+	metrics.RegisterConcurrencyLimiter(limiter)
+
+	// interceptors run in the order they are added (see util.ServerChain),
+	// the limiter runs after auth to admit the calls by the criticality
+	// granted to their caller
+	logOpts := logging.Options{}
+	chain := util.NewServerChain().
+		Add(util.RecoveryUnaryIntercept(), util.RecoveryStreamIntercept()).
+		Add(logging.UnaryServerIntercept(logOpts), logging.StreamServerIntercept(logOpts)).
+		Add(metrics.UnaryServerIntercept(), metrics.StreamServerIntercept()).
+		Add(authUnaryIntercept, streamAuthIntercept).
+		Add(limiter.UnaryServerIntercept(), limiter.StreamServerIntercept())
 
 	// setup and register currency service
 	curService := newCurrencyService(ds)
 	grpcServer := grpc.NewServer(
 		grpc.Creds(tlsCreds),
-		grpc.UnaryInterceptor(authUnaryIntercept),
-		grpc.StreamInterceptor(streamAuthIntercept),
-		grpc.MaxConcurrentStreams(16),  // limit concurrent stream of rpcs
-		grpc.MaxRecvMsgSize(500*1024),  // set max rcvd to 500k
-		grpc.MaxSendMsgSize(1024*1024), // set max send to 1mb
+		grpc.UnaryInterceptor(chain.UnaryInterceptor()),
+		grpc.StreamInterceptor(chain.StreamInterceptor()),
+		grpc.MaxRecvMsgSize(cfg.Currency.MaxRecvMsgSize), // max size of received messages
+		grpc.MaxSendMsgSize(cfg.Currency.MaxSendMsgSize), // max size of sent messages
 	)
 	pb.RegisterCurrencyServiceServer(grpcServer, curService)
 
-	lstnr, err := net.Listen("tcp", port)
+	// the service reports SERVING once its data is loaded
+	hs := util.RegisterHealth(grpcServer, ds, util.CurrencyServiceName)
+	// the write-ahead log is flushed once the pending calls are done
+	stopped := util.StopOnSignal(grpcServer, hs, cfg.Currency.Drain, ds.Close)
+
+	// let tools (i.e. curctl list, grpcurl) discover the services
+	reflection.Register(grpcServer)
+
+	// load the data in the background, then reload it when modified
+	go func() {
+		if err := ds.Load(); err != nil {
+			log.Fatal(err)
+		}
+		ds.Watch(cfg.Currency.DataReload, nil)
+	}()
+
+	lstnr, err := net.Listen("tcp", cfg.Currency.Addr)
 	if err != nil {
 		log.Fatal("failed to start server:", err)
 	}
-	// setup a listener with maximum 500 concurrent connections
-	limitedLis := netutil.LimitListener(lstnr, 500)
+	// setup a listener with a maximum of concurrent connections,
+	// a guard on file descriptors: the calls are limited above
+	limitedLis := netutil.LimitListener(lstnr, cfg.Currency.MaxConnections)
+
+	// expose metrics on a local /metrics endpoint
+	metrics.Serve(cfg.Currency.MetricsAddr)
 
 	// start service's server
-	log.Println("starting secure currency rpc service on", port)
+	log.Println("starting secure currency rpc service on", cfg.Currency.Addr)
 	if err := grpcServer.Serve(limitedLis); err != nil {
 		log.Fatal(err)
 	}
+	<-stopped
 }
@@ -4,47 +4,37 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"net"
 	"time"
 
 	"golang.org/x/net/context"
-	"golang.org/x/time/rate"
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
 
 	pb "github.com/vladimirvivien/go-grpc/protobuf"
 	"github.com/vladimirvivien/go-grpc/util"
+	"github.com/vladimirvivien/go-grpc/util/config"
+	"github.com/vladimirvivien/go-grpc/util/logging"
+	"github.com/vladimirvivien/go-grpc/util/metrics"
+	"github.com/vladimirvivien/go-grpc/util/ratelimit"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/status"
 )
 
-const (
-	server         = "127.0.0.1"
-	serverPort     = "50051"
-	authServer     = server
-	authPort       = "50052"
-	certFile       = "./../certs/ca.pem"
-	maxRcvdMsgSize = 1024 * 1024 // 1 MB limit
-	maxSendMsgSize = 500 * 1024  // 500K send limit
-
-)
-
 var (
 	token string
 
-	// clientRate is a global rate limiter
-	// it should be equal or lesser than
-	// server limits.
-	clientLimit = rate.NewLimiter(10, 1)
+	// clientLimit is a global rate limiter, it starts at the
+	// configured rate and adjusts to the limits of the server
+	clientLimit *ratelimit.ClientLimiter
 )
 
 // call auth service to get token
-func login(client pb.AuthClient) (string, error) {
+func login(client pb.AuthClient, uname, pwd string) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5000*time.Millisecond)
 	defer cancel()
-	user := &pb.AuthRequest{Uname: "vector", Pwd: "abc123"}
+	user := &pb.AuthRequest{Uname: uname, Pwd: pwd}
 	authResp, err := client.Login(ctx, user)
 	if err != nil {
 		return "", err
@@ -56,6 +46,8 @@ func login(client pb.AuthClient) (string, error) {
 func printUSD(client pb.CurrencyServiceClient) {
 	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
 	defer cancel()
+	// lookups serve users, they are shed last under load
+	ctx = util.NewCriticalityContext(ctx, util.CriticalityCritical)
 
 	curReq := &pb.CurrencyRequest{Code: "USD"}
 	curList, err := client.GetCurrencyList(ctx, curReq)
@@ -114,6 +106,8 @@ func printEUR(client pb.CurrencyServiceClient) {
 func addCurrencies(client pb.CurrencyServiceClient) {
 	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
 	defer cancel()
+	// bulk imports can be retried later, they are shed first under load
+	ctx = util.NewCriticalityContext(ctx, util.CriticalitySheddable)
 
 	currencies := []*pb.Currency{
 		&pb.Currency{Country: "HAITI", Name: "Gourde", Code: "HTG", Number: 332},
@@ -217,55 +211,21 @@ func findCurrencies(client pb.CurrencyServiceClient) {
 	}
 }
 
-// unaryRateIntercept applies client rate limit
-// before request is sent to server.
-func unaryRateIntercept(
-	ctx context.Context,
-	method string,
-	req, reply interface{},
-	conn *grpc.ClientConn,
-	invoker grpc.UnaryInvoker,
-	opts ...grpc.CallOption,
-) error {
-
-	if err := clientLimit.Wait(ctx); err != nil {
-		return status.Error(codes.ResourceExhausted, "client limit reached")
-	}
-	return invoker(ctx, method, req, reply, conn, opts...)
-}
-
-// streamRateIntercept applies client rate limit
-func streamRateIntercept(
-	ctx context.Context,
-	desc *grpc.StreamDesc,
-	conn *grpc.ClientConn,
-	method string,
-	streamer grpc.Streamer,
-	opts ...grpc.CallOption,
-) (grpc.ClientStream, error) {
-
-	if err := clientLimit.Wait(ctx); err != nil {
-		return nil,
-			status.Error(
-				codes.ResourceExhausted,
-				"client limit reached",
-			)
-	}
-	return streamer(ctx, desc, conn, method, opts...)
-}
-
 func main() {
-	authAddr := net.JoinHostPort(authServer, authPort)
-	serverAddr := net.JoinHostPort(server, serverPort)
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	clientLimit = ratelimit.NewClientLimiter(cfg.Client.RateLimit, cfg.Client.RateBurst)
 
 	// setup tls creds
-	tlsCreds, err := credentials.NewClientTLSFromFile(certFile, "")
+	tlsCreds, err := credentials.NewClientTLSFromFile(cfg.TLS.CAFile, "")
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	authConn, err := grpc.Dial(
-		authAddr,
+		cfg.Client.AuthAddr,
 		grpc.WithTransportCredentials(tlsCreds),
 		grpc.WithBackoffConfig(
 			grpc.BackoffConfig{MaxDelay: time.Second * 7},
@@ -277,30 +237,41 @@ func main() {
 	authClient := pb.NewAuthClient(authConn)
 
 	// get token from auth service
-	token, err = login(authClient)
+	token, err = login(authClient, cfg.Client.User, cfg.Client.Password)
 	if err != nil {
 		log.Fatal("login failed:", err)
 	}
 	// create a jwt credential with token
 	jwtCreds := util.NewJwtCreds(token)
 
+	// expose client metrics on a local /metrics endpoint
+	metrics.Serve(cfg.Client.MetricsAddr)
+
+	// interceptors run in the order they are added (see util.ClientChain)
+	logOpts := logging.Options{}
+	chain := util.NewClientChain().
+		Add(logging.UnaryClientIntercept(logOpts), logging.StreamClientIntercept(logOpts)).
+		Add(metrics.UnaryClientIntercept(), metrics.StreamClientIntercept()).
+		Add(clientLimit.UnaryClientIntercept(), clientLimit.StreamClientIntercept()).
+		Add(util.CriticalityUnaryClientIntercept(), util.CriticalityStreamClientIntercept())
+
 	// setup connection to server
 	conn, err := grpc.Dial(
-		serverAddr,
+		cfg.Client.ServerAddr,
 		grpc.WithTransportCredentials(tlsCreds),
 		grpc.WithPerRPCCredentials(jwtCreds),
 		grpc.WithDefaultCallOptions(
-			grpc.MaxCallRecvMsgSize(maxRcvdMsgSize),
+			grpc.MaxCallRecvMsgSize(cfg.Client.MaxRecvMsgSize),
 		),
 		grpc.WithDefaultCallOptions(
-			grpc.MaxCallSendMsgSize(maxSendMsgSize),
+			grpc.MaxCallSendMsgSize(cfg.Client.MaxSendMsgSize),
 		),
 		grpc.WithDefaultCallOptions(grpc.FailFast(false)),
 		grpc.WithBackoffConfig(
 			grpc.BackoffConfig{MaxDelay: time.Second * 7},
 		),
-		grpc.WithUnaryInterceptor(unaryRateIntercept),
-		grpc.WithStreamInterceptor(streamRateIntercept),
+		grpc.WithUnaryInterceptor(chain.UnaryInterceptor()),
+		grpc.WithStreamInterceptor(chain.StreamInterceptor()),
 	)
 
 	if err != nil {
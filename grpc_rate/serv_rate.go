@@ -5,6 +5,7 @@ import (
 	"io"
 	"log"
 	"net"
+	"time"
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
@@ -14,25 +15,31 @@ import (
 
 	"golang.org/x/net/context"
 	"golang.org/x/net/netutil"
-	"golang.org/x/time/rate"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
 
 	jwt "github.com/dgrijalva/jwt-go"
 	pb "github.com/vladimirvivien/go-grpc/protobuf"
 	"github.com/vladimirvivien/go-grpc/util"
-)
-
-const (
-	port        = ":50051"
-	dataFile    = "./../curdata.csv"
-	srvCertFile = "./../certs/server.crt"
-	srvKeyFile  = "./../certs/server.key"
+	"github.com/vladimirvivien/go-grpc/util/config"
+	"github.com/vladimirvivien/go-grpc/util/logging"
+	"github.com/vladimirvivien/go-grpc/util/metrics"
+	"github.com/vladimirvivien/go-grpc/util/ratelimit"
 )
 
 var (
-	// arate limit and bucket
-	// Make bucket value smaller to limit faster
-	rateLimit = rate.NewLimiter(500, 100)
+	// secret verifying the tokens signed by the auth service
+	jwtSecret []byte
+
+	// rate limits per caller and per method, set from the
+	// configuration. Make burst values smaller to limit faster
+	limiter *ratelimit.Limiter
+
+	// tokens revoked by the auth service
+	revoked = util.NewRevocationList()
+
+	// api keys issued by the auth service
+	apiKeys *util.ApiKeyStore
 )
 
 // CurrencyService implements the pb CurrencyServiceServer interface
@@ -56,7 +63,7 @@ func (c *CurrencyService) GetCurrencyList(
 			"must provide currency number or code",
 		)
 	}
-	items := c.ds.Search(req.GetCode(), req.GetNumber())
+	items := c.ds.Search(ctx, req.GetCode(), req.GetNumber())
 	return &pb.CurrencyList{Items: items}, nil
 }
 
@@ -73,7 +80,7 @@ func (c *CurrencyService) GetCurrencyStream(
 		)
 	}
 
-	items := c.ds.Search(req.GetCode(), req.GetNumber())
+	items := c.ds.Search(stream.Context(), req.GetCode(), req.GetNumber())
 
 	for _, cur := range items {
 		if err := stream.Send(cur); err != nil {
@@ -96,7 +103,9 @@ func (c *CurrencyService) SaveCurrencyStream(
 		if err != nil {
 			// if done, close sream and return result
 			if err == io.EOF {
-				c.ds.Add(curList.Items)
+				if err := c.ds.Add(curList.Items); err != nil {
+					return status.Errorf(codes.Internal, "failed to save currencies: %v", err)
+				}
 				return stream.SendAndClose(curList)
 			}
 			return err
@@ -141,7 +150,7 @@ func (c *CurrencyService) FindCurrencyStream(
 			)
 		}
 
-		items := c.ds.Search(req.GetCode(), req.GetNumber())
+		items := c.ds.Search(stream.Context(), req.GetCode(), req.GetNumber())
 		for _, cur := range items {
 			if err := stream.Send(cur); err != nil {
 				return err
@@ -151,14 +160,20 @@ func (c *CurrencyService) FindCurrencyStream(
 }
 
 // authUnaryIntercept intercepts incoming requests to validate
-// jwt token from metadata header "authorization"
+// jwt token from metadata header "authorization", and attaches the
+// identity of the caller, which grants the criticality of its calls
 func authUnaryIntercept(
 	ctx context.Context,
 	req interface{},
 	info *grpc.UnaryServerInfo,
 	handler grpc.UnaryHandler,
 ) (resp interface{}, err error) {
-	if err := auth(ctx); err != nil {
+	// health checks are made by probes without credentials
+	if util.IsHealthMethod(info.FullMethod) {
+		return handler(ctx, req)
+	}
+	ctx, err = auth(ctx)
+	if err != nil {
 		return nil, err
 	}
 	log.Println("authorization OK")
@@ -172,17 +187,23 @@ func streamAuthIntercept(
 	info *grpc.StreamServerInfo,
 	handler grpc.StreamHandler,
 ) error {
-	if err := auth(stream.Context()); err != nil {
+	if util.IsHealthMethod(info.FullMethod) {
+		return handler(server, stream)
+	}
+	ctx, err := auth(stream.Context())
+	if err != nil {
 		return err
 	}
 	log.Println("authorization OK")
-	return handler(server, stream)
+	return handler(server, util.WrapServerStream(stream, ctx))
 }
 
-func auth(ctx context.Context) error {
+// auth validates the jwt token, or the api key, and returns a
+// context that carries the identity of the caller.
+func auth(ctx context.Context) (context.Context, error) {
 	meta, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
-		return status.Errorf(
+		return nil, status.Errorf(
 			codes.InvalidArgument,
 			"missing context",
 		)
@@ -190,91 +211,211 @@ func auth(ctx context.Context) error {
 
 	authString, ok := meta["authorization"]
 	if !ok {
-		return status.Errorf(
+		// api keys are used by callers that cannot login
+		if key, ok := meta["x-api-key"]; ok {
+			id, err := apiKeys.Verify(key[0])
+			if err != nil {
+				return nil, status.Error(codes.Unauthenticated, err.Error())
+			}
+			return util.NewIdentityContext(ctx, id), nil
+		}
+		return nil, status.Errorf(
 			codes.Unauthenticated,
 			"missing authorization",
 		)
 	}
 	// validate token algo
 	log.Println("found jwt token")
-	jwtToken, err := jwt.Parse(
-		authString[0],
-		func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("bad signing method")
-			}
-			// additional validation goes here.
-			return []byte("a1b2c3d"), nil
-		},
-	)
+	jwtToken, err := jwt.Parse(authString[0], jwtKey)
+
+	// malformed tokens are returned as nil
+	if err != nil || !jwtToken.Valid {
+		return nil, status.Error(codes.Unauthenticated, "bad token")
+	}
+	if revoked.Revoked(jwtToken) {
+		return nil, status.Error(codes.Unauthenticated, "token revoked")
+	}
+	id, err := util.IdentityFromJwt(jwtToken)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return util.NewIdentityContext(ctx, id), nil
+}
+
+// jwtKey validates the signing method of a token
+// and returns the key verifying its signature
+func jwtKey(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, fmt.Errorf("bad signing method")
+	}
+	// additional validation goes here.
+	return jwtSecret, nil
+}
 
-	if jwtToken.Valid {
-		return nil
+// tokenSubject returns the subject of a valid token,
+// which identifies the caller to the rate limiter
+func tokenSubject(tokenString string) (string, error) {
+	jwtToken, err := jwt.Parse(tokenString, jwtKey)
+	if err != nil {
+		return "", err
+	}
+	claims, ok := jwtToken.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", fmt.Errorf("unexpected claims type")
 	}
+	sub, _ := claims["sub"].(string)
+	return sub, nil
+}
+
+// apiKeySubject returns the subject of a valid api key,
+// which identifies the caller to the rate limiter
+func apiKeySubject(key string) (string, error) {
+	id, err := apiKeys.Verify(key)
 	if err != nil {
-		return status.Error(codes.Internal, err.Error())
+		return "", err
 	}
-	return status.Error(codes.Internal, "bad token")
+	return id.Subject, nil
 }
 
-// InTap handler to apply rate limiting.
-// In this example, the limit is applied globally
-// for all requests.  The code can be updated for
-// a per context limiter.
+// InTap handler to reject early the callers of this example that
+// retry before the delay they were told to wait. The limits are
+// applied by the rate limit interceptors, whose rejections carry
+// the RetryInfo and QuotaFailure details that a tap cannot send.
 func rateLimitTap(
 	ctx context.Context,
 	tapInfo *tap.Info,
 ) (context.Context, error) {
-	log.Printf(
-		"applying rate limit: limit=%v;burst=%v",
-		rateLimit.Limit(), rateLimit.Burst(),
-	)
-
-	if !rateLimit.Allow() {
-		log.Println("rate limit rached")
-		return nil, status.Error(
-			codes.ResourceExhausted,
-			"rate limit reached, try later",
-		)
+	ctx, err := limiter.TapHandle(ctx, tapInfo)
+	if err != nil {
+		log.Println("caller retried early", tapInfo.FullMethodName)
+		return nil, err
 	}
-
 	return ctx, nil
 }
 
 func main() {
-	ds := util.NewDataStore(dataFile)
-	if err := ds.Load(); err != nil {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	jwtSecret = []byte(cfg.Auth.Secret)
+
+	ds := util.NewDataStore(cfg.Currency.DataFile)
+	if err := ds.OpenLog(cfg.Currency.WALFile); err != nil {
+		log.Fatal(err)
+	}
+	metrics.RegisterDataStore(ds)
+
+	// certificates are reloaded when renewed on disk
+	certs, err := util.NewCertReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile, "")
+	if err != nil {
 		log.Fatal(err)
 	}
+	go certs.Watch(cfg.TLS.CertReload, nil)
+	tlsCreds := certs.ServerCreds(false)
 
-	tlsCreds, err := credentials.NewServerTLSFromFile(srvCertFile, srvKeyFile)
+	// follow the auth service's token revocation feed
+	authCreds, err := credentials.NewClientTLSFromFile(cfg.TLS.CAFile, "")
+	if err != nil {
+		log.Fatal(err)
+	}
+	authConn, err := grpc.Dial(cfg.Currency.AuthAddr, grpc.WithTransportCredentials(authCreds))
 	if err != nil {
 		log.Fatal(err)
 	}
+	go revoked.Follow(pb.NewAuthClient(authConn), nil)
+
+	// api keys are reloaded when changed by the auth service
+	apiKeys, err = util.NewApiKeyStore(cfg.Currency.APIKeyFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go apiKeys.Watch(5*time.Second, nil)
+
+	// the limits are shared with the other servers through the
+	// quota service, when set, and are local to the server otherwise.
+	// The server presents its client certificate to the quota service.
+	var remote *ratelimit.Remote
+	if cfg.Currency.QuotaAddr != "" {
+		quotaCerts, err := util.NewCertReloader(cfg.Currency.QuotaCertFile, cfg.Currency.QuotaKeyFile, cfg.TLS.CAFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		go quotaCerts.Watch(cfg.TLS.CertReload, nil)
+		quotaConn, err := grpc.Dial(cfg.Currency.QuotaAddr, grpc.WithTransportCredentials(quotaCerts.ClientCreds("")))
+		if err != nil {
+			log.Fatal(err)
+		}
+		remote = ratelimit.NewRemote(pb.NewQuotaServiceClient(quotaConn), cfg.Currency.QuotaBatch)
+	}
+	methods := make(map[string]ratelimit.Quota)
+	for method, quota := range cfg.Currency.MethodRateLimits {
+		methods[method] = ratelimit.Quota{Rate: quota.Rate, Burst: quota.Burst}
+	}
+	limiter = ratelimit.NewLimiter(ratelimit.Options{
+		Quota:   ratelimit.Quota{Rate: cfg.Currency.RateLimit, Burst: cfg.Currency.RateBurst},
+		Methods: methods,
+		Key: ratelimit.FirstKey(
+			ratelimit.TokenKey(tokenSubject),
+			ratelimit.APIKeyKey(apiKeySubject),
+			ratelimit.PeerKey,
+		),
+		MaxKeys: cfg.Currency.RateLimitKeys,
+		Remote:  remote,
+	})
+
+	// interceptors run in the order they are added (see util.ServerChain)
+	logOpts := logging.Options{}
+	chain := util.NewServerChain().
+		Add(util.RecoveryUnaryIntercept(), util.RecoveryStreamIntercept()).
+		Add(logging.UnaryServerIntercept(logOpts), logging.StreamServerIntercept(logOpts)).
+		Add(metrics.UnaryServerIntercept(), metrics.StreamServerIntercept()).
+		Add(authUnaryIntercept, streamAuthIntercept).
+		Add(limiter.UnaryServerIntercept(), limiter.StreamServerIntercept())
 
 	// setup and register currency service
 	curService := newCurrencyService(ds)
 	grpcServer := grpc.NewServer(
 		grpc.Creds(tlsCreds),
-		grpc.UnaryInterceptor(authUnaryIntercept),
-		grpc.StreamInterceptor(streamAuthIntercept),
-		grpc.MaxConcurrentStreams(16),  // limit concurrent stream of rpcs
-		grpc.MaxRecvMsgSize(500*1024),  // set max rcvd to 500k
-		grpc.MaxSendMsgSize(1024*1024), // set max send to 1mb
-		grpc.InTapHandle(rateLimitTap), // install rate limit taphandler
+		grpc.UnaryInterceptor(chain.UnaryInterceptor()),
+		grpc.StreamInterceptor(chain.StreamInterceptor()),
+		grpc.MaxConcurrentStreams(cfg.Currency.MaxConcurrentStreams), // limit concurrent stream of rpcs
+		grpc.MaxRecvMsgSize(cfg.Currency.MaxRecvMsgSize),             // max size of received messages
+		grpc.MaxSendMsgSize(cfg.Currency.MaxSendMsgSize),             // max size of sent messages
+		grpc.InTapHandle(rateLimitTap),                               // reject early retries
 	)
 	pb.RegisterCurrencyServiceServer(grpcServer, curService)
 
-	lstnr, err := net.Listen("tcp", port)
+	// the service reports SERVING once its data is loaded
+	hs := util.RegisterHealth(grpcServer, ds, util.CurrencyServiceName)
+	// the write-ahead log is flushed once the pending calls are done
+	stopped := util.StopOnSignal(grpcServer, hs, cfg.Currency.Drain, ds.Close)
+
+	// let tools (i.e. curctl list, grpcurl) discover the services
+	reflection.Register(grpcServer)
+
+	// load the data in the background, then reload it when modified
+	go func() {
+		if err := ds.Load(); err != nil {
+			log.Fatal(err)
+		}
+		ds.Watch(cfg.Currency.DataReload, nil)
+	}()
+
+	lstnr, err := net.Listen("tcp", cfg.Currency.Addr)
 	if err != nil {
 		log.Fatal("failed to start server:", err)
 	}
-	// setup a listener with maximum 500 concurrent connections
-	limitedLis := netutil.LimitListener(lstnr, 500)
+	// setup a listener with a maximum of concurrent connections
+	limitedLis := netutil.LimitListener(lstnr, cfg.Currency.MaxConnections)
+
+	// expose metrics on a local /metrics endpoint
+	metrics.Serve(cfg.Currency.MetricsAddr)
 
 	// start service's server
-	log.Println("starting secure currency rpc service on", port)
+	log.Println("starting secure currency rpc service on", cfg.Currency.Addr)
 	if err := grpcServer.Serve(limitedLis); err != nil {
 		log.Fatal(err)
 	}
+	<-stopped
 }
@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"net"
 	"time"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/net/context"
 
 	"google.golang.org/grpc/codes"
@@ -14,29 +16,26 @@ import (
 
 	pb "github.com/vladimirvivien/go-grpc/protobuf"
 	"github.com/vladimirvivien/go-grpc/util"
+	"github.com/vladimirvivien/go-grpc/util/breaker"
+	"github.com/vladimirvivien/go-grpc/util/config"
+	"github.com/vladimirvivien/go-grpc/util/logging"
+	"github.com/vladimirvivien/go-grpc/util/metrics"
+	"github.com/vladimirvivien/go-grpc/util/retry"
+	"github.com/vladimirvivien/go-grpc/util/tracing"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/status"
 )
 
-const (
-	server     = "127.0.0.1"
-	serverPort = "50051"
-	authServer = server
-	authPort   = "50052"
-	certFile   = "./../certs/ca.pem"
-	retryMax   = 5
-)
-
 var (
 	token string
 )
 
 // call auth service to get token
-func login(client pb.AuthClient) (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5000*time.Millisecond)
+func login(ctx context.Context, client pb.AuthClient, uname, pwd string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5000*time.Millisecond)
 	defer cancel()
-	user := &pb.AuthRequest{Uname: "vector", Pwd: "abc123"}
+	user := &pb.AuthRequest{Uname: uname, Pwd: pwd}
 	authResp, err := client.Login(ctx, user)
 	if err != nil {
 		return "", err
@@ -45,8 +44,8 @@ func login(client pb.AuthClient) (string, error) {
 }
 
 // printUSD demonstrates simple binary call from client
-func printUSD(client pb.CurrencyServiceClient) {
-	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+func printUSD(ctx context.Context, client pb.CurrencyServiceClient) {
+	ctx, cancel := context.WithTimeout(ctx, 300*time.Millisecond)
 	defer cancel()
 
 	curReq := &pb.CurrencyRequest{Code: "USD"}
@@ -64,8 +63,8 @@ func printUSD(client pb.CurrencyServiceClient) {
 }
 
 // printEUR demonstrates server stream call from client
-func printEUR(client pb.CurrencyServiceClient) {
-	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+func printEUR(ctx context.Context, client pb.CurrencyServiceClient) {
+	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
 	defer cancel()
 
 	curReq := &pb.CurrencyRequest{Code: "EUR"}
@@ -103,8 +102,8 @@ func printEUR(client pb.CurrencyServiceClient) {
 }
 
 // addCurrencies demonstrates client to server stream
-func addCurrencies(client pb.CurrencyServiceClient) {
-	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+func addCurrencies(ctx context.Context, client pb.CurrencyServiceClient) {
+	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
 	defer cancel()
 
 	currencies := []*pb.Currency{
@@ -154,8 +153,8 @@ func addCurrencies(client pb.CurrencyServiceClient) {
 
 // findCurrencies demonstrates bi-directional stream: one direction streams
 // requests to the server while receiving replies from the server.
-func findCurrencies(client pb.CurrencyServiceClient) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+func findCurrencies(ctx context.Context, client pb.CurrencyServiceClient) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
 	defer cancel()
 
 	reqs := []*pb.CurrencyRequest{
@@ -209,74 +208,78 @@ func findCurrencies(client pb.CurrencyServiceClient) {
 	}
 }
 
-// This is a simple retry strategy using intercept.
-// It uses a simplistic retry/backoff as an example.
-// It attempts to filter out errors that should not
-// be retried.  Others are blindly retried.
-func unaryRetryIntercept(
-	ctx context.Context,
-	method string,
-	req, reply interface{},
-	conn *grpc.ClientConn,
-	invoker grpc.UnaryInvoker,
-	opts ...grpc.CallOption,
-) (err error) {
-	delay := time.Millisecond * 300
-	bkoff := time.Millisecond * 200
-	deadline := delay + bkoff
-	for try := 0; try < retryMax; try++ {
-		err = invoker(ctx, method, req, reply, conn, opts...)
-		if err == nil {
-			return
+// retryOptions returns the retry policies of the client configuration
+func retryOptions(cfg config.Client) (retry.Options, error) {
+	policy, err := retryPolicy(cfg.RetryPolicy())
+	if err != nil {
+		return retry.Options{}, err
+	}
+	opts := retry.Options{
+		Policy:       policy,
+		Methods:      make(map[string]retry.Policy),
+		StreamBuffer: cfg.RetryStreamBuffer,
+		Budget:       retry.NewBudget(cfg.RetryBudget, cfg.RetryBudgetBurst),
+	}
+	for method, p := range cfg.RetryMethods {
+		if opts.Methods[method], err = retryPolicy(p); err != nil {
+			return retry.Options{}, err
 		}
+	}
+	return opts, nil
+}
 
-		stat, _ := status.FromError(err)
-		log.Printf("Try:%d, stat code: %d", try, stat.Code())
-		switch stat.Code() {
-		// do not retry on the followings,
-		// these should use failfast
-		case codes.Canceled,
-			codes.DeadlineExceeded,
-			codes.InvalidArgument,
-			codes.Internal,
-			codes.PermissionDenied,
-			codes.Unauthenticated,
-			codes.Unimplemented,
-			codes.Unknown:
-			return
-		// any other errors, sleep then
-		// retry with increasing backoff
-		default:
-			// delay a bit and check cancellation
-			log.Println("Delay for ", deadline)
-			select {
-			case <-time.After(deadline):
-				bkoff = bkoff + time.Millisecond*150
-				deadline = deadline + bkoff
-				continue
-			case <-ctx.Done(): // check for cancellation
-				log.Println("Cancel detected")
-				return
-			}
-		}
+func retryPolicy(p config.RetryPolicy) (retry.Policy, error) {
+	retryCodes, err := p.RetryableCodes()
+	if err != nil {
+		return retry.Policy{}, err
 	}
-	return
+	return retry.Policy{
+		MaxAttempts:       p.MaxAttempts,
+		InitialBackoff:    p.InitialBackoff,
+		MaxBackoff:        p.MaxBackoff,
+		BackoffMultiplier: p.BackoffMultiplier,
+		RetryableCodes:    retryCodes,
+		PerTryTimeout:     p.PerTryTimeout,
+	}, nil
 }
 
 func main() {
-	authAddr := net.JoinHostPort(authServer, authPort)
-	serverAddr := net.JoinHostPort(server, serverPort)
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	retryOpts, err := retryOptions(cfg.Client)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	shutdownTracing, err := tracing.Init("currency-client", cfg.Client.Trace)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer shutdownTracing(context.Background())
+
+	// the calls below are recorded as children of a single
+	// span so that they show up as one end-to-end trace
+	ctx, span := otel.Tracer("client_retry").Start(context.Background(), "client_retry")
+	defer span.End()
 
 	// setup tls creds
-	tlsCreds, err := credentials.NewClientTLSFromFile(certFile, "")
+	tlsCreds, err := credentials.NewClientTLSFromFile(cfg.TLS.CAFile, "")
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	// each attempt of a retried call gets its own span
+	authChain := util.NewClientChain().
+		Add(retry.UnaryClientIntercept(retryOpts), nil).
+		Add(tracing.UnaryClientIntercept(), tracing.StreamClientIntercept())
+
 	authConn, err := grpc.Dial(
-		authAddr,
+		cfg.Client.AuthAddr,
 		grpc.WithTransportCredentials(tlsCreds),
-		grpc.WithUnaryInterceptor(unaryRetryIntercept),
+		grpc.WithUnaryInterceptor(authChain.UnaryInterceptor()),
+		grpc.WithStreamInterceptor(authChain.StreamInterceptor()),
 	)
 	if err != nil {
 		log.Fatal(err)
@@ -284,19 +287,81 @@ func main() {
 	authClient := pb.NewAuthClient(authConn)
 
 	// get token from auth service
-	token, err = login(authClient)
+	token, err = login(ctx, authClient, cfg.Client.User, cfg.Client.Password)
 	if err != nil {
 		log.Fatal(err)
 	}
 	// create a jwt credential with token
 	jwtCreds := util.NewJwtCreds(token)
 
+	// expose client metrics on a local /metrics endpoint
+	metrics.Serve(cfg.Client.MetricsAddr)
+
+	// hedged copies of the lookups are sent to the replicas
+	// of the server, they go through the chain of the call
+	var replicas []*grpc.ClientConn
+	for _, addr := range config.List(cfg.Client.ReplicaAddrs) {
+		replica, err := grpc.Dial(
+			addr,
+			grpc.WithTransportCredentials(tlsCreds),
+			grpc.WithPerRPCCredentials(jwtCreds),
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+		replicas = append(replicas, replica)
+	}
+	hedgeCodes, err := config.Codes(cfg.Client.HedgeCodes)
+	if err != nil {
+		log.Fatal(err)
+	}
+	hedger := retry.NewHedger(retry.HedgeOptions{
+		Methods:     config.List(cfg.Client.HedgeMethods),
+		Delay:       cfg.Client.HedgeDelay,
+		MaxAttempts: cfg.Client.HedgeMax,
+		Budget:      cfg.Client.HedgeBudget,
+		Codes:       hedgeCodes,
+		Replicas:    replicas,
+	})
+
+	// the calls of a method fail fast while the server keeps failing them
+	breakerCodes, err := config.Codes(cfg.Client.BreakerCodes)
+	if err != nil {
+		log.Fatal(err)
+	}
+	circuits := breaker.NewBreaker(breaker.Options{
+		Failures:      cfg.Client.BreakerFailures,
+		OpenTimeout:   cfg.Client.BreakerOpenTimeout,
+		HalfOpenCalls: cfg.Client.BreakerHalfOpenCalls,
+		Codes:         breakerCodes,
+	})
+	// the transitions of the circuits show up in the trace of the run
+	circuits.OnChange(func(t breaker.Transition) {
+		span.AddEvent("circuit "+t.To.String(), trace.WithAttributes(
+			attribute.String("rpc.method", t.Method),
+			attribute.String("circuit.from", t.From.String()),
+		))
+	})
+
+	// interceptors run in the order they are added (see util.ClientChain),
+	// each hedged copy of a call goes through the circuit of its replica
+	// and is retried on its own
+	logOpts := logging.Options{}
+	chain := util.NewClientChain().
+		Add(logging.UnaryClientIntercept(logOpts), logging.StreamClientIntercept(logOpts)).
+		Add(metrics.UnaryClientIntercept(), metrics.StreamClientIntercept()).
+		Add(hedger.UnaryClientIntercept(), nil).
+		Add(circuits.UnaryClientIntercept(), circuits.StreamClientIntercept()).
+		Add(retry.UnaryClientIntercept(retryOpts), retry.StreamClientIntercept(retryOpts)).
+		Add(tracing.UnaryClientIntercept(), tracing.StreamClientIntercept())
+
 	// setup insecure connection
 	conn, err := grpc.Dial(
-		serverAddr,
+		cfg.Client.ServerAddr,
 		grpc.WithTransportCredentials(tlsCreds),
 		grpc.WithPerRPCCredentials(jwtCreds),
-		grpc.WithUnaryInterceptor(unaryRetryIntercept),
+		grpc.WithUnaryInterceptor(chain.UnaryInterceptor()),
+		grpc.WithStreamInterceptor(chain.StreamInterceptor()),
 		grpc.WithBackoffConfig(
 			grpc.BackoffConfig{MaxDelay: time.Second * 7},
 		),
@@ -308,11 +373,11 @@ func main() {
 
 	client := pb.NewCurrencyServiceClient(conn)
 
-	printUSD(client)
+	printUSD(ctx, client)
 
-	//printEUR(client)
+	//printEUR(ctx, client)
 
-	//addCurrencies(client)
+	//addCurrencies(ctx, client)
 
-	//findCurrencies(client)
+	//findCurrencies(ctx, client)
 }
@@ -13,17 +13,23 @@ import (
 
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
 
 	jwt "github.com/dgrijalva/jwt-go"
 	pb "github.com/vladimirvivien/go-grpc/protobuf"
 	"github.com/vladimirvivien/go-grpc/util"
+	"github.com/vladimirvivien/go-grpc/util/config"
+	"github.com/vladimirvivien/go-grpc/util/logging"
+	"github.com/vladimirvivien/go-grpc/util/metrics"
+	"github.com/vladimirvivien/go-grpc/util/tracing"
 )
 
-const (
-	port        = ":50051"
-	dataFile    = "./../curdata.csv"
-	srvCertFile = "./../certs/server.crt"
-	srvKeyFile  = "./../certs/server.key"
+var (
+	// secret verifying the tokens signed by the auth service
+	jwtSecret []byte
+
+	// tokens revoked by the auth service
+	revoked = util.NewRevocationList()
 )
 
 // CurrencyService implements the pb CurrencyServiceServer interface
@@ -47,7 +53,7 @@ func (c *CurrencyService) GetCurrencyList(
 			"must provide currency number or code",
 		)
 	}
-	items := c.ds.Search(req.GetCode(), req.GetNumber())
+	items := c.ds.Search(ctx, req.GetCode(), req.GetNumber())
 	return &pb.CurrencyList{Items: items}, nil
 }
 
@@ -64,7 +70,15 @@ func (c *CurrencyService) GetCurrencyStream(
 		)
 	}
 
-	items := c.ds.Search(req.GetCode(), req.GetNumber())
+	// a stream re-established by the client resumes
+	// after the last item the client received
+	items, err := util.ResumeAfter(
+		c.ds.Search(stream.Context(), req.GetCode(), req.GetNumber()),
+		req.GetResumeToken(),
+	)
+	if err != nil {
+		return err
+	}
 
 	for _, cur := range items {
 		if err := stream.Send(cur); err != nil {
@@ -87,7 +101,9 @@ func (c *CurrencyService) SaveCurrencyStream(
 		if err != nil {
 			// if done, close sream and return result
 			if err == io.EOF {
-				c.ds.Add(curList.Items)
+				if err := c.ds.Add(curList.Items); err != nil {
+					return status.Errorf(codes.Internal, "failed to save currencies: %v", err)
+				}
 				return stream.SendAndClose(curList)
 			}
 			return err
@@ -132,7 +148,7 @@ func (c *CurrencyService) FindCurrencyStream(
 			)
 		}
 
-		items := c.ds.Search(req.GetCode(), req.GetNumber())
+		items := c.ds.Search(stream.Context(), req.GetCode(), req.GetNumber())
 		for _, cur := range items {
 			if err := stream.Send(cur); err != nil {
 				return err
@@ -149,6 +165,10 @@ func authUnaryIntercept(
 	info *grpc.UnaryServerInfo,
 	handler grpc.UnaryHandler,
 ) (resp interface{}, err error) {
+	// health checks are made by probes without credentials
+	if util.IsHealthMethod(info.FullMethod) {
+		return handler(ctx, req)
+	}
 	if err := auth(ctx); err != nil {
 		return nil, err
 	}
@@ -163,6 +183,9 @@ func streamAuthIntercept(
 	info *grpc.StreamServerInfo,
 	handler grpc.StreamHandler,
 ) error {
+	if util.IsHealthMethod(info.FullMethod) {
+		return handler(server, stream)
+	}
 	if err := auth(stream.Context()); err != nil {
 		return err
 	}
@@ -195,47 +218,104 @@ func auth(ctx context.Context) error {
 				return nil, fmt.Errorf("bad signing method")
 			}
 			// additional validation goes here.
-			return []byte("a1b2c3d"), nil
+			return jwtSecret, nil
 		},
 	)
 
-	if jwtToken.Valid {
-		return nil
+	// malformed tokens are returned as nil
+	if err != nil || !jwtToken.Valid {
+		return status.Error(codes.Unauthenticated, "bad token")
 	}
-	if err != nil {
-		return status.Error(codes.Internal, err.Error())
+	if revoked.Revoked(jwtToken) {
+		return status.Error(codes.Unauthenticated, "token revoked")
 	}
-	return status.Error(codes.Internal, "bad token")
+	return nil
 }
 
 func main() {
-	ds := util.NewDataStore(dataFile)
-	if err := ds.Load(); err != nil {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	jwtSecret = []byte(cfg.Auth.Secret)
+
+	shutdownTracing, err := tracing.Init("currency", cfg.Currency.Trace)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer shutdownTracing(context.Background())
+
+	ds := util.NewDataStore(cfg.Currency.DataFile)
+	if err := ds.OpenLog(cfg.Currency.WALFile); err != nil {
 		log.Fatal(err)
 	}
+	metrics.RegisterDataStore(ds)
 
-	lstnr, err := net.Listen("tcp", port)
+	lstnr, err := net.Listen("tcp", cfg.Currency.Addr)
 	if err != nil {
 		log.Fatal("failed to start server:", err)
 	}
 
-	tlsCreds, err := credentials.NewServerTLSFromFile(srvCertFile, srvKeyFile)
+	// certificates are reloaded when renewed on disk
+	certs, err := util.NewCertReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile, "")
 	if err != nil {
 		log.Fatal(err)
 	}
+	go certs.Watch(cfg.TLS.CertReload, nil)
+	tlsCreds := certs.ServerCreds(false)
+
+	// follow the auth service's token revocation feed
+	authCreds, err := credentials.NewClientTLSFromFile(cfg.TLS.CAFile, "")
+	if err != nil {
+		log.Fatal(err)
+	}
+	authConn, err := grpc.Dial(cfg.Currency.AuthAddr, grpc.WithTransportCredentials(authCreds))
+	if err != nil {
+		log.Fatal(err)
+	}
+	go revoked.Follow(pb.NewAuthClient(authConn), nil)
+
+	// interceptors run in the order they are added (see util.ServerChain)
+	logOpts := logging.Options{}
+	chain := util.NewServerChain().
+		Add(util.RecoveryUnaryIntercept(), util.RecoveryStreamIntercept()).
+		Add(tracing.UnaryServerIntercept(), tracing.StreamServerIntercept()).
+		Add(logging.UnaryServerIntercept(logOpts), logging.StreamServerIntercept(logOpts)).
+		Add(metrics.UnaryServerIntercept(), metrics.StreamServerIntercept()).
+		Add(authUnaryIntercept, streamAuthIntercept)
 
 	// setup and register currency service
 	curService := newCurrencyService(ds)
 	grpcServer := grpc.NewServer(
 		grpc.Creds(tlsCreds),
-		grpc.UnaryInterceptor(authUnaryIntercept),
-		grpc.StreamInterceptor(streamAuthIntercept),
+		grpc.UnaryInterceptor(chain.UnaryInterceptor()),
+		grpc.StreamInterceptor(chain.StreamInterceptor()),
 	)
 	pb.RegisterCurrencyServiceServer(grpcServer, curService)
 
+	// the service reports SERVING once its data is loaded
+	hs := util.RegisterHealth(grpcServer, ds, util.CurrencyServiceName)
+	// the write-ahead log is flushed once the pending calls are done
+	stopped := util.StopOnSignal(grpcServer, hs, cfg.Currency.Drain, ds.Close)
+
+	// let tools (i.e. curctl list, grpcurl) discover the services
+	reflection.Register(grpcServer)
+
+	// load the data in the background, then reload it when modified
+	go func() {
+		if err := ds.Load(); err != nil {
+			log.Fatal(err)
+		}
+		ds.Watch(cfg.Currency.DataReload, nil)
+	}()
+
+	// expose metrics on a local /metrics endpoint
+	metrics.Serve(cfg.Currency.MetricsAddr)
+
 	// start service's server
-	log.Println("starting secure currency rpc service on", port)
+	log.Println("starting secure currency rpc service on", cfg.Currency.Addr)
 	if err := grpcServer.Serve(lstnr); err != nil {
 		log.Fatal(err)
 	}
+	<-stopped
 }
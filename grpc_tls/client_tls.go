@@ -2,15 +2,17 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net"
+	"time"
 
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/credentials"
 
 	pb "github.com/vladimirvivien/go-grpc/protobuf"
+	"github.com/vladimirvivien/go-grpc/util"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/status"
@@ -20,6 +22,9 @@ const (
 	server     = "127.0.0.1"
 	serverPort = "50051"
 	certFile   = "./../certs/ca.pem"
+	clientCert = "./../certs/client.crt"
+	clientKey  = "./../certs/client.key"
+	certReload = 10 * time.Second
 )
 
 // printUSD demonstrates simple binary call from client
@@ -173,14 +178,27 @@ func findCurrencies(client pb.CurrencyServiceClient) {
 }
 
 func main() {
+	mtls := flag.Bool("mtls", false, "present client certificate to the server")
+	flag.Parse()
+
 	serverAddr := net.JoinHostPort(server, serverPort)
 
 	// setup tls creds
 	// tlsCreds := credentials.NewClientTLSFromCert(nil, "")
-	tlsCreds, err := credentials.NewClientTLSFromFile(certFile, "")
+	// tlsCreds, err := credentials.NewClientTLSFromFile(certFile, "")
+
+	// Here, the CA (and client cert for mutual TLS) are watched
+	// and reloaded when renewed, without a restart.
+	cert, key := "", ""
+	if *mtls {
+		cert, key = clientCert, clientKey
+	}
+	certs, err := util.NewCertReloader(cert, key, certFile)
 	if err != nil {
 		log.Fatal(err)
 	}
+	go certs.Watch(certReload, nil)
+	tlsCreds := certs.ClientCreds("")
 
 	// setup insecure connection
 	conn, err := grpc.Dial(serverAddr, grpc.WithTransportCredentials(tlsCreds))
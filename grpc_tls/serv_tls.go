@@ -1,27 +1,24 @@
 package main
 
 import (
+	"flag"
 	"io"
 	"log"
 	"net"
 	"sync"
 
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/status"
 
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
 
 	pb "github.com/vladimirvivien/go-grpc/protobuf"
 	"github.com/vladimirvivien/go-grpc/util"
-)
-
-const (
-	port        = ":50051"
-	dataFile    = "./../curdata.csv"
-	srvCertFile = "./../certs/server.crt"
-	srvKeyFile  = "./../certs/server.key"
+	"github.com/vladimirvivien/go-grpc/util/config"
+	"github.com/vladimirvivien/go-grpc/util/logging"
+	"github.com/vladimirvivien/go-grpc/util/metrics"
 )
 
 // CurrencyService implements the pb CurrencyServiceServer interface
@@ -154,14 +151,19 @@ func (c *CurrencyService) FindCurrencyStream(
 }
 
 func main() {
+	mtls := flag.Bool("mtls", false, "require client certificates signed by the CA")
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// load data into protobuf structures
-	data, err := util.LoadPbFromCsv(dataFile)
+	data, err := util.LoadPbFromCsv(cfg.Currency.DataFile)
 	if err != nil {
 		log.Fatal(err) // dont start
 	}
 
-	lstnr, err := net.Listen("tcp", port)
+	lstnr, err := net.Listen("tcp", cfg.Currency.Addr)
 	if err != nil {
 		log.Fatal("failed to start server:", err)
 	}
@@ -172,19 +174,53 @@ func main() {
 
 	// Or, server tls credentials can be constructed from TLS
 	// key and cert files as follows:
-	tlsCreds, err := credentials.NewServerTLSFromFile(srvCertFile, srvKeyFile)
+	// tlsCreds, err := credentials.NewServerTLSFromFile(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+
+	// Here, the key and cert files (and the CA for mutual TLS)
+	// are watched and reloaded when renewed, without a restart.
+	ca := ""
+	if *mtls {
+		// mutual TLS: clients must present a certificate
+		// signed by the CA to establish a connection
+		ca = cfg.TLS.CAFile
+	}
+	certs, err := util.NewCertReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile, ca)
 	if err != nil {
 		log.Fatal(err)
 	}
+	go certs.Watch(cfg.TLS.CertReload, nil)
+	tlsCreds := certs.ServerCreds(*mtls)
+
+	// interceptors run in the order they are added (see util.ServerChain)
+	logOpts := logging.Options{}
+	chain := util.NewServerChain().
+		Add(util.RecoveryUnaryIntercept(), util.RecoveryStreamIntercept()).
+		Add(logging.UnaryServerIntercept(logOpts), logging.StreamServerIntercept(logOpts)).
+		Add(metrics.UnaryServerIntercept(), metrics.StreamServerIntercept())
 
 	// setup and register currency service
 	curService := newCurrencyService(data)
-	grpcServer := grpc.NewServer(grpc.Creds(tlsCreds))
+	grpcServer := grpc.NewServer(
+		grpc.Creds(tlsCreds),
+		grpc.UnaryInterceptor(chain.UnaryInterceptor()),
+		grpc.StreamInterceptor(chain.StreamInterceptor()),
+	)
 	pb.RegisterCurrencyServiceServer(grpcServer, curService)
 
+	// the data is loaded, the service is reported SERVING right away
+	hs := util.RegisterHealth(grpcServer, nil, util.CurrencyServiceName)
+	stopped := util.StopOnSignal(grpcServer, hs, cfg.Currency.Drain)
+
+	// let tools (i.e. curctl list, grpcurl) discover the services
+	reflection.Register(grpcServer)
+
+	// expose metrics on a local /metrics endpoint
+	metrics.Serve(cfg.Currency.MetricsAddr)
+
 	// start service's server
-	log.Println("starting secure currency rpc service on", port)
+	log.Println("starting secure currency rpc service on", cfg.Currency.Addr)
 	if err := grpcServer.Serve(lstnr); err != nil {
 		log.Fatal(err)
 	}
+	<-stopped
 }
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/vladimirvivien/go-grpc/util"
+)
+
+// healthcheck probes the standard health service of a server and
+// exits with status 0 when the service is SERVING, or 1 otherwise
+// (including when the server cannot be reached), so that it can be
+// used as the readiness or liveness probe of an orchestrator.
+func main() {
+	addr := flag.String("addr", "127.0.0.1:50051", "address of the server")
+	service := flag.String("service", "", `service to check, i.e. protobuf.CurrencyService ("" for the whole server)`)
+	caFile := flag.String("ca", "./../certs/ca.pem", "CA certificate used to verify the server")
+	certFile := flag.String("cert", "", "client certificate presented to servers requiring one (i.e. the quota service)")
+	keyFile := flag.String("key", "", "key of the client certificate")
+	insecure := flag.Bool("insecure", false, "connect without TLS (i.e. the grpc example server)")
+	timeout := flag.Duration("timeout", 3*time.Second, "timeout of the check, connection included")
+	flag.Parse()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	opts := []grpc.DialOption{grpc.WithBlock()}
+	switch {
+	case *insecure:
+		opts = append(opts, grpc.WithInsecure())
+	case *certFile != "":
+		tlsCreds, err := util.NewClientMTLSCreds(*certFile, *keyFile, *caFile, "")
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, grpc.WithTransportCredentials(tlsCreds))
+	default:
+		tlsCreds, err := credentials.NewClientTLSFromFile(*caFile, "")
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, grpc.WithTransportCredentials(tlsCreds))
+	}
+	conn, err := grpc.DialContext(ctx, *addr, opts...)
+	if err != nil {
+		fail("failed to connect to %s: %v", *addr, err)
+	}
+	defer conn.Close()
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: *service})
+	if err != nil {
+		fail("health check failed: %v", err)
+	}
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		fail("service %q is %s", *service, resp.GetStatus())
+	}
+	fmt.Printf("service %q is %s\n", *service, resp.GetStatus())
+}
+
+// fail prints the reason of the failed check and exits with status 1
+func fail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
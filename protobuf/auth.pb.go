@@ -7,13 +7,25 @@ Package protobuf is a generated protocol buffer package.
 It is generated from these files:
 	auth.proto
 	currency.proto
+	quota.proto
 
 It has these top-level messages:
 	AuthRequest
 	AuthResponse
+	ApiKey
+	CreateApiKeyRequest
+	CreateApiKeyResponse
+	ListApiKeysRequest
+	ApiKeyList
+	RevokeApiKeyRequest
+	RevokeTokenRequest
+	Revocation
+	WatchRevocationsRequest
 	Currency
 	CurrencyList
 	CurrencyRequest
+	QuotaRequest
+	QuotaGrant
 */
 package protobuf
 
@@ -77,9 +89,217 @@ func (m *AuthResponse) GetToken() string {
 	return ""
 }
 
+// ApiKey describes an API key without its secret
+type ApiKey struct {
+	Id      string   `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Name    string   `protobuf:"bytes,2,opt,name=name" json:"name,omitempty"`
+	Scopes  []string `protobuf:"bytes,3,rep,name=scopes" json:"scopes,omitempty"`
+	Created int64    `protobuf:"varint,4,opt,name=created" json:"created,omitempty"`
+	Revoked bool     `protobuf:"varint,5,opt,name=revoked" json:"revoked,omitempty"`
+}
+
+func (m *ApiKey) Reset()                    { *m = ApiKey{} }
+func (m *ApiKey) String() string            { return proto.CompactTextString(m) }
+func (*ApiKey) ProtoMessage()               {}
+func (*ApiKey) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
+func (m *ApiKey) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *ApiKey) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *ApiKey) GetScopes() []string {
+	if m != nil {
+		return m.Scopes
+	}
+	return nil
+}
+
+func (m *ApiKey) GetCreated() int64 {
+	if m != nil {
+		return m.Created
+	}
+	return 0
+}
+
+func (m *ApiKey) GetRevoked() bool {
+	if m != nil {
+		return m.Revoked
+	}
+	return false
+}
+
+// CreateApiKeyRequest names the key and the scopes granted to it
+type CreateApiKeyRequest struct {
+	Name   string   `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	Scopes []string `protobuf:"bytes,2,rep,name=scopes" json:"scopes,omitempty"`
+}
+
+func (m *CreateApiKeyRequest) Reset()                    { *m = CreateApiKeyRequest{} }
+func (m *CreateApiKeyRequest) String() string            { return proto.CompactTextString(m) }
+func (*CreateApiKeyRequest) ProtoMessage()               {}
+func (*CreateApiKeyRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+
+func (m *CreateApiKeyRequest) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *CreateApiKeyRequest) GetScopes() []string {
+	if m != nil {
+		return m.Scopes
+	}
+	return nil
+}
+
+// CreateApiKeyResponse carries the key, which is only returned once
+type CreateApiKeyResponse struct {
+	Key  string  `protobuf:"bytes,1,opt,name=key" json:"key,omitempty"`
+	Info *ApiKey `protobuf:"bytes,2,opt,name=info" json:"info,omitempty"`
+}
+
+func (m *CreateApiKeyResponse) Reset()                    { *m = CreateApiKeyResponse{} }
+func (m *CreateApiKeyResponse) String() string            { return proto.CompactTextString(m) }
+func (*CreateApiKeyResponse) ProtoMessage()               {}
+func (*CreateApiKeyResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+
+func (m *CreateApiKeyResponse) GetKey() string {
+	if m != nil {
+		return m.Key
+	}
+	return ""
+}
+
+func (m *CreateApiKeyResponse) GetInfo() *ApiKey {
+	if m != nil {
+		return m.Info
+	}
+	return nil
+}
+
+type ListApiKeysRequest struct {
+}
+
+func (m *ListApiKeysRequest) Reset()                    { *m = ListApiKeysRequest{} }
+func (m *ListApiKeysRequest) String() string            { return proto.CompactTextString(m) }
+func (*ListApiKeysRequest) ProtoMessage()               {}
+func (*ListApiKeysRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+
+type ApiKeyList struct {
+	Items []*ApiKey `protobuf:"bytes,1,rep,name=items" json:"items,omitempty"`
+}
+
+func (m *ApiKeyList) Reset()                    { *m = ApiKeyList{} }
+func (m *ApiKeyList) String() string            { return proto.CompactTextString(m) }
+func (*ApiKeyList) ProtoMessage()               {}
+func (*ApiKeyList) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+
+func (m *ApiKeyList) GetItems() []*ApiKey {
+	if m != nil {
+		return m.Items
+	}
+	return nil
+}
+
+type RevokeApiKeyRequest struct {
+	Id string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+}
+
+func (m *RevokeApiKeyRequest) Reset()                    { *m = RevokeApiKeyRequest{} }
+func (m *RevokeApiKeyRequest) String() string            { return proto.CompactTextString(m) }
+func (*RevokeApiKeyRequest) ProtoMessage()               {}
+func (*RevokeApiKeyRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+
+func (m *RevokeApiKeyRequest) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+// RevokeTokenRequest identifies the JWT token to revoke,
+// either by the token itself or by its jti claim
+type RevokeTokenRequest struct {
+	Token string `protobuf:"bytes,1,opt,name=token" json:"token,omitempty"`
+	Jti   string `protobuf:"bytes,2,opt,name=jti" json:"jti,omitempty"`
+}
+
+func (m *RevokeTokenRequest) Reset()                    { *m = RevokeTokenRequest{} }
+func (m *RevokeTokenRequest) String() string            { return proto.CompactTextString(m) }
+func (*RevokeTokenRequest) ProtoMessage()               {}
+func (*RevokeTokenRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
+
+func (m *RevokeTokenRequest) GetToken() string {
+	if m != nil {
+		return m.Token
+	}
+	return ""
+}
+
+func (m *RevokeTokenRequest) GetJti() string {
+	if m != nil {
+		return m.Jti
+	}
+	return ""
+}
+
+// Revocation is an entry of the token revocation list,
+// it can be dropped once the token expires
+type Revocation struct {
+	Jti     string `protobuf:"bytes,1,opt,name=jti" json:"jti,omitempty"`
+	Expires int64  `protobuf:"varint,2,opt,name=expires" json:"expires,omitempty"`
+}
+
+func (m *Revocation) Reset()                    { *m = Revocation{} }
+func (m *Revocation) String() string            { return proto.CompactTextString(m) }
+func (*Revocation) ProtoMessage()               {}
+func (*Revocation) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
+
+func (m *Revocation) GetJti() string {
+	if m != nil {
+		return m.Jti
+	}
+	return ""
+}
+
+func (m *Revocation) GetExpires() int64 {
+	if m != nil {
+		return m.Expires
+	}
+	return 0
+}
+
+type WatchRevocationsRequest struct {
+}
+
+func (m *WatchRevocationsRequest) Reset()                    { *m = WatchRevocationsRequest{} }
+func (m *WatchRevocationsRequest) String() string            { return proto.CompactTextString(m) }
+func (*WatchRevocationsRequest) ProtoMessage()               {}
+func (*WatchRevocationsRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{10} }
+
 func init() {
 	proto.RegisterType((*AuthRequest)(nil), "protobuf.AuthRequest")
 	proto.RegisterType((*AuthResponse)(nil), "protobuf.AuthResponse")
+	proto.RegisterType((*ApiKey)(nil), "protobuf.ApiKey")
+	proto.RegisterType((*CreateApiKeyRequest)(nil), "protobuf.CreateApiKeyRequest")
+	proto.RegisterType((*CreateApiKeyResponse)(nil), "protobuf.CreateApiKeyResponse")
+	proto.RegisterType((*ListApiKeysRequest)(nil), "protobuf.ListApiKeysRequest")
+	proto.RegisterType((*ApiKeyList)(nil), "protobuf.ApiKeyList")
+	proto.RegisterType((*RevokeApiKeyRequest)(nil), "protobuf.RevokeApiKeyRequest")
+	proto.RegisterType((*RevokeTokenRequest)(nil), "protobuf.RevokeTokenRequest")
+	proto.RegisterType((*Revocation)(nil), "protobuf.Revocation")
+	proto.RegisterType((*WatchRevocationsRequest)(nil), "protobuf.WatchRevocationsRequest")
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -94,6 +314,17 @@ const _ = grpc.SupportPackageIsVersion4
 
 type AuthClient interface {
 	Login(ctx context.Context, in *AuthRequest, opts ...grpc.CallOption) (*AuthResponse, error)
+	// CreateApiKey creates a hashed, scoped API key (admin only)
+	CreateApiKey(ctx context.Context, in *CreateApiKeyRequest, opts ...grpc.CallOption) (*CreateApiKeyResponse, error)
+	// ListApiKeys lists the API keys (admin only)
+	ListApiKeys(ctx context.Context, in *ListApiKeysRequest, opts ...grpc.CallOption) (*ApiKeyList, error)
+	// RevokeApiKey revokes an API key by id (admin only)
+	RevokeApiKey(ctx context.Context, in *RevokeApiKeyRequest, opts ...grpc.CallOption) (*ApiKey, error)
+	// RevokeToken adds a JWT token to the revocation list (admin only)
+	RevokeToken(ctx context.Context, in *RevokeTokenRequest, opts ...grpc.CallOption) (*Revocation, error)
+	// WatchRevocations streams the revocation list followed by
+	// new revocations as they occur
+	WatchRevocations(ctx context.Context, in *WatchRevocationsRequest, opts ...grpc.CallOption) (Auth_WatchRevocationsClient, error)
 }
 
 type authClient struct {
@@ -113,10 +344,89 @@ func (c *authClient) Login(ctx context.Context, in *AuthRequest, opts ...grpc.Ca
 	return out, nil
 }
 
+func (c *authClient) CreateApiKey(ctx context.Context, in *CreateApiKeyRequest, opts ...grpc.CallOption) (*CreateApiKeyResponse, error) {
+	out := new(CreateApiKeyResponse)
+	err := grpc.Invoke(ctx, "/protobuf.Auth/CreateApiKey", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authClient) ListApiKeys(ctx context.Context, in *ListApiKeysRequest, opts ...grpc.CallOption) (*ApiKeyList, error) {
+	out := new(ApiKeyList)
+	err := grpc.Invoke(ctx, "/protobuf.Auth/ListApiKeys", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authClient) RevokeApiKey(ctx context.Context, in *RevokeApiKeyRequest, opts ...grpc.CallOption) (*ApiKey, error) {
+	out := new(ApiKey)
+	err := grpc.Invoke(ctx, "/protobuf.Auth/RevokeApiKey", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authClient) RevokeToken(ctx context.Context, in *RevokeTokenRequest, opts ...grpc.CallOption) (*Revocation, error) {
+	out := new(Revocation)
+	err := grpc.Invoke(ctx, "/protobuf.Auth/RevokeToken", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authClient) WatchRevocations(ctx context.Context, in *WatchRevocationsRequest, opts ...grpc.CallOption) (Auth_WatchRevocationsClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Auth_serviceDesc.Streams[0], c.cc, "/protobuf.Auth/WatchRevocations", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &authWatchRevocationsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Auth_WatchRevocationsClient interface {
+	Recv() (*Revocation, error)
+	grpc.ClientStream
+}
+
+type authWatchRevocationsClient struct {
+	grpc.ClientStream
+}
+
+func (x *authWatchRevocationsClient) Recv() (*Revocation, error) {
+	m := new(Revocation)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // Server API for Auth service
 
 type AuthServer interface {
 	Login(context.Context, *AuthRequest) (*AuthResponse, error)
+	// CreateApiKey creates a hashed, scoped API key (admin only)
+	CreateApiKey(context.Context, *CreateApiKeyRequest) (*CreateApiKeyResponse, error)
+	// ListApiKeys lists the API keys (admin only)
+	ListApiKeys(context.Context, *ListApiKeysRequest) (*ApiKeyList, error)
+	// RevokeApiKey revokes an API key by id (admin only)
+	RevokeApiKey(context.Context, *RevokeApiKeyRequest) (*ApiKey, error)
+	// RevokeToken adds a JWT token to the revocation list (admin only)
+	RevokeToken(context.Context, *RevokeTokenRequest) (*Revocation, error)
+	// WatchRevocations streams the revocation list followed by
+	// new revocations as they occur
+	WatchRevocations(*WatchRevocationsRequest, Auth_WatchRevocationsServer) error
 }
 
 func RegisterAuthServer(s *grpc.Server, srv AuthServer) {
@@ -141,6 +451,99 @@ func _Auth_Login_Handler(srv interface{}, ctx context.Context, dec func(interfac
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Auth_CreateApiKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateApiKeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthServer).CreateApiKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.Auth/CreateApiKey",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServer).CreateApiKey(ctx, req.(*CreateApiKeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Auth_ListApiKeys_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListApiKeysRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthServer).ListApiKeys(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.Auth/ListApiKeys",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServer).ListApiKeys(ctx, req.(*ListApiKeysRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Auth_RevokeApiKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RevokeApiKeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthServer).RevokeApiKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.Auth/RevokeApiKey",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServer).RevokeApiKey(ctx, req.(*RevokeApiKeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Auth_RevokeToken_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RevokeTokenRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthServer).RevokeToken(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protobuf.Auth/RevokeToken",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServer).RevokeToken(ctx, req.(*RevokeTokenRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Auth_WatchRevocations_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRevocationsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AuthServer).WatchRevocations(m, &authWatchRevocationsServer{stream})
+}
+
+type Auth_WatchRevocationsServer interface {
+	Send(*Revocation) error
+	grpc.ServerStream
+}
+
+type authWatchRevocationsServer struct {
+	grpc.ServerStream
+}
+
+func (x *authWatchRevocationsServer) Send(m *Revocation) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 var _Auth_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "protobuf.Auth",
 	HandlerType: (*AuthServer)(nil),
@@ -149,23 +552,64 @@ var _Auth_serviceDesc = grpc.ServiceDesc{
 			MethodName: "Login",
 			Handler:    _Auth_Login_Handler,
 		},
+		{
+			MethodName: "CreateApiKey",
+			Handler:    _Auth_CreateApiKey_Handler,
+		},
+		{
+			MethodName: "ListApiKeys",
+			Handler:    _Auth_ListApiKeys_Handler,
+		},
+		{
+			MethodName: "RevokeApiKey",
+			Handler:    _Auth_RevokeApiKey_Handler,
+		},
+		{
+			MethodName: "RevokeToken",
+			Handler:    _Auth_RevokeToken_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchRevocations",
+			Handler:       _Auth_WatchRevocations_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "auth.proto",
 }
 
 func init() { proto.RegisterFile("auth.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 147 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0xe2, 0x4a, 0x2c, 0x2d, 0xc9,
-	0xd0, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0xe2, 0x00, 0x53, 0x49, 0xa5, 0x69, 0x4a, 0xa6, 0x5c,
-	0xdc, 0x8e, 0xa5, 0x25, 0x19, 0x41, 0xa9, 0x85, 0xa5, 0xa9, 0xc5, 0x25, 0x42, 0x22, 0x5c, 0xac,
-	0xa5, 0x79, 0x89, 0xb9, 0xa9, 0x12, 0x8c, 0x0a, 0x8c, 0x1a, 0x9c, 0x41, 0x10, 0x8e, 0x90, 0x00,
-	0x17, 0x73, 0x41, 0x79, 0x8a, 0x04, 0x13, 0x58, 0x0c, 0xc4, 0x54, 0x52, 0xe1, 0xe2, 0x81, 0x68,
-	0x2b, 0x2e, 0xc8, 0xcf, 0x2b, 0x4e, 0x05, 0xe9, 0x2b, 0xc9, 0xcf, 0x4e, 0xcd, 0x83, 0xe9, 0x03,
-	0x73, 0x8c, 0x1c, 0xb8, 0x58, 0x40, 0xaa, 0x84, 0x2c, 0xb8, 0x58, 0x7d, 0xf2, 0xd3, 0x33, 0xf3,
-	0x84, 0x44, 0xf5, 0x60, 0x16, 0xeb, 0x21, 0xd9, 0x2a, 0x25, 0x86, 0x2e, 0x0c, 0x31, 0x55, 0x89,
-	0x21, 0x89, 0x0d, 0x2c, 0x61, 0x0c, 0x08, 0x00, 0x00, 0xff, 0xff, 0xb1, 0x05, 0x4b, 0x23, 0xbd,
-	0x00, 0x00, 0x00,
+	// 462 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x74, 0x92, 0xcf, 0x6f, 0xd3, 0x30,
+	0x14, 0xc7, 0xe7, 0xa6, 0x2d, 0xdb, 0x6b, 0x85, 0xaa, 0xb7, 0x30, 0x42, 0x04, 0x28, 0x58, 0x03,
+	0xf5, 0x54, 0xa1, 0x01, 0xd2, 0x0e, 0x5c, 0xaa, 0x1d, 0x99, 0x40, 0x8a, 0x90, 0x38, 0x67, 0x8d,
+	0x47, 0xbd, 0x6a, 0x71, 0xa8, 0x1d, 0xd8, 0xfe, 0x2a, 0xfe, 0xc5, 0xc9, 0x76, 0xdc, 0xb8, 0x49,
+	0x7a, 0x8a, 0x9f, 0xbf, 0xef, 0x87, 0xdf, 0xf7, 0x13, 0x80, 0xac, 0x52, 0xeb, 0x45, 0xb9, 0x15,
+	0x4a, 0xe0, 0xb1, 0xf9, 0xdc, 0x54, 0xb7, 0xf4, 0x0b, 0x4c, 0x96, 0x95, 0x5a, 0xa7, 0xec, 0x4f,
+	0xc5, 0xa4, 0xc2, 0x10, 0x46, 0x55, 0x91, 0xdd, 0xb3, 0x88, 0x24, 0x64, 0x7e, 0x92, 0xda, 0x00,
+	0x67, 0x10, 0x94, 0xff, 0xf2, 0x68, 0x60, 0xee, 0xf4, 0x91, 0x9e, 0xc3, 0xd4, 0x96, 0xc9, 0x52,
+	0x14, 0x92, 0xe9, 0x3a, 0x25, 0x36, 0xac, 0x70, 0x75, 0x26, 0xa0, 0x0f, 0x30, 0x5e, 0x96, 0xfc,
+	0x1b, 0x7b, 0xc4, 0xe7, 0x30, 0xe0, 0x79, 0x2d, 0x0e, 0x78, 0x8e, 0x08, 0x43, 0x33, 0xc6, 0xb6,
+	0x34, 0x67, 0x3c, 0x83, 0xb1, 0x5c, 0x89, 0x92, 0xc9, 0x28, 0x48, 0x82, 0xf9, 0x49, 0x5a, 0x47,
+	0x18, 0xc1, 0xb3, 0xd5, 0x96, 0x65, 0x8a, 0xe5, 0xd1, 0x30, 0x21, 0xf3, 0x20, 0x75, 0xa1, 0x56,
+	0xb6, 0xec, 0xaf, 0xd8, 0xb0, 0x3c, 0x1a, 0x25, 0x64, 0x7e, 0x9c, 0xba, 0x90, 0x2e, 0xe1, 0xf4,
+	0xca, 0x24, 0xd9, 0xf9, 0x6e, 0x3d, 0x37, 0x96, 0xf4, 0x8e, 0x1d, 0xf8, 0x63, 0xe9, 0x77, 0x08,
+	0xf7, 0x5b, 0xd4, 0xab, 0xce, 0x20, 0xd8, 0xb0, 0xc7, 0xba, 0x85, 0x3e, 0xe2, 0x39, 0x0c, 0x79,
+	0x71, 0x2b, 0xcc, 0x32, 0x93, 0x8b, 0xd9, 0xc2, 0x99, 0xbb, 0xa8, 0x2b, 0x8d, 0x4a, 0x43, 0xc0,
+	0x6b, 0x2e, 0x95, 0xbd, 0x93, 0xf5, 0x8b, 0xe8, 0x67, 0x00, 0x7b, 0xa3, 0x35, 0xfc, 0x00, 0x23,
+	0xae, 0xd8, 0xbd, 0x8c, 0x48, 0x12, 0xf4, 0xb6, 0xb2, 0x32, 0x7d, 0x0f, 0xa7, 0xa9, 0xd9, 0x74,
+	0x7f, 0xbd, 0x96, 0xcb, 0xf4, 0x2b, 0xa0, 0x4d, 0xfb, 0xa9, 0x71, 0x78, 0x8c, 0xbb, 0xac, 0xf4,
+	0x5a, 0x77, 0x8a, 0x3b, 0xc6, 0x77, 0x8a, 0xd3, 0x4b, 0x00, 0x5d, 0xbd, 0xca, 0x14, 0x17, 0x3b,
+	0x9d, 0xec, 0x74, 0xed, 0x3e, 0x7b, 0x28, 0xf9, 0xd6, 0x38, 0x67, 0xb8, 0xd4, 0x21, 0x7d, 0x05,
+	0x2f, 0x7f, 0x65, 0x6a, 0xb5, 0x6e, 0xca, 0xdd, 0xbe, 0x17, 0xff, 0x03, 0x18, 0xea, 0x3f, 0x07,
+	0x2f, 0x61, 0x74, 0x2d, 0x7e, 0xf3, 0x02, 0x5f, 0x78, 0x4b, 0x36, 0x7f, 0x62, 0x7c, 0xd6, 0xbe,
+	0xb6, 0xf6, 0xd3, 0x23, 0xfc, 0x01, 0x53, 0x1f, 0x0c, 0xbe, 0x69, 0x32, 0x7b, 0x98, 0xc7, 0x6f,
+	0x0f, 0xc9, 0xbb, 0x86, 0x57, 0x30, 0xf1, 0xc8, 0xe0, 0xeb, 0xa6, 0xa0, 0x0b, 0x2c, 0x0e, 0xdb,
+	0x4c, 0x74, 0x0e, 0x3d, 0xc2, 0x25, 0x4c, 0x7d, 0x24, 0xfe, 0xab, 0x7a, 0x50, 0xc5, 0x1d, 0xb4,
+	0xf6, 0x1d, 0x1e, 0x2e, 0xff, 0x1d, 0x5d, 0x8a, 0x71, 0xb8, 0xaf, 0x5a, 0x9b, 0x8d, 0x3b, 0xb3,
+	0xb6, 0xf7, 0xf8, 0xae, 0xc9, 0x3d, 0xc0, 0xe5, 0x50, 0xbb, 0x8f, 0xe4, 0x66, 0x6c, 0x84, 0x4f,
+	0x4f, 0x01, 0x00, 0x00, 0xff, 0xff, 0xd9, 0xda, 0xc4, 0x2e, 0x40, 0x04, 0x00, 0x00,
 }
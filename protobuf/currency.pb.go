@@ -79,6 +79,9 @@ func (m *CurrencyList) GetItems() []*Currency {
 type CurrencyRequest struct {
 	Code   string `protobuf:"bytes,1,opt,name=code" json:"code,omitempty"`
 	Number int32  `protobuf:"varint,2,opt,name=number" json:"number,omitempty"`
+	// resume_token resumes a GetCurrencyStream broken by a failure
+	// after the last Currency received (see ResumeToken)
+	ResumeToken string `protobuf:"bytes,3,opt,name=resume_token,json=resumeToken" json:"resume_token,omitempty"`
 }
 
 func (m *CurrencyRequest) Reset()                    { *m = CurrencyRequest{} }
@@ -100,6 +103,13 @@ func (m *CurrencyRequest) GetNumber() int32 {
 	return 0
 }
 
+func (m *CurrencyRequest) GetResumeToken() string {
+	if m != nil {
+		return m.ResumeToken
+	}
+	return ""
+}
+
 func init() {
 	proto.RegisterType((*Currency)(nil), "protobuf.Currency")
 	proto.RegisterType((*CurrencyList)(nil), "protobuf.CurrencyList")
@@ -394,22 +404,23 @@ var _CurrencyService_serviceDesc = grpc.ServiceDesc{
 func init() { proto.RegisterFile("currency.proto", fileDescriptor1) }
 
 var fileDescriptor1 = []byte{
-	// 262 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x8f, 0xbf, 0x4e, 0xc3, 0x30,
-	0x10, 0xc6, 0xeb, 0xf4, 0x0f, 0xe5, 0x40, 0x54, 0xdc, 0x50, 0x19, 0xa6, 0xc8, 0x93, 0xa7, 0xa8,
-	0x2a, 0x0b, 0x0b, 0x13, 0x28, 0x08, 0x89, 0x29, 0x79, 0x82, 0xc4, 0x39, 0xa4, 0x0c, 0x71, 0xc0,
-	0xb1, 0x2b, 0xf5, 0xb5, 0x78, 0x42, 0x94, 0xa4, 0xa1, 0x01, 0x0c, 0x0b, 0x93, 0xef, 0xee, 0xfb,
-	0xee, 0xbb, 0x9f, 0xe1, 0x42, 0x39, 0x63, 0x48, 0xab, 0x7d, 0xf4, 0x6a, 0x6a, 0x5b, 0xe3, 0xb2,
-	0x7b, 0x72, 0xf7, 0x22, 0x0a, 0x58, 0xde, 0x1f, 0x34, 0x44, 0x98, 0xa9, 0xba, 0x20, 0xce, 0x42,
-	0x26, 0x4f, 0x93, 0xae, 0x6e, 0x67, 0x3a, 0xab, 0x88, 0x07, 0xfd, 0xac, 0xad, 0x71, 0x0d, 0x0b,
-	0xed, 0xaa, 0x9c, 0x0c, 0x9f, 0x86, 0x4c, 0xce, 0x93, 0x43, 0x87, 0x1c, 0x4e, 0x54, 0xed, 0xb4,
-	0x35, 0x7b, 0x3e, 0xeb, 0xec, 0x43, 0x2b, 0x6e, 0xe1, 0x7c, 0xb8, 0xf2, 0x5c, 0x36, 0x16, 0x25,
-	0xcc, 0x4b, 0x4b, 0x55, 0xc3, 0x59, 0x38, 0x95, 0x67, 0x5b, 0x8c, 0x06, 0x9e, 0x68, 0xb0, 0x25,
-	0xbd, 0x41, 0xdc, 0xc1, 0xea, 0x73, 0x44, 0x6f, 0x8e, 0x1a, 0xeb, 0xc5, 0x3c, 0x22, 0x05, 0x63,
-	0xa4, 0xed, 0x7b, 0x70, 0xdc, 0x4f, 0xc9, 0xec, 0x4a, 0x45, 0x18, 0xc3, 0xea, 0x91, 0xec, 0x17,
-	0x9e, 0x2b, 0x0f, 0x40, 0x7f, 0xed, 0x7a, 0xfd, 0x53, 0x6a, 0x57, 0xc4, 0x04, 0x63, 0xb8, 0x1c,
-	0xe5, 0xa4, 0xd6, 0x50, 0x56, 0xfd, 0x95, 0xe4, 0xf9, 0xa5, 0x98, 0x6c, 0x18, 0x3e, 0x00, 0xa6,
-	0xd9, 0x8e, 0xbe, 0x05, 0x79, 0xdc, 0xbf, 0xb3, 0x48, 0x86, 0x4f, 0x80, 0x71, 0xa9, 0x8b, 0x7f,
-	0xe2, 0x48, 0xb6, 0x61, 0xf9, 0xa2, 0x13, 0x6e, 0x3e, 0x02, 0x00, 0x00, 0xff, 0xff, 0x06, 0x92,
-	0x71, 0xef, 0x36, 0x02, 0x00, 0x00,
+	// 283 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x90, 0x3d, 0x4f, 0xf3, 0x30,
+	0x14, 0x85, 0xeb, 0xf4, 0xe3, 0x6d, 0x6f, 0xab, 0xb7, 0xe2, 0x0e, 0x95, 0x61, 0x0a, 0x99, 0x3c,
+	0x45, 0x55, 0x59, 0xd8, 0x41, 0x41, 0x48, 0x4c, 0x09, 0x3b, 0xe4, 0xe3, 0x22, 0x45, 0x28, 0x36,
+	0x38, 0x76, 0xa5, 0xfe, 0x2d, 0x7e, 0x21, 0x8a, 0xd3, 0x50, 0x0a, 0x81, 0x85, 0x29, 0xf7, 0x9e,
+	0x73, 0x72, 0xee, 0x23, 0xc3, 0xff, 0xdc, 0x6a, 0x4d, 0x32, 0xdf, 0x85, 0x2f, 0x5a, 0x19, 0x85,
+	0x53, 0xf7, 0xc9, 0xec, 0x53, 0x50, 0xc0, 0xf4, 0x6a, 0xef, 0x21, 0xc2, 0x28, 0x57, 0x05, 0x71,
+	0xe6, 0x33, 0x31, 0x8b, 0xdd, 0xdc, 0x68, 0x32, 0xad, 0x88, 0x7b, 0xad, 0xd6, 0xcc, 0xb8, 0x82,
+	0x89, 0xb4, 0x55, 0x46, 0x9a, 0x0f, 0x7d, 0x26, 0xc6, 0xf1, 0x7e, 0x43, 0x0e, 0xff, 0x72, 0x65,
+	0xa5, 0xd1, 0x3b, 0x3e, 0x72, 0xf1, 0x6e, 0x0d, 0x2e, 0x61, 0xd1, 0x5d, 0xb9, 0x2b, 0x6b, 0x83,
+	0x02, 0xc6, 0xa5, 0xa1, 0xaa, 0xe6, 0xcc, 0x1f, 0x8a, 0xf9, 0x06, 0xc3, 0x8e, 0x27, 0xec, 0x62,
+	0x71, 0x1b, 0x08, 0x1e, 0x61, 0xf9, 0x21, 0xd1, 0xab, 0xa5, 0xda, 0xf4, 0x62, 0x1e, 0x90, 0xbc,
+	0x23, 0xa4, 0x73, 0x58, 0x68, 0xaa, 0x6d, 0x45, 0x0f, 0x46, 0x3d, 0x93, 0x74, 0xc0, 0xb3, 0x78,
+	0xde, 0x6a, 0xf7, 0x8d, 0xb4, 0x79, 0xf3, 0x0e, 0x27, 0x12, 0xd2, 0xdb, 0x32, 0x27, 0x8c, 0x60,
+	0x79, 0x43, 0xe6, 0x08, 0xf9, 0xb4, 0x87, 0xb1, 0x05, 0x3a, 0x5b, 0x7d, 0xb7, 0x9a, 0x5f, 0x82,
+	0x01, 0x46, 0x70, 0xf2, 0xa9, 0x27, 0x31, 0x9a, 0xd2, 0xea, 0xb7, 0xa6, 0x9e, 0x87, 0x08, 0x06,
+	0x6b, 0x86, 0xd7, 0x80, 0x49, 0xba, 0xa5, 0x2f, 0x45, 0x3d, 0xe9, 0x9f, 0x59, 0x04, 0xc3, 0x5b,
+	0xc0, 0xa8, 0x94, 0xc5, 0x1f, 0x71, 0x04, 0x5b, 0xb3, 0x6c, 0xe2, 0x8c, 0x8b, 0xf7, 0x00, 0x00,
+	0x00, 0xff, 0xff, 0x51, 0x37, 0xd1, 0xc2, 0x59, 0x02, 0x00, 0x00,
 }
@@ -0,0 +1,19 @@
+package protobuf
+
+// ResumeToken returns the token of cur, a Currency of a stream, that
+// resumes the stream after cur (see CurrencyRequest.ResumeToken). The
+// token is opaque to the clients.
+func ResumeToken(cur *Currency) string {
+	return cur.GetCode() + ":" + cur.GetCountry()
+}
+
+// Resume returns a copy of the request of a GetCurrencyStream that
+// resumes the stream after last, the last Currency received. It lets
+// the retry interceptor re-establish the stream (see retry.Resumer).
+func (m *CurrencyRequest) Resume(last interface{}) interface{} {
+	req := *m
+	if cur, ok := last.(*Currency); ok {
+		req.ResumeToken = ResumeToken(cur)
+	}
+	return &req
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"log"
+	"net"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/vladimirvivien/go-grpc/protobuf"
+	"github.com/vladimirvivien/go-grpc/util"
+	"github.com/vladimirvivien/go-grpc/util/config"
+	"github.com/vladimirvivien/go-grpc/util/logging"
+	"github.com/vladimirvivien/go-grpc/util/metrics"
+	"github.com/vladimirvivien/go-grpc/util/ratelimit"
+	"github.com/vladimirvivien/go-grpc/util/tracing"
+)
+
+// maxBatch bounds the tokens granted by a single Acquire
+const maxBatch = 1000
+
+// QuotaService keeps the token buckets shared by the replicas of the
+// currency servers. The servers acquire the tokens of a bucket in
+// batches, leased for a short time so that the tokens left unspent by
+// a server are not held for long. The quotas of the buckets are
+// configured on the service, the callers cannot change them.
+type QuotaService struct {
+	buckets *ratelimit.Limiter
+	lease   time.Duration
+}
+
+func newQuotaService(opts ratelimit.Options, lease time.Duration) *QuotaService {
+	return &QuotaService{
+		buckets: ratelimit.NewLimiter(opts),
+		lease:   lease,
+	}
+}
+
+// Acquire grants up to req.Tokens tokens from the bucket of req.Key.
+// The request is rejected when its quota is not the quota of the
+// bucket, that is when the configurations of the caller and of the
+// service differ. When the bucket is out of tokens, no token is
+// granted and the grant tells when to retry.
+func (s *QuotaService) Acquire(ctx context.Context, req *pb.QuotaRequest) (*pb.QuotaGrant, error) {
+	switch {
+	case req.GetKey() == "":
+		return nil, status.Error(codes.InvalidArgument, "missing key")
+	case req.GetTokens() <= 0 || req.GetTokens() > maxBatch:
+		return nil, status.Errorf(codes.InvalidArgument, "tokens must be between 1 and %d", maxBatch)
+	}
+
+	quota, ok := s.buckets.QuotaOf(req.GetKey())
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown quota of key %s", req.GetKey())
+	}
+	if req.GetRate() != quota.Rate || int(req.GetBurst()) != quota.Burst {
+		return nil, status.Errorf(
+			codes.FailedPrecondition,
+			"quota of key %s is %v calls per second, burst of %d",
+			req.GetKey(), quota.Rate, quota.Burst,
+		)
+	}
+	granted, delay := s.buckets.Grant(req.GetKey(), quota, int(req.GetTokens()))
+	if granted == 0 {
+		return &pb.QuotaGrant{RetryAfterMs: delay.Nanoseconds() / int64(time.Millisecond)}, nil
+	}
+	return &pb.QuotaGrant{
+		Tokens:  int64(granted),
+		LeaseMs: s.lease.Nanoseconds() / int64(time.Millisecond),
+	}, nil
+}
+
+func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	shutdownTracing, err := tracing.Init("quotasvc", cfg.Quota.Trace)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer shutdownTracing(context.Background())
+
+	// the buckets apply the quotas of the currency servers
+	methods := make(map[string]ratelimit.Quota)
+	for method, quota := range cfg.Currency.MethodRateLimits {
+		methods[method] = ratelimit.Quota{Rate: quota.Rate, Burst: quota.Burst}
+	}
+	quotaService := newQuotaService(ratelimit.Options{
+		Quota:   ratelimit.Quota{Rate: cfg.Currency.RateLimit, Burst: cfg.Currency.RateBurst},
+		Methods: methods,
+		MaxKeys: cfg.Quota.MaxKeys,
+	}, cfg.Quota.Lease)
+
+	// only the currency servers, authenticated with their client
+	// certificate, are granted the scope to acquire tokens
+	policy, err := util.LoadPolicy(cfg.Quota.PolicyFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	lstnr, err := net.Listen("tcp", cfg.Quota.Addr)
+	if err != nil {
+		log.Fatal("failed to start server:", err)
+	}
+
+	// certificates are reloaded when renewed on disk, the callers
+	// must present a client certificate signed by the CA (mTLS)
+	certs, err := util.NewCertReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile, cfg.TLS.CAFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go certs.Watch(cfg.TLS.CertReload, nil)
+	tlsCreds := certs.ServerCreds(true)
+
+	// interceptors run in the order they are added (see util.ServerChain)
+	logOpts := logging.Options{}
+	chain := util.NewServerChain().
+		Add(util.RecoveryUnaryIntercept(), util.RecoveryStreamIntercept()).
+		Add(tracing.UnaryServerIntercept(), tracing.StreamServerIntercept()).
+		Add(logging.UnaryServerIntercept(logOpts), logging.StreamServerIntercept(logOpts)).
+		Add(metrics.UnaryServerIntercept(), metrics.StreamServerIntercept()).
+		Add(util.PeerIdentityUnaryIntercept(policy), util.PeerIdentityStreamIntercept(policy)).
+		Add(util.AuthzUnaryIntercept(policy), util.AuthzStreamIntercept(policy))
+
+	quotaServer := grpc.NewServer(
+		grpc.Creds(tlsCreds),
+		grpc.UnaryInterceptor(chain.UnaryInterceptor()),
+		grpc.StreamInterceptor(chain.StreamInterceptor()),
+	)
+	pb.RegisterQuotaServiceServer(quotaServer, quotaService)
+
+	// the service is ready, it is reported SERVING right away
+	hs := util.RegisterHealth(quotaServer, nil, util.QuotaServiceName)
+	stopped := util.StopOnSignal(quotaServer, hs, cfg.Quota.Drain)
+
+	// let tools (i.e. curctl list, grpcurl) discover the services
+	reflection.Register(quotaServer)
+
+	// expose metrics on a local /metrics endpoint
+	metrics.Serve(cfg.Quota.MetricsAddr)
+
+	log.Println("starting quota service on", cfg.Quota.Addr)
+	if err := quotaServer.Serve(lstnr); err != nil {
+		log.Fatal(err)
+	}
+	<-stopped
+}
@@ -0,0 +1,226 @@
+package util
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ApiKeyRecord is the stored form of an API key. Only the
+// SHA-256 hash of the key's secret is kept, never the key.
+type ApiKeyRecord struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Hash    string    `json:"hash"`
+	Scopes  []string  `json:"scopes"`
+	Created time.Time `json:"created"`
+	Revoked bool      `json:"revoked"`
+}
+
+// ApiKeyStore keeps hashed API keys in a JSON file. The auth
+// service manages the keys while resource servers watch the
+// file to verify keys sent with requests.
+type ApiKeyStore struct {
+	mtx     sync.RWMutex
+	file    string
+	keys    map[string]*ApiKeyRecord
+	modTime time.Time
+}
+
+// NewApiKeyStore loads the keys stored in file, if it exists
+func NewApiKeyStore(file string) (*ApiKeyStore, error) {
+	s := &ApiKeyStore{file: file, keys: make(map[string]*ApiKeyRecord)}
+	if err := s.load(); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *ApiKeyStore) load() error {
+	info, err := os.Stat(s.file)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(s.file)
+	if err != nil {
+		return err
+	}
+	var records []*ApiKeyRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return err
+	}
+	keys := make(map[string]*ApiKeyRecord)
+	for _, rec := range records {
+		keys[rec.ID] = rec
+	}
+
+	s.mtx.Lock()
+	s.keys, s.modTime = keys, info.ModTime()
+	s.mtx.Unlock()
+	return nil
+}
+
+// save writes the records to the store file, must be
+// called with the lock held.
+func (s *ApiKeyStore) save() error {
+	records := make([]*ApiKeyRecord, 0, len(s.keys))
+	for _, rec := range s.keys {
+		records = append(records, rec)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Created.Before(records[j].Created)
+	})
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	// write then rename so readers never see a partial file
+	tmp := s.file + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.file)
+}
+
+// Watch reloads the store file every interval when it has
+// been modified. Watch runs until stop is closed.
+func (s *ApiKeyStore) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.refresh()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// refresh reloads the store file if it was modified since last loaded
+func (s *ApiKeyStore) refresh() {
+	info, err := os.Stat(s.file)
+	if err != nil {
+		return
+	}
+	s.mtx.RLock()
+	changed := !info.ModTime().Equal(s.modTime)
+	s.mtx.RUnlock()
+	if changed {
+		if err := s.load(); err != nil {
+			log.Println("api key reload failed:", err)
+		}
+	}
+}
+
+// Create generates a new API key granted scopes. The returned
+// key has the form <id>.<secret> and cannot be recovered later.
+func (s *ApiKeyStore) Create(name string, scopes []string) (string, *ApiKeyRecord, error) {
+	id, err := randomString(8)
+	if err != nil {
+		return "", nil, err
+	}
+	secret, err := randomString(32)
+	if err != nil {
+		return "", nil, err
+	}
+	rec := &ApiKeyRecord{
+		ID:      id,
+		Name:    name,
+		Hash:    hashSecret(secret),
+		Scopes:  scopes,
+		Created: time.Now().UTC(),
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.keys[id] = rec
+	if err := s.save(); err != nil {
+		delete(s.keys, id)
+		return "", nil, err
+	}
+	return id + "." + secret, rec, nil
+}
+
+// Revoke marks the key with id as revoked
+func (s *ApiKeyStore) Revoke(id string) (*ApiKeyRecord, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	rec, ok := s.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("api key %s not found", id)
+	}
+	rec.Revoked = true
+	if err := s.save(); err != nil {
+		rec.Revoked = false
+		return nil, err
+	}
+	return rec, nil
+}
+
+// List returns the stored key records ordered by creation time
+func (s *ApiKeyStore) List() []*ApiKeyRecord {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	records := make([]*ApiKeyRecord, 0, len(s.keys))
+	for _, rec := range s.keys {
+		records = append(records, rec)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Created.Before(records[j].Created)
+	})
+	return records
+}
+
+// Verify validates key and returns the identity it was issued for
+func (s *ApiKeyStore) Verify(key string) (*Identity, error) {
+	parts := strings.SplitN(key, ".", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("malformed api key")
+	}
+	rec, ok := s.lookup(parts[0])
+	if !ok {
+		// the key may have been created since the file was last loaded
+		s.refresh()
+		rec, ok = s.lookup(parts[0])
+	}
+	if !ok || rec.Revoked {
+		return nil, fmt.Errorf("invalid api key")
+	}
+	hash := hashSecret(parts[1])
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(rec.Hash)) != 1 {
+		return nil, fmt.Errorf("invalid api key")
+	}
+	return &Identity{Subject: "apikey:" + rec.ID, Scopes: rec.Scopes}, nil
+}
+
+func (s *ApiKeyStore) lookup(id string) (*ApiKeyRecord, bool) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	rec, ok := s.keys[id]
+	return rec, ok
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,187 @@
+package util
+
+import (
+	"encoding/json"
+	"os"
+
+	"golang.org/x/net/context"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Identity represents the authenticated caller of an RPC.
+// It is attached to the request context once the caller
+// has been authenticated.
+type Identity struct {
+	Subject string
+	Roles   []string
+	Scopes  []string
+}
+
+// HasScope returns true if the identity was granted scope
+func (id *Identity) HasScope(scope string) bool {
+	if id == nil {
+		return false
+	}
+	for _, s := range id.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type identityKey struct{}
+
+// NewIdentityContext returns a copy of ctx that carries id.
+// The identity is also recorded in the slot of ctx, if any.
+func NewIdentityContext(ctx context.Context, id *Identity) context.Context {
+	if slot, ok := ctx.Value(identitySlotKey{}).(*identitySlot); ok {
+		slot.id = id
+	}
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+type identitySlotKey struct{}
+
+type identitySlot struct {
+	id *Identity
+}
+
+// WithIdentitySlot returns a copy of ctx with a slot that records the
+// identity attached further down the interceptor chain. It lets outer
+// interceptors (i.e. logging) report the caller once the handler returns.
+// The returned func reads the recorded identity, nil if none was attached.
+func WithIdentitySlot(ctx context.Context) (context.Context, func() *Identity) {
+	slot := new(identitySlot)
+	return context.WithValue(ctx, identitySlotKey{}, slot), func() *Identity {
+		return slot.id
+	}
+}
+
+// IdentityFromContext returns the Identity stored in ctx, if any
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(*Identity)
+	return id, ok
+}
+
+// Policy maps full RPC method names (i.e. /protobuf.CurrencyService/SaveCurrencyStream)
+// to the scopes a caller must be granted to invoke the method.
+// Methods not listed in the policy only require an authenticated caller.
+// Roles maps the roles of callers authenticated with a client
+// certificate (which carry no token scopes) to their granted scopes.
+type Policy struct {
+	Methods map[string][]string `json:"methods"`
+	Roles   map[string][]string `json:"roles"`
+}
+
+// ScopesFor returns the unique scopes granted to roles by the policy
+func (p *Policy) ScopesFor(roles []string) []string {
+	var scopes []string
+	seen := make(map[string]bool)
+	for _, role := range roles {
+		for _, scope := range p.Roles[role] {
+			if !seen[scope] {
+				seen[scope] = true
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	return scopes
+}
+
+// LoadPolicy reads a JSON-encoded Policy from file path
+func LoadPolicy(path string) (*Policy, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	policy := new(Policy)
+	if err := json.NewDecoder(file).Decode(policy); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// Authorize validates that the identity, stored in ctx, has
+// been granted all scopes required by the policy for method.
+// A PermissionDenied status is returned, with the missing
+// scope attached as an ErrorInfo detail, otherwise.
+func (p *Policy) Authorize(ctx context.Context, method string) error {
+	id, ok := IdentityFromContext(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "missing identity")
+	}
+	for _, scope := range p.Methods[method] {
+		if id.HasScope(scope) {
+			continue
+		}
+		stat := status.Newf(
+			codes.PermissionDenied,
+			"%s requires scope %s", method, scope,
+		)
+		statDetail, err := stat.WithDetails(&errdetails.ErrorInfo{
+			Reason:   "MISSING_SCOPE",
+			Domain:   "authsvc",
+			Metadata: map[string]string{"method": method, "scope": scope},
+		})
+		if err != nil {
+			return stat.Err()
+		}
+		return statDetail.Err()
+	}
+	return nil
+}
+
+// AuthzUnaryIntercept returns a unary server interceptor that enforces
+// the policy. It must be invoked after the caller's identity is
+// attached to the context.
+func AuthzUnaryIntercept(p *Policy) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		if err := p.Authorize(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// AuthzStreamIntercept returns a stream server interceptor that
+// enforces the policy.
+func AuthzStreamIntercept(p *Policy) grpc.StreamServerInterceptor {
+	return func(
+		server interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		if err := p.Authorize(stream.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(server, stream)
+	}
+}
+
+// serverStream wraps a grpc.ServerStream to override
+// the context returned to stream handlers.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// WrapServerStream returns a grpc.ServerStream that reports ctx as its context
+func WrapServerStream(stream grpc.ServerStream, ctx context.Context) grpc.ServerStream {
+	return &serverStream{ServerStream: stream, ctx: ctx}
+}
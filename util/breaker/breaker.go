@@ -0,0 +1,355 @@
+// Package breaker provides a client circuit breaker. The breaker keeps a
+// circuit per target (the server address of the connection) and method:
+//
+//   - closed, the calls go through. Failures open the circuit
+//     after a number of consecutive failed calls.
+//   - open, the calls fail fast with Unavailable, without reaching the
+//     server, until the circuit half-opens after a timeout.
+//   - half-open, a few trial calls go through, the others fail fast.
+//     The circuit closes once the trial calls succeed, and opens again
+//     when one of them fails.
+//
+// The calls fail with the status codes of a server that is down or
+// overloaded (i.e. Unavailable, DeadlineExceeded), other codes tell
+// that the server is up. The calls canceled by the client, or past the
+// deadline of the caller, tell neither. The transitions of the circuits
+// are logged, published to the listeners of the breaker (see
+// Breaker.OnChange) and recorded by the grpc_client_circuit_* metrics.
+package breaker
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"golang.org/x/net/context"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/vladimirvivien/go-grpc/util/metrics"
+	"github.com/vladimirvivien/go-grpc/util/streams"
+)
+
+// State is the state of a circuit
+type State int
+
+// States of a circuit
+const (
+	Closed State = iota
+	HalfOpen
+	Open
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case HalfOpen:
+		return "half-open"
+	case Open:
+		return "open"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
+// Options configures a Breaker
+type Options struct {
+	// Failures is the number of consecutive failed
+	// calls that opens a closed circuit
+	Failures int
+
+	// OpenTimeout is the time a circuit stays open before it half-opens
+	OpenTimeout time.Duration
+
+	// HalfOpenCalls is the number of trial calls let through by a
+	// half-open circuit, which closes once they all succeeded
+	HalfOpenCalls int
+
+	// Codes are the status codes of the failed calls
+	Codes []codes.Code
+}
+
+// Transition is a change of the state of the circuit of a method
+type Transition struct {
+	Target string
+	Method string
+	From   State
+	To     State
+	At     time.Time
+}
+
+// Breaker keeps a circuit per target and method
+type Breaker struct {
+	opts Options
+
+	mtx      sync.Mutex
+	circuits map[string]*circuit
+	onChange []func(Transition)
+}
+
+type circuit struct {
+	target     string
+	method     string
+	state      State
+	generation int // transitions of the circuit
+	failures   int // consecutive failed calls, while closed
+	openedAt   time.Time
+	trials     int // trial calls in flight, while half-open
+	successes  int // successful trial calls, while half-open
+}
+
+// pass is a call let through by a circuit, in a generation of the circuit
+type pass struct {
+	circuit    *circuit
+	generation int
+	trial      bool
+}
+
+// NewBreaker returns a breaker applying opts
+func NewBreaker(opts Options) *Breaker {
+	return &Breaker{opts: opts, circuits: make(map[string]*circuit)}
+}
+
+// OnChange registers fn to be called with the transitions of the
+// circuits, in the goroutine of the call that caused the transition
+func (b *Breaker) OnChange(fn func(Transition)) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.onChange = append(b.onChange, fn)
+}
+
+// State returns the state of the circuit of method on target
+func (b *Breaker) State(target, method string) State {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if c, ok := b.circuits[target+"|"+method]; ok {
+		return c.state
+	}
+	return Closed
+}
+
+// circuit returns the circuit of method on target, created
+// closed if it does not exist. It is called with mtx held.
+func (b *Breaker) circuit(target, method string) *circuit {
+	key := target + "|" + method
+	c, ok := b.circuits[key]
+	if !ok {
+		c = &circuit{target: target, method: method}
+		b.circuits[key] = c
+		metrics.CircuitChanged(target, method, "", Closed.String())
+	}
+	return c
+}
+
+// set moves c to state to, and returns the transition.
+// It is called with mtx held.
+func (c *circuit) set(to State, now time.Time) Transition {
+	t := Transition{Target: c.target, Method: c.method, From: c.state, To: to, At: now}
+	c.state = to
+	c.generation++
+	c.failures, c.trials, c.successes = 0, 0, 0
+	if to == Open {
+		c.openedAt = now
+	}
+	return t
+}
+
+// allow returns the pass of a call to method on target if the call may
+// go through. It returns an Unavailable status when the call fails fast.
+func (b *Breaker) allow(target, method string) (pass, error) {
+	b.mtx.Lock()
+	c := b.circuit(target, method)
+	now := time.Now()
+	var changes []Transition
+	if c.state == Open {
+		wait := c.openedAt.Add(b.opts.OpenTimeout).Sub(now)
+		if wait > 0 {
+			b.mtx.Unlock()
+			metrics.CircuitRejected(target, method)
+			return pass{}, openError(method, wait)
+		}
+		changes = append(changes, c.set(HalfOpen, now))
+	}
+	trial := c.state == HalfOpen
+	if trial {
+		if c.trials >= b.opts.HalfOpenCalls {
+			b.mtx.Unlock()
+			metrics.CircuitRejected(target, method)
+			return pass{}, openError(method, 0)
+		}
+		c.trials++
+	}
+	p := pass{circuit: c, generation: c.generation, trial: trial}
+	b.mtx.Unlock()
+	b.notify(changes)
+	return p, nil
+}
+
+// done records the outcome of a call let through by p
+func (b *Breaker) done(p pass, err error) {
+	failed := b.failed(err)
+	b.mtx.Lock()
+	c := p.circuit
+	if p.generation != c.generation {
+		// the calls let through before the last
+		// transition of the circuit do not count
+		b.mtx.Unlock()
+		return
+	}
+	now := time.Now()
+	var changes []Transition
+	switch {
+	case p.trial:
+		c.trials--
+		if failed {
+			changes = append(changes, c.set(Open, now))
+			break
+		}
+		c.successes++
+		if c.successes >= b.opts.HalfOpenCalls {
+			changes = append(changes, c.set(Closed, now))
+		}
+	case c.state == Closed:
+		if !failed {
+			c.failures = 0
+			break
+		}
+		c.failures++
+		if c.failures >= b.opts.Failures {
+			changes = append(changes, c.set(Open, now))
+		}
+	}
+	b.mtx.Unlock()
+	b.notify(changes)
+}
+
+// finish records the outcome of a call made with ctx, let through by p.
+// The calls canceled by the client, or past the deadline of ctx, tell
+// nothing about the server: they end without an outcome.
+func (b *Breaker) finish(ctx context.Context, p pass, err error) {
+	code := status.Code(err)
+	if code == codes.Canceled || code == codes.DeadlineExceeded && ctx.Err() != nil {
+		b.release(p)
+		return
+	}
+	b.done(p, err)
+}
+
+// release frees the slot of the trial call let through by p, which
+// ended without an outcome (i.e. a stream canceled before it received)
+func (b *Breaker) release(p pass) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if p.trial && p.generation == p.circuit.generation {
+		p.circuit.trials--
+	}
+}
+
+// failed returns true if err is the status of a failed call
+func (b *Breaker) failed(err error) bool {
+	if err == nil {
+		return false
+	}
+	code := status.Code(err)
+	for _, c := range b.opts.Codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// notify logs and records the transitions,
+// and publishes them to the listeners
+func (b *Breaker) notify(changes []Transition) {
+	if len(changes) == 0 {
+		return
+	}
+	b.mtx.Lock()
+	listeners := b.onChange
+	b.mtx.Unlock()
+	for _, t := range changes {
+		log.Printf("circuit of %s on %s: %s -> %s", t.Method, t.Target, t.From, t.To)
+		metrics.CircuitChanged(t.Target, t.Method, t.From.String(), t.To.String())
+		for _, fn := range listeners {
+			fn(t)
+		}
+	}
+}
+
+// openError returns the Unavailable status of a call that fails fast,
+// with a RetryInfo detail telling when the circuit half-opens
+func openError(method string, wait time.Duration) error {
+	stat := status.New(codes.Unavailable, "circuit open for "+method+", try later")
+	statDetail, err := stat.WithDetails(&errdetails.RetryInfo{RetryDelay: ptypes.DurationProto(wait)})
+	if err != nil {
+		return stat.Err()
+	}
+	return statDetail.Err()
+}
+
+// UnaryClientIntercept returns a unary client interceptor
+// that lets the calls through the circuit of their method
+func (b *Breaker) UnaryClientIntercept() grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply interface{},
+		conn *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		p, err := b.allow(conn.Target(), method)
+		if err != nil {
+			return err
+		}
+		err = invoker(ctx, method, req, reply, conn, opts...)
+		b.finish(ctx, p, err)
+		return err
+	}
+}
+
+// StreamClientIntercept returns a stream client interceptor that lets
+// the streams through the circuit of their method. The outcome of a
+// stream is its first receive: a message or the end of the stream
+// tells that the server is up. A trial stream that ends without a
+// receive (i.e. canceled or abandoned) frees its trial slot once its
+// context is done. The calls canceled by the client have no outcome
+// (see finish).
+func (b *Breaker) StreamClientIntercept() grpc.StreamClientInterceptor {
+	return func(
+		ctx context.Context,
+		desc *grpc.StreamDesc,
+		conn *grpc.ClientConn,
+		method string,
+		streamer grpc.Streamer,
+		opts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		p, err := b.allow(conn.Target(), method)
+		if err != nil {
+			return nil, err
+		}
+		stream, err := streamer(ctx, desc, conn, method, opts...)
+		if err != nil {
+			b.finish(ctx, p, err)
+			return nil, err
+		}
+		// the first receive is the outcome of the stream,
+		// unless the trial slot was freed first
+		var once sync.Once
+		if p.trial {
+			go func() {
+				<-stream.Context().Done()
+				once.Do(func() { b.release(p) })
+			}()
+		}
+		return streams.OnDone(stream, false, func(err error) {
+			once.Do(func() { b.finish(ctx, p, err) })
+		}), nil
+	}
+}
@@ -0,0 +1,265 @@
+package breaker
+
+import (
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"golang.org/x/net/context"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	target = "replica:50051"
+	method = "/test.Service/Method"
+)
+
+var unavailable = status.Error(codes.Unavailable, "server down")
+
+func newBreaker() (*Breaker, *[]State) {
+	b := NewBreaker(Options{
+		Failures:      3,
+		OpenTimeout:   20 * time.Millisecond,
+		HalfOpenCalls: 2,
+		Codes:         []codes.Code{codes.Unavailable, codes.DeadlineExceeded},
+	})
+	var states []State
+	b.OnChange(func(t Transition) { states = append(states, t.To) })
+	return b, &states
+}
+
+// call lets a call through b, which ends with err
+func call(t *testing.T, b *Breaker, err error) {
+	t.Helper()
+	p, allowErr := b.allow(target, method)
+	if allowErr != nil {
+		t.Fatalf("call rejected: %v", allowErr)
+	}
+	b.done(p, err)
+}
+
+// rejected returns the time the circuit stays open
+// for, if the calls to the circuit fail fast
+func rejected(b *Breaker) (time.Duration, bool) {
+	_, err := b.allow(target, method)
+	if err == nil {
+		return 0, false
+	}
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok {
+			wait, _ := ptypes.Duration(info.GetRetryDelay())
+			return wait, status.Code(err) == codes.Unavailable
+		}
+	}
+	return 0, status.Code(err) == codes.Unavailable
+}
+
+func TestBreakerTransitions(t *testing.T) {
+	b, states := newBreaker()
+
+	// the failures must be consecutive
+	call(t, b, unavailable)
+	call(t, b, unavailable)
+	call(t, b, status.Error(codes.NotFound, "server up"))
+	call(t, b, unavailable)
+	call(t, b, unavailable)
+	if state := b.State(target, method); state != Closed {
+		t.Fatalf("circuit %v, want closed", state)
+	}
+	call(t, b, unavailable)
+	if state := b.State(target, method); state != Open {
+		t.Fatalf("circuit %v, want open", state)
+	}
+	if wait, ok := rejected(b); !ok || wait <= 0 {
+		t.Fatalf("open circuit let a call through, or retry in %v", wait)
+	}
+
+	// two trial calls at most once half-open
+	time.Sleep(25 * time.Millisecond)
+	first, err := b.allow(target, method)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := b.allow(target, method)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rejected(b); !ok {
+		t.Fatal("half-open circuit let a third trial call through")
+	}
+	b.done(first, nil)
+	if state := b.State(target, method); state != HalfOpen {
+		t.Fatalf("circuit %v after a trial call, want half-open", state)
+	}
+	b.done(second, nil)
+	if state := b.State(target, method); state != Closed {
+		t.Fatalf("circuit %v after the trial calls, want closed", state)
+	}
+
+	// a failed trial call opens the circuit again
+	for i := 0; i < 3; i++ {
+		call(t, b, unavailable)
+	}
+	time.Sleep(25 * time.Millisecond)
+	call(t, b, unavailable)
+	if _, ok := rejected(b); !ok {
+		t.Fatal("circuit let a call through after a failed trial")
+	}
+
+	want := []State{Open, HalfOpen, Closed, Open, HalfOpen, Open}
+	if !reflect.DeepEqual(*states, want) {
+		t.Errorf("transitions %v, want %v", *states, want)
+	}
+}
+
+func TestBreakerStaleGeneration(t *testing.T) {
+	b, _ := newBreaker()
+	stale, err := b.allow(target, method)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		call(t, b, unavailable)
+	}
+	time.Sleep(25 * time.Millisecond)
+	trial, err := b.allow(target, method)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the call let through while closed neither fails
+	// nor succeeds the trial of the half-open circuit
+	b.done(stale, unavailable)
+	if state := b.State(target, method); state != HalfOpen {
+		t.Fatalf("circuit %v after a stale failure, want half-open", state)
+	}
+	// nor does it release a trial slot
+	b.release(stale)
+	if _, err := b.allow(target, method); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rejected(b); !ok {
+		t.Fatal("stale call released a trial slot")
+	}
+	b.done(stale, nil)
+	b.done(trial, nil)
+	if state := b.State(target, method); state != HalfOpen {
+		t.Errorf("circuit %v after a stale success, want half-open", state)
+	}
+}
+
+// conn returns a connection to target, which is never dialed
+func conn(t *testing.T) *grpc.ClientConn {
+	t.Helper()
+	conn, err := grpc.Dial("passthrough:///"+target, grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestBreakerNoOutcome(t *testing.T) {
+	deadlineExceeded := status.Error(codes.DeadlineExceeded, "deadline exceeded")
+	tests := []struct {
+		name    string
+		expired bool // the context of the call is done
+		err     error
+		state   State
+	}{
+		{"failure", false, unavailable, Open},
+		{"canceled", true, status.Error(codes.Canceled, "canceled"), Closed},
+		{"canceled, context alive", false, status.Error(codes.Canceled, "canceled"), Closed},
+		{"past the deadline of the caller", true, deadlineExceeded, Closed},
+		{"past the deadline of the server", false, deadlineExceeded, Open},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := NewBreaker(Options{
+				Failures:      1,
+				OpenTimeout:   time.Minute,
+				HalfOpenCalls: 1,
+				Codes:         []codes.Code{codes.Unavailable, codes.DeadlineExceeded},
+			})
+			ctx, cancel := context.WithCancel(context.Background())
+			if test.expired {
+				cancel()
+			}
+			defer cancel()
+			invoker := func(ctx context.Context, method string, req, reply interface{}, conn *grpc.ClientConn, opts ...grpc.CallOption) error {
+				return test.err
+			}
+			b.UnaryClientIntercept()(ctx, method, nil, nil, conn(t), invoker)
+			if state := b.State("passthrough:///"+target, method); state != test.state {
+				t.Errorf("circuit %v, want %v", state, test.state)
+			}
+		})
+	}
+}
+
+// fakeStream returns err from RecvMsg
+type fakeStream struct {
+	grpc.ClientStream
+	ctx context.Context
+	err error
+}
+
+func (s *fakeStream) RecvMsg(m interface{}) error { return s.err }
+func (s *fakeStream) Context() context.Context    { return s.ctx }
+
+func TestBreakerStream(t *testing.T) {
+	b := NewBreaker(Options{
+		Failures:      1,
+		OpenTimeout:   20 * time.Millisecond,
+		HalfOpenCalls: 1,
+		Codes:         []codes.Code{codes.Unavailable},
+	})
+	conn := conn(t)
+	target := conn.Target()
+	desc := &grpc.StreamDesc{ServerStreams: true}
+	open := func(ctx context.Context, recvErr error) grpc.ClientStream {
+		t.Helper()
+		streamer := func(ctx context.Context, desc *grpc.StreamDesc, conn *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			return &fakeStream{ctx: ctx, err: recvErr}, nil
+		}
+		stream, err := b.StreamClientIntercept()(ctx, desc, conn, method, streamer)
+		if err != nil {
+			t.Fatalf("stream rejected: %v", err)
+		}
+		return stream
+	}
+
+	// the first receive is the outcome of the stream
+	open(context.Background(), unavailable).RecvMsg(nil)
+	if state := b.State(target, method); state != Open {
+		t.Fatalf("circuit %v, want open", state)
+	}
+
+	// an abandoned trial stream frees its slot
+	time.Sleep(25 * time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	open(ctx, nil)
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	var stream grpc.ClientStream
+	for stream == nil && time.Now().Before(deadline) {
+		streamer := func(ctx context.Context, desc *grpc.StreamDesc, conn *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			return &fakeStream{ctx: ctx, err: io.EOF}, nil
+		}
+		stream, _ = b.StreamClientIntercept()(context.Background(), desc, conn, method, streamer)
+		time.Sleep(time.Millisecond)
+	}
+	if stream == nil {
+		t.Fatal("abandoned trial stream never freed its slot")
+	}
+	// the end of the stream tells that the server is up
+	stream.RecvMsg(nil)
+	if state := b.State(target, method); state != Closed {
+		t.Errorf("circuit %v, want closed", state)
+	}
+}
@@ -0,0 +1,191 @@
+package util
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/url"
+	"time"
+)
+
+// CertOptions specifies the subject, SANs, and lifetime
+// of a certificate created with NewCA or issued by a CA.
+type CertOptions struct {
+	CommonName  string
+	OrgUnits    []string
+	DNSNames    []string
+	IPAddresses []net.IP
+	URIs        []*url.URL
+	Lifetime    time.Duration
+}
+
+// CertKeyPair holds a certificate with its private key
+// along with their PEM encodings.
+type CertKeyPair struct {
+	Cert    *x509.Certificate
+	Key     *ecdsa.PrivateKey
+	CertPEM []byte
+	KeyPEM  []byte
+}
+
+// NewCA creates a self-signed certificate authority
+func NewCA(opts CertOptions) (*CertKeyPair, error) {
+	tmpl, err := certTemplate(opts)
+	if err != nil {
+		return nil, err
+	}
+	tmpl.IsCA = true
+	tmpl.BasicConstraintsValid = true
+	tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	return createCert(tmpl, nil)
+}
+
+// LoadCA reads a PEM-encoded CA certificate and its EC private key
+// so that it can be used to issue new certificates.
+func LoadCA(certFile, keyFile string) (*CertKeyPair, error) {
+	certPEM, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	certBlock, _ := pem.Decode(certPEM)
+	if certBlock == nil {
+		return nil, fmt.Errorf("no certificate found in %s", certFile)
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	keyBlock, _ := pem.Decode(keyPEM)
+	if keyBlock == nil {
+		return nil, fmt.Errorf("no private key found in %s", keyFile)
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	return &CertKeyPair{Cert: cert, Key: key, CertPEM: certPEM, KeyPEM: keyPEM}, nil
+}
+
+// NewServerCert issues a certificate, signed by ca, for TLS servers
+func (ca *CertKeyPair) NewServerCert(opts CertOptions) (*CertKeyPair, error) {
+	return ca.issue(opts, x509.ExtKeyUsageServerAuth)
+}
+
+// NewClientCert issues a certificate, signed by ca, for TLS clients
+func (ca *CertKeyPair) NewClientCert(opts CertOptions) (*CertKeyPair, error) {
+	return ca.issue(opts, x509.ExtKeyUsageClientAuth)
+}
+
+func (ca *CertKeyPair) issue(opts CertOptions, usage x509.ExtKeyUsage) (*CertKeyPair, error) {
+	tmpl, err := certTemplate(opts)
+	if err != nil {
+		return nil, err
+	}
+	tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+	tmpl.ExtKeyUsage = []x509.ExtKeyUsage{usage}
+	return createCert(tmpl, ca)
+}
+
+// TLSCertificate returns the pair as a tls.Certificate
+func (p *CertKeyPair) TLSCertificate() (tls.Certificate, error) {
+	return tls.X509KeyPair(p.CertPEM, p.KeyPEM)
+}
+
+// CertPool returns a pool that only holds the pair's certificate,
+// used to verify the certificates issued by a CA.
+func (p *CertKeyPair) CertPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(p.Cert)
+	return pool
+}
+
+// WriteFiles saves the PEM-encoded certificate and key to files.
+// The key file is only readable by its owner.
+func (p *CertKeyPair) WriteFiles(certFile, keyFile string) error {
+	if err := ioutil.WriteFile(certFile, p.CertPEM, 0644); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(keyFile, p.KeyPEM, 0600)
+}
+
+func certTemplate(opts CertOptions) (*x509.Certificate, error) {
+	if opts.Lifetime <= 0 {
+		return nil, fmt.Errorf("certificate lifetime must be positive")
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	// backdate a bit to tolerate clock skew between hosts
+	notBefore := time.Now().Add(-5 * time.Minute)
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:         opts.CommonName,
+			OrganizationalUnit: opts.OrgUnits,
+		},
+		DNSNames:    opts.DNSNames,
+		IPAddresses: opts.IPAddresses,
+		URIs:        opts.URIs,
+		NotBefore:   notBefore,
+		NotAfter:    notBefore.Add(opts.Lifetime),
+	}, nil
+}
+
+// createCert generates a key and creates a certificate from tmpl
+// signed by parent. The certificate is self-signed if parent is nil.
+func createCert(tmpl *x509.Certificate, parent *CertKeyPair) (*CertKeyPair, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	signerCert, signerKey := tmpl, key
+	if parent != nil {
+		// tmpl.NotBefore is backdated, so an expired CA could still
+		// issue certificates that expire in the past
+		if !time.Now().Before(parent.Cert.NotAfter) {
+			return nil, fmt.Errorf("CA %q expired on %s", parent.Cert.Subject.CommonName, parent.Cert.NotAfter)
+		}
+		// a certificate cannot outlive the CA that signed it
+		if tmpl.NotAfter.After(parent.Cert.NotAfter) {
+			tmpl.NotAfter = parent.Cert.NotAfter
+		}
+		if !tmpl.NotAfter.After(tmpl.NotBefore) {
+			return nil, fmt.Errorf("CA %q expires before the certificate is valid", parent.Cert.Subject.CommonName)
+		}
+		signerCert, signerKey = parent.Cert, parent.Key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signerCert, &key.PublicKey, signerKey)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CertKeyPair{
+		Cert:    cert,
+		Key:     key,
+		CertPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		KeyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}),
+	}, nil
+}
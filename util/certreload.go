@@ -0,0 +1,293 @@
+package util
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/vladimirvivien/go-grpc/util/metrics"
+)
+
+// CertReloader watches TLS certificate, key, and CA files and
+// reloads them when they change on disk. The loaded values are
+// swapped atomically and handed to the TLS stack through the
+// GetCertificate and GetClientCertificate callbacks so that
+// renewed certificates are picked up without a restart.
+// Either the cert/key pair or the CA file may be left empty.
+type CertReloader struct {
+	certFile, keyFile, caFile string
+
+	// WarnBefore is the window, before a certificate expires,
+	// during which expiry warnings are logged.
+	WarnBefore time.Duration
+
+	mtx      sync.RWMutex
+	cert     *tls.Certificate
+	pool     *x509.CertPool
+	modTimes map[string]time.Time
+	warned   bool
+}
+
+// NewCertReloader loads the files for the first time.
+// Call Watch to start watching them for changes.
+func NewCertReloader(certFile, keyFile, caFile string) (*CertReloader, error) {
+	r := &CertReloader{
+		certFile:   certFile,
+		keyFile:    keyFile,
+		caFile:     caFile,
+		WarnBefore: 7 * 24 * time.Hour,
+		modTimes:   make(map[string]time.Time),
+	}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Watch polls the files every interval and reloads them when
+// any has been modified. Watch runs until stop is closed.
+// Reload errors are logged and the previous values are kept.
+func (r *CertReloader) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if r.modified() {
+				if err := r.reload(); err != nil {
+					log.Println("certificate reload failed:", err)
+					continue
+				}
+				log.Println("certificates reloaded")
+			}
+			r.checkExpiry()
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (r *CertReloader) files() []string {
+	var files []string
+	for _, f := range []string{r.certFile, r.keyFile, r.caFile} {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// modified returns true if any file changed since last loaded
+func (r *CertReloader) modified() bool {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	for _, f := range r.files() {
+		info, err := os.Stat(f)
+		if err != nil {
+			continue
+		}
+		if !info.ModTime().Equal(r.modTimes[f]) {
+			return true
+		}
+	}
+	return false
+}
+
+// reload loads all files and swaps them in if all are valid
+func (r *CertReloader) reload() error {
+	modTimes := make(map[string]time.Time)
+	for _, f := range r.files() {
+		info, err := os.Stat(f)
+		if err != nil {
+			return err
+		}
+		modTimes[f] = info.ModTime()
+	}
+
+	var cert *tls.Certificate
+	if r.certFile != "" {
+		c, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err != nil {
+			return err
+		}
+		if c.Leaf == nil {
+			if c.Leaf, err = x509.ParseCertificate(c.Certificate[0]); err != nil {
+				return err
+			}
+		}
+		cert = &c
+	}
+
+	var pool *x509.CertPool
+	if r.caFile != "" {
+		p, err := loadCertPool(r.caFile)
+		if err != nil {
+			return err
+		}
+		pool = p
+	}
+
+	r.mtx.Lock()
+	r.cert, r.pool, r.modTimes = cert, pool, modTimes
+	r.warned = false
+	r.mtx.Unlock()
+
+	r.checkExpiry()
+	return nil
+}
+
+// checkExpiry records the expiry time of the certificate
+// (tls_cert_expiry_timestamp_seconds) and logs a warning, once
+// per loaded certificate, when it is about to expire.
+func (r *CertReloader) checkExpiry() {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.cert == nil {
+		return
+	}
+
+	metrics.CertLoaded(r.certFile, r.cert.Leaf.NotAfter)
+	left := time.Until(r.cert.Leaf.NotAfter)
+	if left < r.WarnBefore && !r.warned {
+		r.warned = true
+		metrics.CertExpiring(r.certFile)
+		log.Printf("WARNING: certificate %s expires in %v", r.certFile, left.Round(time.Second))
+	}
+}
+
+// GetCertificate implements the tls.Config callback for servers
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	if r.cert == nil {
+		return nil, fmt.Errorf("no certificate loaded")
+	}
+	return r.cert, nil
+}
+
+// GetClientCertificate implements the tls.Config callback for clients
+func (r *CertReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	if r.cert == nil {
+		// no certificate is sent to the server
+		return new(tls.Certificate), nil
+	}
+	return r.cert, nil
+}
+
+// CertPool returns the currently loaded CA pool
+func (r *CertReloader) CertPool() *x509.CertPool {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	return r.pool
+}
+
+// ServerCreds returns server transport credentials backed by the
+// reloader. When requireClientCert is true, client certificates
+// are verified against the currently loaded CA (mutual TLS).
+func (r *CertReloader) ServerCreds(requireClientCert bool) credentials.TransportCredentials {
+	cfg := &tls.Config{GetCertificate: r.GetCertificate}
+	if requireClientCert {
+		// a fresh config is built for each handshake to pick up the current CA
+		cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return &tls.Config{
+				GetCertificate: r.GetCertificate,
+				ClientAuth:     tls.RequireAndVerifyClientCert,
+				ClientCAs:      r.CertPool(),
+				NextProtos:     []string{"h2"},
+			}, nil
+		}
+	}
+	return credentials.NewTLS(cfg)
+}
+
+// ClientCreds returns client transport credentials backed by the
+// reloader. The server certificate is verified against the currently
+// loaded CA and the client certificate, if any, is presented to the server.
+// The certificate must be issued for serverName or, when it is empty, for
+// the host or IP address dialed.
+func (r *CertReloader) ClientCreds(serverName string) credentials.TransportCredentials {
+	return &clientCreds{
+		TransportCredentials: credentials.NewTLS(r.clientConfig(serverName)),
+		r:                    r,
+		serverName:           serverName,
+	}
+}
+
+func (r *CertReloader) clientConfig(serverName string) *tls.Config {
+	return &tls.Config{
+		ServerName:           serverName,
+		GetClientCertificate: r.GetClientCertificate,
+		// the standard verification is replaced with one that
+		// uses the CA pool loaded at the time of the handshake
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			return r.verifyServer(cs, serverName)
+		},
+	}
+}
+
+// clientCreds resolves the name the server certificate is verified
+// against, for each handshake, before handing it to the TLS credentials
+type clientCreds struct {
+	credentials.TransportCredentials
+	r          *CertReloader
+	serverName string
+}
+
+func (c *clientCreds) ClientHandshake(
+	ctx context.Context,
+	authority string,
+	conn net.Conn,
+) (net.Conn, credentials.AuthInfo, error) {
+	serverName := c.serverName
+	if serverName == "" {
+		// the TLS stack leaves ConnectionState.ServerName empty when
+		// an IP address is dialed, the name is kept here instead
+		serverName = authority
+		if host, _, err := net.SplitHostPort(authority); err == nil {
+			serverName = host
+		}
+	}
+	creds := credentials.NewTLS(c.r.clientConfig(serverName))
+	return creds.ClientHandshake(ctx, authority, conn)
+}
+
+func (c *clientCreds) Clone() credentials.TransportCredentials {
+	return &clientCreds{
+		TransportCredentials: c.TransportCredentials.Clone(),
+		r:                    c.r,
+		serverName:           c.serverName,
+	}
+}
+
+// verifyServer verifies the server's certificate chain against the
+// current CA pool, and that the certificate is issued for serverName
+// (a DNS name or an IP address, see x509.Certificate.VerifyHostname)
+func (r *CertReloader) verifyServer(cs tls.ConnectionState, serverName string) error {
+	if len(cs.PeerCertificates) == 0 {
+		return fmt.Errorf("server presented no certificate")
+	}
+	if serverName == "" {
+		return fmt.Errorf("no server name to verify the certificate against")
+	}
+	opts := x509.VerifyOptions{
+		Roots:         r.CertPool(),
+		DNSName:       serverName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
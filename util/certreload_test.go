@@ -0,0 +1,84 @@
+package util
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// serveTLS starts a health server presenting the server certificate
+func serveTLS(t *testing.T, certs *EphemeralCerts) string {
+	t.Helper()
+	creds, err := certs.ServerCreds(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer(grpc.Creds(creds))
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	return lis.Addr().String()
+}
+
+// caReloader returns a reloader of the CA of certs, written to a file
+func caReloader(t *testing.T, certs *EphemeralCerts) *CertReloader {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "certreload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(caFile, certs.CA.CertPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewCertReloader("", "", caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestReloaderClientCredsServerName(t *testing.T) {
+	localhost := CertOptions{DNSNames: []string{"localhost"}, IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)}}
+	evil := CertOptions{DNSNames: []string{"evil.example"}}
+	tests := []struct {
+		name       string
+		server     CertOptions
+		serverName string
+		want       codes.Code
+	}{
+		{"dialed IP", localhost, "", codes.OK},
+		{"server name", localhost, "localhost", codes.OK},
+		{"wrong name for dialed IP", evil, "", codes.Unavailable},
+		{"wrong server name", evil, "localhost", codes.Unavailable},
+		{"other server name", localhost, "evil.example", codes.Unavailable},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			certs, err := NewEphemeralCerts(time.Hour, test.server, CertOptions{CommonName: "client"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			addr := serveTLS(t, certs)
+			creds := caReloader(t, certs).ClientCreds(test.serverName)
+			err = checkHealth(t, addr, grpc.WithTransportCredentials(creds))
+			if status.Code(err) != test.want {
+				t.Errorf("got %v, want %v", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package util
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// ServerChain composes ordered server interceptors into the single
+// unary and stream interceptor a grpc.Server accepts. Interceptors
+// run in the order they are added: the first one added is the
+// outermost, it sees the call first and its result last.
+//
+// The currency servers add their stages in this order:
+//
+//	recovery   catches panics raised by any stage below it
+//	tracing    starts the server span, continuing the client's trace
+//	logging    records every call, including calls rejected below
+//	metrics    measures every call, including calls rejected below
+//	auth       authenticates the caller then enforces the policy
+//	shedding   sheds the calls over the adaptive concurrency limit
+//	           (grpc_limits), before they reach the handler
+//	rate       rejects the calls over the caller's rate limit, with
+//	           RetryInfo, and returns the limit in trailers
+//	handler
+//
+// Stages that reject a call (auth, shedding, rate) come after the ones
+// that observe it so that rejected calls are still logged and counted.
+// The auth stage decides the criticality of the call: it attaches the
+// caller's identity, whose scopes cap the criticality sent by the
+// caller (see CriticalityFromContext), so the stages applying it come
+// after auth.
+type ServerChain struct {
+	unary  []grpc.UnaryServerInterceptor
+	stream []grpc.StreamServerInterceptor
+}
+
+func NewServerChain() *ServerChain {
+	return new(ServerChain)
+}
+
+// Add appends a stage made of a unary and a stream interceptor.
+// Either may be nil when the stage only applies to one call type.
+func (c *ServerChain) Add(
+	unary grpc.UnaryServerInterceptor,
+	stream grpc.StreamServerInterceptor,
+) *ServerChain {
+	if unary != nil {
+		c.unary = append(c.unary, unary)
+	}
+	if stream != nil {
+		c.stream = append(c.stream, stream)
+	}
+	return c
+}
+
+// UnaryInterceptor returns the unary interceptors composed into one
+func (c *ServerChain) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	chain := append([]grpc.UnaryServerInterceptor(nil), c.unary...)
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		// wrap the handler from the innermost interceptor out
+		next := handler
+		for i := len(chain) - 1; i >= 0; i-- {
+			intercept, inner := chain[i], next
+			next = func(ctx context.Context, req interface{}) (interface{}, error) {
+				return intercept(ctx, req, info, inner)
+			}
+		}
+		return next(ctx, req)
+	}
+}
+
+// StreamInterceptor returns the stream interceptors composed into one
+func (c *ServerChain) StreamInterceptor() grpc.StreamServerInterceptor {
+	chain := append([]grpc.StreamServerInterceptor(nil), c.stream...)
+	return func(
+		server interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		next := handler
+		for i := len(chain) - 1; i >= 0; i-- {
+			intercept, inner := chain[i], next
+			next = func(server interface{}, stream grpc.ServerStream) error {
+				return intercept(server, stream, info, inner)
+			}
+		}
+		return next(server, stream)
+	}
+}
+
+// ClientChain composes ordered client interceptors into the single
+// unary and stream interceptor a grpc.ClientConn accepts. As with
+// ServerChain, the first interceptor added is the outermost. Clients
+// add their stages in this order:
+//
+//	logging      records every call as seen by the application
+//	metrics      measures every call, including its retries
+//	hedging      sends copies of slow calls to the replicas (grpc_retry)
+//	breaker      fails the calls, or copies, fast while the circuit of
+//	             their target is open
+//	retry        retries failed attempts of the call, or of each copy
+//	tracing      starts a span per attempt, propagated to the server
+//	rate         delays or rejects each attempt
+//	criticality  sends the criticality of the call with each attempt
+//	auth         attaches credentials to each attempt
+//	invoker
+type ClientChain struct {
+	unary  []grpc.UnaryClientInterceptor
+	stream []grpc.StreamClientInterceptor
+}
+
+func NewClientChain() *ClientChain {
+	return new(ClientChain)
+}
+
+// Add appends a stage made of a unary and a stream interceptor.
+// Either may be nil when the stage only applies to one call type.
+func (c *ClientChain) Add(
+	unary grpc.UnaryClientInterceptor,
+	stream grpc.StreamClientInterceptor,
+) *ClientChain {
+	if unary != nil {
+		c.unary = append(c.unary, unary)
+	}
+	if stream != nil {
+		c.stream = append(c.stream, stream)
+	}
+	return c
+}
+
+// UnaryInterceptor returns the unary interceptors composed into one
+func (c *ClientChain) UnaryInterceptor() grpc.UnaryClientInterceptor {
+	chain := append([]grpc.UnaryClientInterceptor(nil), c.unary...)
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply interface{},
+		conn *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		next := invoker
+		for i := len(chain) - 1; i >= 0; i-- {
+			intercept, inner := chain[i], next
+			next = func(
+				ctx context.Context,
+				method string,
+				req, reply interface{},
+				conn *grpc.ClientConn,
+				opts ...grpc.CallOption,
+			) error {
+				return intercept(ctx, method, req, reply, conn, inner, opts...)
+			}
+		}
+		return next(ctx, method, req, reply, conn, opts...)
+	}
+}
+
+// StreamInterceptor returns the stream interceptors composed into one
+func (c *ClientChain) StreamInterceptor() grpc.StreamClientInterceptor {
+	chain := append([]grpc.StreamClientInterceptor(nil), c.stream...)
+	return func(
+		ctx context.Context,
+		desc *grpc.StreamDesc,
+		conn *grpc.ClientConn,
+		method string,
+		streamer grpc.Streamer,
+		opts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		next := streamer
+		for i := len(chain) - 1; i >= 0; i-- {
+			intercept, inner := chain[i], next
+			next = func(
+				ctx context.Context,
+				desc *grpc.StreamDesc,
+				conn *grpc.ClientConn,
+				method string,
+				opts ...grpc.CallOption,
+			) (grpc.ClientStream, error) {
+				return intercept(ctx, desc, conn, method, inner, opts...)
+			}
+		}
+		return next(ctx, desc, conn, method, opts...)
+	}
+}
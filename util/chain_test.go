@@ -0,0 +1,169 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// recorder records the order in which the stages of a chain run
+type recorder struct {
+	calls []string
+}
+
+func (r *recorder) record(call string) {
+	r.calls = append(r.calls, call)
+}
+
+func (r *recorder) check(t *testing.T, want ...string) {
+	t.Helper()
+	if !reflect.DeepEqual(r.calls, want) {
+		t.Errorf("calls = %v, want %v", r.calls, want)
+	}
+}
+
+func (r *recorder) unaryServer(name string) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		r.record(name + ">")
+		defer r.record("<" + name)
+		return handler(ctx, req)
+	}
+}
+
+func (r *recorder) streamServer(name string) grpc.StreamServerInterceptor {
+	return func(
+		server interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		r.record(name + ">")
+		defer r.record("<" + name)
+		return handler(server, stream)
+	}
+}
+
+func (r *recorder) unaryClient(name string) grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply interface{},
+		conn *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		r.record(name + ">")
+		defer r.record("<" + name)
+		return invoker(ctx, method, req, reply, conn, opts...)
+	}
+}
+
+func (r *recorder) streamClient(name string) grpc.StreamClientInterceptor {
+	return func(
+		ctx context.Context,
+		desc *grpc.StreamDesc,
+		conn *grpc.ClientConn,
+		method string,
+		streamer grpc.Streamer,
+		opts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		r.record(name + ">")
+		defer r.record("<" + name)
+		return streamer(ctx, desc, conn, method, opts...)
+	}
+}
+
+// the stages run outer to inner in the order they are added, then
+// return inner to outer; nil interceptors are left out of the chain
+var wantOrder = []string{"a>", "b>", "c>", "call", "<c", "<b", "<a"}
+
+func TestServerChainUnary(t *testing.T) {
+	r := new(recorder)
+	chain := NewServerChain().
+		Add(r.unaryServer("a"), nil).
+		Add(r.unaryServer("b"), r.streamServer("x")).
+		Add(r.unaryServer("c"), nil)
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		r.record("call")
+		return req, nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}
+	resp, err := chain.UnaryInterceptor()(context.Background(), "req", info, handler)
+	if err != nil || resp != "req" {
+		t.Fatalf("got %v, %v, want req, nil", resp, err)
+	}
+	r.check(t, wantOrder...)
+}
+
+func TestServerChainStream(t *testing.T) {
+	r := new(recorder)
+	chain := NewServerChain().
+		Add(nil, r.streamServer("a")).
+		Add(r.unaryServer("x"), r.streamServer("b")).
+		Add(nil, r.streamServer("c"))
+
+	handler := func(server interface{}, stream grpc.ServerStream) error {
+		r.record("call")
+		return nil
+	}
+	info := &grpc.StreamServerInfo{FullMethod: "/test.Service/Stream"}
+	if err := chain.StreamInterceptor()(nil, nil, info, handler); err != nil {
+		t.Fatal(err)
+	}
+	r.check(t, wantOrder...)
+}
+
+func TestClientChainUnary(t *testing.T) {
+	r := new(recorder)
+	chain := NewClientChain().
+		Add(r.unaryClient("a"), nil).
+		Add(r.unaryClient("b"), r.streamClient("x")).
+		Add(r.unaryClient("c"), nil)
+
+	invoker := func(
+		ctx context.Context,
+		method string,
+		req, reply interface{},
+		conn *grpc.ClientConn,
+		opts ...grpc.CallOption,
+	) error {
+		r.record("call")
+		return nil
+	}
+	if err := chain.UnaryInterceptor()(context.Background(), "/test.Service/Method", nil, nil, nil, invoker); err != nil {
+		t.Fatal(err)
+	}
+	r.check(t, wantOrder...)
+}
+
+func TestClientChainStream(t *testing.T) {
+	r := new(recorder)
+	chain := NewClientChain().
+		Add(nil, r.streamClient("a")).
+		Add(r.unaryClient("x"), r.streamClient("b")).
+		Add(nil, r.streamClient("c"))
+
+	streamer := func(
+		ctx context.Context,
+		desc *grpc.StreamDesc,
+		conn *grpc.ClientConn,
+		method string,
+		opts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		r.record("call")
+		return nil, nil
+	}
+	desc := &grpc.StreamDesc{StreamName: "Stream", ServerStreams: true}
+	if _, err := chain.StreamInterceptor()(context.Background(), desc, nil, "/test.Service/Stream", streamer); err != nil {
+		t.Fatal(err)
+	}
+	r.check(t, wantOrder...)
+}
@@ -0,0 +1,274 @@
+// Package concurrency limits the number of calls a server handles at
+// once. Rather than a fixed limit (i.e. grpc.MaxConcurrentStreams), the
+// limit adapts to the latency of the calls: the latency is averaged
+// over windows of calls and compared with its long term average. The
+// limit grows while the latency holds, and shrinks in proportion to
+// the latency increase (the gradient) as soon as calls queue up. Calls
+// over the limit are shed with ResourceExhausted before they reach the
+// handler, so the server keeps serving the calls it admits at a steady
+// latency.
+//
+// The calls are admitted by criticality (see util.Criticality): the
+// critical and default calls over the limit wait for a slot in the
+// admission queue of their criticality, critical calls first, while
+// the sheddable calls are shed right away. Sheddable calls only use
+// part of the limit, so that they cannot hold all the slots.
+package concurrency
+
+import (
+	"container/list"
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/vladimirvivien/go-grpc/util"
+)
+
+const (
+	// windowSamples is the minimum number of calls of a window
+	windowSamples = 10
+
+	// longWindows is the number of windows averaged
+	// into the long term latency
+	longWindows = 600
+
+	// smoothing weighs the new limit computed every window
+	smoothing = 0.2
+
+	// sheddableShare is the share of the limit
+	// that sheddable calls can use
+	sheddableShare = 0.75
+)
+
+// queued are the criticalities with an admission
+// queue, in the order the queues are served
+var queued = []util.Criticality{util.CriticalityCritical, util.CriticalityDefault}
+
+// Options configures a Limiter
+type Options struct {
+	// Initial, Min and Max bound the limit, which starts at Initial
+	Initial int
+	Min     int
+	Max     int
+
+	// Tolerance is the ratio of the latency to the long term latency
+	// above which the limit shrinks, 2 when zero
+	Tolerance float64
+
+	// Window is the minimum duration of a window of calls, 1s when zero
+	Window time.Duration
+
+	// QueueTimeout is the time a call waits in its admission
+	// queue before it is shed, 100ms when zero
+	QueueTimeout time.Duration
+}
+
+// Limiter adapts the number of calls handled at once
+type Limiter struct {
+	opts Options
+
+	mtx         sync.Mutex
+	limit       float64
+	inFlight    int
+	longLatency float64                         // long term average latency, in seconds
+	queues      map[util.Criticality]*list.List // of *waiter
+
+	// the current window
+	windowStart time.Time
+	samples     int
+	latencySum  time.Duration
+	maxInFlight int
+	dropped     bool
+}
+
+// NewLimiter returns a limiter adapting its limit within opts
+func NewLimiter(opts Options) *Limiter {
+	if opts.Min <= 0 {
+		opts.Min = 1
+	}
+	if opts.Max < opts.Min {
+		opts.Max = opts.Min
+	}
+	if opts.Initial < opts.Min || opts.Initial > opts.Max {
+		opts.Initial = opts.Min
+	}
+	if opts.Tolerance <= 1 {
+		opts.Tolerance = 2
+	}
+	if opts.Window <= 0 {
+		opts.Window = time.Second
+	}
+	if opts.QueueTimeout <= 0 {
+		opts.QueueTimeout = 100 * time.Millisecond
+	}
+	queues := make(map[util.Criticality]*list.List)
+	for _, c := range queued {
+		queues[c] = list.New()
+	}
+	return &Limiter{
+		opts:        opts,
+		limit:       float64(opts.Initial),
+		queues:      queues,
+		windowStart: time.Now(),
+	}
+}
+
+// waiter is a call waiting in an admission queue
+type waiter struct {
+	ready    chan struct{}
+	admitted bool
+}
+
+// Limit returns the current limit
+func (l *Limiter) Limit() int {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return int(l.limit)
+}
+
+// InFlight returns the number of calls being handled
+func (l *Limiter) InFlight() int {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.inFlight
+}
+
+// acquire admits a call of criticality c. When the limit is reached,
+// the call waits in its admission queue until a slot is released,
+// ctx is done, or the queue timeout. It returns false when the call
+// is shed.
+func (l *Limiter) acquire(ctx context.Context, c util.Criticality) bool {
+	l.mtx.Lock()
+	if l.admits(c) {
+		l.admit()
+		l.mtx.Unlock()
+		return true
+	}
+	queue, ok := l.queues[c]
+	if !ok || queue.Len() >= int(l.limit) {
+		l.mtx.Unlock()
+		return false
+	}
+	w := &waiter{ready: make(chan struct{})}
+	elem := queue.PushBack(w)
+	l.mtx.Unlock()
+
+	timer := time.NewTimer(l.opts.QueueTimeout)
+	defer timer.Stop()
+	select {
+	case <-w.ready:
+		return true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if w.admitted {
+		// admitted while timing out
+		return true
+	}
+	queue.Remove(elem)
+	return false
+}
+
+// admits returns true if a call of criticality c
+// can be admitted right away, l.mtx is held
+func (l *Limiter) admits(c util.Criticality) bool {
+	limit := l.limit
+	if c == util.CriticalitySheddable {
+		limit *= sheddableShare
+	}
+	if l.inFlight >= int(limit) {
+		return false
+	}
+	// the calls waiting in the queues of c and above go first
+	for class, queue := range l.queues {
+		if class >= c && queue.Len() > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// admit takes a slot, l.mtx is held
+func (l *Limiter) admit() {
+	l.inFlight++
+	if l.inFlight > l.maxInFlight {
+		l.maxInFlight = l.inFlight
+	}
+}
+
+// dequeue gives the free slots to the waiting calls,
+// the most critical first, l.mtx is held
+func (l *Limiter) dequeue() {
+	for _, c := range queued {
+		queue := l.queues[c]
+		for queue.Len() > 0 && l.inFlight < int(l.limit) {
+			w := queue.Remove(queue.Front()).(*waiter)
+			w.admitted = true
+			l.admit()
+			close(w.ready)
+		}
+	}
+}
+
+// release ends a call admitted by acquire. When sampled, the latency
+// of the call, and whether it was dropped for lack of time, are added
+// to the window; the limit is updated once the window is complete.
+func (l *Limiter) release(latency time.Duration, sampled, dropped bool) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.inFlight--
+	defer l.dequeue()
+	if !sampled {
+		return
+	}
+
+	l.samples++
+	l.latencySum += latency
+	l.dropped = l.dropped || dropped
+	now := time.Now()
+	if l.samples < windowSamples || now.Sub(l.windowStart) < l.opts.Window {
+		return
+	}
+	l.update(l.latencySum.Seconds() / float64(l.samples))
+	l.windowStart = now
+	l.samples = 0
+	l.latencySum = 0
+	l.maxInFlight = l.inFlight
+	l.dropped = false
+}
+
+// update computes the limit from the average latency of a window,
+// l.mtx is held
+func (l *Limiter) update(latency float64) {
+	if l.longLatency == 0 {
+		l.longLatency = latency
+	} else {
+		l.longLatency += (latency - l.longLatency) / longWindows
+	}
+	// once the load is gone, the long term latency
+	// recovers faster than the average allows
+	if l.longLatency/latency > 2 {
+		l.longLatency *= 0.95
+	}
+
+	gradient := math.Max(0.5, math.Min(1, l.opts.Tolerance*l.longLatency/latency))
+	if l.dropped {
+		gradient = 0.5
+	}
+	// the limit does not grow while it is not used,
+	// or it would grow past any useful value
+	if gradient == 1 && float64(l.maxInFlight) < l.limit/2 {
+		return
+	}
+
+	// the square root of the limit leaves room for calls to queue
+	// a little, so the latency increase can be observed
+	newLimit := l.limit*gradient + math.Sqrt(l.limit)
+	l.limit = l.limit*(1-smoothing) + newLimit*smoothing
+	l.limit = math.Max(float64(l.opts.Min), math.Min(float64(l.opts.Max), l.limit))
+}
@@ -0,0 +1,161 @@
+package concurrency
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/vladimirvivien/go-grpc/util"
+)
+
+// fixed returns a limiter with a fixed limit
+func fixed(limit int, queueTimeout time.Duration) *Limiter {
+	return NewLimiter(Options{Initial: limit, Min: limit, Max: limit, QueueTimeout: queueTimeout})
+}
+
+// waitQueued waits until n calls of criticality c wait in the queue of l
+func waitQueued(t *testing.T, l *Limiter, c util.Criticality, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		l.mtx.Lock()
+		queued := l.queues[c].Len()
+		l.mtx.Unlock()
+		if queued == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("%d %v calls never queued", n, c)
+}
+
+func TestAcquire(t *testing.T) {
+	tests := []struct {
+		name        string
+		inFlight    int // calls admitted before, out of a limit of 4
+		criticality util.Criticality
+		want        bool
+	}{
+		{"critical, free slot", 3, util.CriticalityCritical, true},
+		{"default, free slot", 3, util.CriticalityDefault, true},
+		{"sheddable, within its share", 2, util.CriticalitySheddable, true},
+		{"sheddable, over its share", 3, util.CriticalitySheddable, false},
+		{"critical, no slot", 4, util.CriticalityCritical, false},
+		{"default, no slot", 4, util.CriticalityDefault, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := fixed(4, 10*time.Millisecond)
+			for i := 0; i < test.inFlight; i++ {
+				if !l.acquire(context.Background(), util.CriticalityCritical) {
+					t.Fatalf("call %d shed", i)
+				}
+			}
+			if got := l.acquire(context.Background(), test.criticality); got != test.want {
+				t.Errorf("acquire = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDequeueOrder(t *testing.T) {
+	l := fixed(2, time.Second)
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		l.acquire(ctx, util.CriticalityCritical)
+	}
+
+	admitted := make(chan util.Criticality, 3)
+	enqueue := func(c util.Criticality, n int) {
+		go func() {
+			if l.acquire(ctx, c) {
+				admitted <- c
+			}
+		}()
+		waitQueued(t, l, c, n)
+	}
+	// the default calls wait first
+	enqueue(util.CriticalityDefault, 1)
+	enqueue(util.CriticalityDefault, 2)
+	enqueue(util.CriticalityCritical, 1)
+
+	// no call jumps the queues while calls wait
+	if l.acquire(ctx, util.CriticalityDefault) {
+		t.Fatal("default call admitted ahead of the waiting calls")
+	}
+
+	want := []util.Criticality{util.CriticalityCritical, util.CriticalityDefault, util.CriticalityDefault}
+	for i, c := range want {
+		l.release(0, false, false)
+		select {
+		case got := <-admitted:
+			if got != c {
+				t.Errorf("call %d admitted is %v, want %v", i, got, c)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("call %d never admitted", i)
+		}
+	}
+	if inFlight := l.InFlight(); inFlight != 2 {
+		t.Errorf("%d calls in flight, want 2", inFlight)
+	}
+}
+
+func TestQueueTimeout(t *testing.T) {
+	l := fixed(1, 20*time.Millisecond)
+	l.acquire(context.Background(), util.CriticalityCritical)
+
+	start := time.Now()
+	if l.acquire(context.Background(), util.CriticalityCritical) {
+		t.Fatal("call admitted without a free slot")
+	}
+	if waited := time.Since(start); waited < 20*time.Millisecond {
+		t.Errorf("call shed after %v, want the queue timeout", waited)
+	}
+	waitQueued(t, l, util.CriticalityCritical, 0)
+
+	// the slot released goes to no one
+	l.release(0, false, false)
+	if inFlight := l.InFlight(); inFlight != 0 {
+		t.Errorf("%d calls in flight, want 0", inFlight)
+	}
+}
+
+func TestQueueCanceled(t *testing.T) {
+	l := fixed(1, time.Second)
+	l.acquire(context.Background(), util.CriticalityCritical)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	shed := make(chan bool)
+	go func() { shed <- !l.acquire(ctx, util.CriticalityDefault) }()
+	waitQueued(t, l, util.CriticalityDefault, 1)
+	cancel()
+	select {
+	case ok := <-shed:
+		if !ok {
+			t.Fatal("canceled call admitted")
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("canceled call still waiting")
+	}
+	waitQueued(t, l, util.CriticalityDefault, 0)
+}
+
+func TestQueueFull(t *testing.T) {
+	l := fixed(1, time.Second)
+	ctx := context.Background()
+	l.acquire(ctx, util.CriticalityCritical)
+	go l.acquire(ctx, util.CriticalityCritical)
+	waitQueued(t, l, util.CriticalityCritical, 1)
+
+	// the queue holds at most limit calls
+	start := time.Now()
+	if l.acquire(ctx, util.CriticalityCritical) {
+		t.Fatal("call admitted over a full queue")
+	}
+	if waited := time.Since(start); waited > 100*time.Millisecond {
+		t.Errorf("call shed after %v, want right away", waited)
+	}
+	l.release(0, false, false)
+}
@@ -0,0 +1,70 @@
+package concurrency
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/vladimirvivien/go-grpc/util"
+	"github.com/vladimirvivien/go-grpc/util/metrics"
+)
+
+// errOverloaded is returned to the calls shed by the limiter
+var errOverloaded = status.Error(codes.ResourceExhausted, "server overloaded, try later")
+
+// UnaryServerIntercept returns a unary server interceptor that sheds
+// the calls over the limit, and adjusts the limit from the latency of
+// the calls it admits. The criticality of the call is sent by its
+// caller, and capped by the scopes of the caller's identity (see
+// util.CriticalityFromContext): the interceptor runs after the
+// authentication stage. Health checks are never shed.
+func (l *Limiter) UnaryServerIntercept() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (resp interface{}, err error) {
+		if util.IsHealthMethod(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		criticality := util.CriticalityFromContext(ctx)
+		if !l.acquire(ctx, criticality) {
+			metrics.LoadShed(info.FullMethod, criticality.String())
+			return nil, errOverloaded
+		}
+		// the slot is released even if the handler panics
+		start := time.Now()
+		defer func() {
+			l.release(time.Since(start), true, status.Code(err) == codes.DeadlineExceeded)
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerIntercept returns a stream server interceptor that sheds
+// the streams over the limit as UnaryServerIntercept does. A stream
+// holds its slot while it is open, but its latency depends on the
+// caller and is not used to adjust the limit.
+func (l *Limiter) StreamServerIntercept() grpc.StreamServerInterceptor {
+	return func(
+		server interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		if util.IsHealthMethod(info.FullMethod) {
+			return handler(server, stream)
+		}
+		criticality := util.CriticalityFromContext(stream.Context())
+		if !l.acquire(stream.Context(), criticality) {
+			metrics.LoadShed(info.FullMethod, criticality.String())
+			return errOverloaded
+		}
+		defer l.release(0, false, false)
+		return handler(server, stream)
+	}
+}
@@ -0,0 +1,434 @@
+// Package config provides the typed configuration shared by the
+// currency servers, the auth and quota services and the clients. The settings
+// are the defaults below, overridden in order by a YAML or TOML file,
+// by environment variables, and by command line flags (see Load).
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+// Config is the configuration of the services and clients
+type Config struct {
+	Currency Currency     `yaml:"currency" toml:"currency"`
+	Auth     Auth         `yaml:"auth" toml:"auth"`
+	Quota    QuotaService `yaml:"quota" toml:"quota"`
+	TLS      TLS          `yaml:"tls" toml:"tls"`
+	Client   Client       `yaml:"client" toml:"client"`
+}
+
+// Currency configures the currency servers
+type Currency struct {
+	Addr        string `yaml:"addr" toml:"addr"`
+	MetricsAddr string `yaml:"metrics_addr" toml:"metrics_addr"`
+	// AuthAddr is the address of the auth service,
+	// followed for its token revocations
+	AuthAddr   string        `yaml:"auth_addr" toml:"auth_addr"`
+	DataFile   string        `yaml:"data_file" toml:"data_file" config:"path"`
+	WALFile    string        `yaml:"wal_file" toml:"wal_file" config:"path"`
+	DataReload time.Duration `yaml:"data_reload" toml:"data_reload"`
+	PolicyFile string        `yaml:"policy_file" toml:"policy_file" config:"path"`
+	APIKeyFile string        `yaml:"api_key_file" toml:"api_key_file" config:"path"`
+	// Drain is the time given to pending calls to finish on shutdown
+	Drain time.Duration `yaml:"drain" toml:"drain"`
+	// Trace is the trace exporter: "", "stdout" or a file path
+	Trace                string `yaml:"trace" toml:"trace"`
+	MaxConcurrentStreams uint32 `yaml:"max_concurrent_streams" toml:"max_concurrent_streams"`
+	MaxRecvMsgSize       int    `yaml:"max_recv_msg_size" toml:"max_recv_msg_size"`
+	MaxSendMsgSize       int    `yaml:"max_send_msg_size" toml:"max_send_msg_size"`
+	MaxConnections       int    `yaml:"max_connections" toml:"max_connections"`
+	// RateLimit and RateBurst are the quota of each caller,
+	// MethodRateLimits the quotas of each caller per method
+	// (full or short method name). RateLimitKeys is the number
+	// of callers tracked.
+	RateLimit        float64          `yaml:"rate_limit" toml:"rate_limit"`
+	RateBurst        int              `yaml:"rate_burst" toml:"rate_burst"`
+	MethodRateLimits map[string]Quota `yaml:"method_rate_limits" toml:"method_rate_limits"`
+	RateLimitKeys    int              `yaml:"rate_limit_keys" toml:"rate_limit_keys"`
+	// ConcurrencyLimit is the initial number of calls handled at once
+	// by the servers with an adaptive concurrency limit, adapted
+	// between ConcurrencyMin and ConcurrencyMax. The limit shrinks
+	// when the latency exceeds LatencyTolerance times the long term
+	// latency. Calls over the limit wait in the admission queue of
+	// their criticality for at most ConcurrencyQueueTimeout.
+	ConcurrencyLimit        int           `yaml:"concurrency_limit" toml:"concurrency_limit"`
+	ConcurrencyMin          int           `yaml:"concurrency_min" toml:"concurrency_min"`
+	ConcurrencyMax          int           `yaml:"concurrency_max" toml:"concurrency_max"`
+	LatencyTolerance        float64       `yaml:"latency_tolerance" toml:"latency_tolerance"`
+	ConcurrencyQueueTimeout time.Duration `yaml:"concurrency_queue_timeout" toml:"concurrency_queue_timeout"`
+	// QuotaAddr is the address of the quota service sharing the rate
+	// limits across the servers, "" to only apply local limits.
+	// QuotaBatch is the number of tokens acquired at once.
+	// QuotaCertFile and QuotaKeyFile are the client certificate
+	// presented to the quota service.
+	QuotaAddr     string `yaml:"quota_addr" toml:"quota_addr"`
+	QuotaBatch    int    `yaml:"quota_batch" toml:"quota_batch"`
+	QuotaCertFile string `yaml:"quota_cert_file" toml:"quota_cert_file" config:"path"`
+	QuotaKeyFile  string `yaml:"quota_key_file" toml:"quota_key_file" config:"path"`
+}
+
+// Quota is a rate limit: Rate calls per second, in bursts of Burst calls
+type Quota struct {
+	Rate  float64 `yaml:"rate" toml:"rate"`
+	Burst int     `yaml:"burst" toml:"burst"`
+}
+
+// Auth configures the auth service. Secret, the key that signs
+// the JWT tokens, is also used by the currency servers to verify them.
+type Auth struct {
+	Addr          string        `yaml:"addr" toml:"addr"`
+	MetricsAddr   string        `yaml:"metrics_addr" toml:"metrics_addr"`
+	Secret        string        `yaml:"secret" toml:"secret"`
+	APIKeyFile    string        `yaml:"api_key_file" toml:"api_key_file" config:"path"`
+	AuditFile     string        `yaml:"audit_file" toml:"audit_file" config:"path"`
+	RevokedFile   string        `yaml:"revoked_file" toml:"revoked_file" config:"path"`
+	TokenLifetime time.Duration `yaml:"token_lifetime" toml:"token_lifetime"`
+	Drain         time.Duration `yaml:"drain" toml:"drain"`
+	Trace         string        `yaml:"trace" toml:"trace"`
+}
+
+// QuotaService configures the quota service. Lease is the time the
+// tokens granted to a server are valid, MaxKeys the number of buckets
+// kept. The quotas of the buckets are those of the currency servers
+// (Currency.RateLimit, RateBurst and MethodRateLimits). PolicyFile
+// grants the scopes of the servers' client certificates.
+type QuotaService struct {
+	Addr        string        `yaml:"addr" toml:"addr"`
+	MetricsAddr string        `yaml:"metrics_addr" toml:"metrics_addr"`
+	PolicyFile  string        `yaml:"policy_file" toml:"policy_file" config:"path"`
+	Lease       time.Duration `yaml:"lease" toml:"lease"`
+	MaxKeys     int           `yaml:"max_keys" toml:"max_keys"`
+	Drain       time.Duration `yaml:"drain" toml:"drain"`
+	Trace       string        `yaml:"trace" toml:"trace"`
+}
+
+// TLS configures the certificates of the servers
+// and the CA used to verify them
+type TLS struct {
+	CertFile string `yaml:"cert_file" toml:"cert_file" config:"path"`
+	KeyFile  string `yaml:"key_file" toml:"key_file" config:"path"`
+	CAFile   string `yaml:"ca_file" toml:"ca_file" config:"path"`
+	// CertReload is how often renewed certificates are checked for
+	CertReload time.Duration `yaml:"cert_reload" toml:"cert_reload"`
+}
+
+// Client configures the clients of the services
+type Client struct {
+	ServerAddr     string  `yaml:"server_addr" toml:"server_addr"`
+	AuthAddr       string  `yaml:"auth_addr" toml:"auth_addr"`
+	MetricsAddr    string  `yaml:"metrics_addr" toml:"metrics_addr"`
+	User           string  `yaml:"user" toml:"user"`
+	Password       string  `yaml:"password" toml:"password"`
+	RateLimit      float64 `yaml:"rate_limit" toml:"rate_limit"`
+	RateBurst      int     `yaml:"rate_burst" toml:"rate_burst"`
+	MaxRecvMsgSize int     `yaml:"max_recv_msg_size" toml:"max_recv_msg_size"`
+	MaxSendMsgSize int     `yaml:"max_send_msg_size" toml:"max_send_msg_size"`
+	// RetryMax and the Retry* settings are the retry policy of the
+	// methods, RetryMethods the policies of methods (full or short
+	// method name) whose settings left out are taken from the former.
+	// RetryCodes are status code names, i.e. "UNAVAILABLE,ABORTED".
+	// RetryStreamBuffer is the number of messages of a client stream
+	// kept to be replayed when the stream is retried.
+	RetryMax               int                    `yaml:"retry_max" toml:"retry_max"`
+	RetryInitialBackoff    time.Duration          `yaml:"retry_initial_backoff" toml:"retry_initial_backoff"`
+	RetryMaxBackoff        time.Duration          `yaml:"retry_max_backoff" toml:"retry_max_backoff"`
+	RetryBackoffMultiplier float64                `yaml:"retry_backoff_multiplier" toml:"retry_backoff_multiplier"`
+	RetryCodes             string                 `yaml:"retry_codes" toml:"retry_codes"`
+	RetryPerTryTimeout     time.Duration          `yaml:"retry_per_try_timeout" toml:"retry_per_try_timeout"`
+	RetryStreamBuffer      int                    `yaml:"retry_stream_buffer" toml:"retry_stream_buffer"`
+	RetryMethods           map[string]RetryPolicy `yaml:"retry_methods" toml:"retry_methods"`
+	// HedgeMethods are the hedged methods: a copy of a call that got
+	// no reply within HedgeDelay is sent to the next replica of
+	// ReplicaAddrs, up to HedgeMax copies, and HedgeBudget copies
+	// per call at most. A copy failed with HedgeCodes (status code
+	// names) sends the next copy right away, other failures end the
+	// call. These settings are comma separated lists.
+	ReplicaAddrs string        `yaml:"replica_addrs" toml:"replica_addrs"`
+	HedgeMethods string        `yaml:"hedge_methods" toml:"hedge_methods"`
+	HedgeDelay   time.Duration `yaml:"hedge_delay" toml:"hedge_delay"`
+	HedgeMax     int           `yaml:"hedge_max" toml:"hedge_max"`
+	HedgeBudget  float64       `yaml:"hedge_budget" toml:"hedge_budget"`
+	HedgeCodes   string        `yaml:"hedge_codes" toml:"hedge_codes"`
+	// RetryBudget is the number of retries per call at most, on
+	// average, with bursts of at most RetryBudgetBurst retries.
+	RetryBudget      float64 `yaml:"retry_budget" toml:"retry_budget"`
+	RetryBudgetBurst int     `yaml:"retry_budget_burst" toml:"retry_budget_burst"`
+	// The circuit of a method opens after BreakerFailures consecutive
+	// calls failed with BreakerCodes (comma separated status code
+	// names), half-opens after BreakerOpenTimeout, and closes once
+	// BreakerHalfOpenCalls trial calls succeeded.
+	BreakerFailures      int           `yaml:"breaker_failures" toml:"breaker_failures"`
+	BreakerOpenTimeout   time.Duration `yaml:"breaker_open_timeout" toml:"breaker_open_timeout"`
+	BreakerHalfOpenCalls int           `yaml:"breaker_half_open_calls" toml:"breaker_half_open_calls"`
+	BreakerCodes         string        `yaml:"breaker_codes" toml:"breaker_codes"`
+	Trace                string        `yaml:"trace" toml:"trace"`
+}
+
+// List returns the values of a comma separated setting
+func List(setting string) []string {
+	var values []string
+	for _, val := range strings.Split(setting, ",") {
+		if val = strings.TrimSpace(val); val != "" {
+			values = append(values, val)
+		}
+	}
+	return values
+}
+
+// RetryPolicy is the retry policy of a method
+type RetryPolicy struct {
+	MaxAttempts       int           `yaml:"max_attempts" toml:"max_attempts"`
+	InitialBackoff    time.Duration `yaml:"initial_backoff" toml:"initial_backoff"`
+	MaxBackoff        time.Duration `yaml:"max_backoff" toml:"max_backoff"`
+	BackoffMultiplier float64       `yaml:"backoff_multiplier" toml:"backoff_multiplier"`
+	Codes             string        `yaml:"codes" toml:"codes"`
+	PerTryTimeout     time.Duration `yaml:"per_try_timeout" toml:"per_try_timeout"`
+}
+
+// RetryPolicy returns the retry policy of the methods
+// that have no policy of their own
+func (c Client) RetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:       c.RetryMax,
+		InitialBackoff:    c.RetryInitialBackoff,
+		MaxBackoff:        c.RetryMaxBackoff,
+		BackoffMultiplier: c.RetryBackoffMultiplier,
+		Codes:             c.RetryCodes,
+		PerTryTimeout:     c.RetryPerTryTimeout,
+	}
+}
+
+// RetryableCodes parses the status code names of Codes
+func (p RetryPolicy) RetryableCodes() ([]codes.Code, error) {
+	return Codes(p.Codes)
+}
+
+// Codes returns the status codes of a comma separated
+// setting of status code names, i.e. "UNAVAILABLE,ABORTED"
+func Codes(setting string) ([]codes.Code, error) {
+	var parsed []codes.Code
+	for _, name := range List(setting) {
+		var code codes.Code
+		if err := code.UnmarshalJSON([]byte(strconv.Quote(strings.ToUpper(name)))); err != nil {
+			return nil, fmt.Errorf("unknown status code %s", name)
+		}
+		parsed = append(parsed, code)
+	}
+	return parsed, nil
+}
+
+// Default returns the default configuration. Its paths are relative
+// to the directory of a package (i.e. grpc_rate), where the examples
+// are run from.
+func Default() *Config {
+	return &Config{
+		Currency: Currency{
+			Addr:                 ":50051",
+			MetricsAddr:          "localhost:9051",
+			AuthAddr:             "127.0.0.1:50052",
+			DataFile:             "./../curdata.csv",
+			WALFile:              "./../curdata.wal",
+			DataReload:           5 * time.Second,
+			PolicyFile:           "./../policy.json",
+			APIKeyFile:           "./../apikeys.json",
+			Drain:                30 * time.Second,
+			MaxConcurrentStreams: 16,
+			MaxRecvMsgSize:       500 * 1024,
+			MaxSendMsgSize:       1024 * 1024,
+			MaxConnections:       500,
+			RateLimit:            500,
+			RateBurst:            100,
+			MethodRateLimits: map[string]Quota{
+				// bulk uploads are limited further
+				"SaveCurrencyStream": {Rate: 5, Burst: 2},
+			},
+			RateLimitKeys:           10000,
+			ConcurrencyLimit:        16,
+			ConcurrencyMin:          4,
+			ConcurrencyMax:          500,
+			LatencyTolerance:        2,
+			ConcurrencyQueueTimeout: 100 * time.Millisecond,
+			QuotaBatch:              10,
+			QuotaCertFile:           "./../certs/client.crt",
+			QuotaKeyFile:            "./../certs/client.key",
+		},
+		Auth: Auth{
+			Addr:          ":50052",
+			MetricsAddr:   "localhost:9052",
+			Secret:        "a1b2c3d",
+			APIKeyFile:    "./../apikeys.json",
+			AuditFile:     "./../audit.log",
+			RevokedFile:   "./../revoked.json",
+			TokenLifetime: 20 * time.Minute,
+			Drain:         30 * time.Second,
+		},
+		Quota: QuotaService{
+			Addr:        ":50053",
+			MetricsAddr: "localhost:9053",
+			PolicyFile:  "./../policy.json",
+			Lease:       2 * time.Second,
+			MaxKeys:     100000,
+			Drain:       30 * time.Second,
+		},
+		TLS: TLS{
+			CertFile:   "./../certs/server.crt",
+			KeyFile:    "./../certs/server.key",
+			CAFile:     "./../certs/ca.pem",
+			CertReload: 10 * time.Second,
+		},
+		Client: Client{
+			ServerAddr:             "127.0.0.1:50051",
+			AuthAddr:               "127.0.0.1:50052",
+			MetricsAddr:            "localhost:9061",
+			User:                   "vector",
+			Password:               "abc123",
+			RateLimit:              10,
+			RateBurst:              1,
+			MaxRecvMsgSize:         1024 * 1024,
+			MaxSendMsgSize:         500 * 1024,
+			RetryMax:               5,
+			RetryInitialBackoff:    100 * time.Millisecond,
+			RetryMaxBackoff:        2 * time.Second,
+			RetryBackoffMultiplier: 1.6,
+			RetryCodes:             "UNAVAILABLE,RESOURCE_EXHAUSTED",
+			RetryStreamBuffer:      100,
+			HedgeMethods:           "GetCurrencyList",
+			HedgeDelay:             50 * time.Millisecond,
+			HedgeMax:               2,
+			HedgeBudget:            0.1,
+			HedgeCodes:             "UNAVAILABLE",
+			RetryBudget:            0.2,
+			RetryBudgetBurst:       10,
+			BreakerFailures:        5,
+			BreakerOpenTimeout:     10 * time.Second,
+			BreakerHalfOpenCalls:   1,
+			BreakerCodes:           "UNAVAILABLE,DEADLINE_EXCEEDED",
+		},
+	}
+}
+
+// Validate returns an error listing every invalid setting
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	addr := func(name, value string) {
+		_, _, err := net.SplitHostPort(value)
+		check(err == nil, "%s: invalid address %q", name, value)
+	}
+	path := func(name, value string) {
+		check(value != "", "%s: missing path", name)
+	}
+
+	cur := c.Currency
+	addr("currency.addr", cur.Addr)
+	addr("currency.metrics_addr", cur.MetricsAddr)
+	addr("currency.auth_addr", cur.AuthAddr)
+	path("currency.data_file", cur.DataFile)
+	path("currency.wal_file", cur.WALFile)
+	path("currency.policy_file", cur.PolicyFile)
+	path("currency.api_key_file", cur.APIKeyFile)
+	check(cur.DataReload > 0, "currency.data_reload: must be positive")
+	check(cur.Drain > 0, "currency.drain: must be positive")
+	check(cur.MaxConcurrentStreams > 0, "currency.max_concurrent_streams: must be positive")
+	check(cur.MaxRecvMsgSize > 0, "currency.max_recv_msg_size: must be positive")
+	check(cur.MaxSendMsgSize > 0, "currency.max_send_msg_size: must be positive")
+	check(cur.MaxConnections > 0, "currency.max_connections: must be positive")
+	check(cur.RateLimit > 0, "currency.rate_limit: must be positive")
+	check(cur.RateBurst > 0, "currency.rate_burst: must be positive")
+	for method, quota := range cur.MethodRateLimits {
+		check(quota.Rate > 0 && quota.Burst > 0,
+			"currency.method_rate_limits: %s: rate and burst must be positive", method)
+	}
+	check(cur.RateLimitKeys > 0, "currency.rate_limit_keys: must be positive")
+	check(cur.ConcurrencyMin > 0, "currency.concurrency_min: must be positive")
+	check(cur.ConcurrencyMin <= cur.ConcurrencyLimit && cur.ConcurrencyLimit <= cur.ConcurrencyMax,
+		"currency.concurrency_limit: must be between concurrency_min and concurrency_max")
+	check(cur.LatencyTolerance > 1, "currency.latency_tolerance: must be greater than 1")
+	check(cur.ConcurrencyQueueTimeout > 0, "currency.concurrency_queue_timeout: must be positive")
+	if cur.QuotaAddr != "" {
+		addr("currency.quota_addr", cur.QuotaAddr)
+		path("currency.quota_cert_file", cur.QuotaCertFile)
+		path("currency.quota_key_file", cur.QuotaKeyFile)
+	}
+	check(cur.QuotaBatch > 0, "currency.quota_batch: must be positive")
+
+	auth := c.Auth
+	addr("auth.addr", auth.Addr)
+	addr("auth.metrics_addr", auth.MetricsAddr)
+	check(auth.Secret != "", "auth.secret: missing secret")
+	path("auth.api_key_file", auth.APIKeyFile)
+	path("auth.audit_file", auth.AuditFile)
+	path("auth.revoked_file", auth.RevokedFile)
+	check(auth.TokenLifetime > 0, "auth.token_lifetime: must be positive")
+	check(auth.Drain > 0, "auth.drain: must be positive")
+
+	quota := c.Quota
+	addr("quota.addr", quota.Addr)
+	addr("quota.metrics_addr", quota.MetricsAddr)
+	path("quota.policy_file", quota.PolicyFile)
+	check(quota.Lease > 0, "quota.lease: must be positive")
+	check(quota.MaxKeys > 0, "quota.max_keys: must be positive")
+	check(quota.Drain > 0, "quota.drain: must be positive")
+
+	path("tls.cert_file", c.TLS.CertFile)
+	path("tls.key_file", c.TLS.KeyFile)
+	path("tls.ca_file", c.TLS.CAFile)
+	check(c.TLS.CertReload > 0, "tls.cert_reload: must be positive")
+
+	clt := c.Client
+	addr("client.server_addr", clt.ServerAddr)
+	addr("client.auth_addr", clt.AuthAddr)
+	addr("client.metrics_addr", clt.MetricsAddr)
+	check(clt.User != "", "client.user: missing user")
+	check(clt.RateLimit > 0, "client.rate_limit: must be positive")
+	check(clt.RateBurst > 0, "client.rate_burst: must be positive")
+	check(clt.MaxRecvMsgSize > 0, "client.max_recv_msg_size: must be positive")
+	check(clt.MaxSendMsgSize > 0, "client.max_send_msg_size: must be positive")
+	check(clt.RetryMax > 0, "client.retry_max: must be positive")
+	check(clt.RetryInitialBackoff > 0, "client.retry_initial_backoff: must be positive")
+	check(clt.RetryMaxBackoff >= clt.RetryInitialBackoff,
+		"client.retry_max_backoff: must be at least retry_initial_backoff")
+	check(clt.RetryBackoffMultiplier >= 1, "client.retry_backoff_multiplier: must be at least 1")
+	_, err := clt.RetryPolicy().RetryableCodes()
+	check(err == nil, "client.retry_codes: %v", err)
+	check(clt.RetryPerTryTimeout >= 0, "client.retry_per_try_timeout: must not be negative")
+	check(clt.RetryStreamBuffer >= 0, "client.retry_stream_buffer: must not be negative")
+	for _, replica := range List(clt.ReplicaAddrs) {
+		addr("client.replica_addrs", replica)
+	}
+	check(clt.HedgeDelay > 0, "client.hedge_delay: must be positive")
+	check(clt.HedgeMax > 0, "client.hedge_max: must be positive")
+	check(clt.HedgeBudget >= 0 && clt.HedgeBudget <= 1, "client.hedge_budget: must be between 0 and 1")
+	_, err = Codes(clt.HedgeCodes)
+	check(err == nil, "client.hedge_codes: %v", err)
+	check(clt.RetryBudget >= 0, "client.retry_budget: must not be negative")
+	check(clt.RetryBudgetBurst > 0, "client.retry_budget_burst: must be positive")
+	check(clt.BreakerFailures > 0, "client.breaker_failures: must be positive")
+	check(clt.BreakerOpenTimeout > 0, "client.breaker_open_timeout: must be positive")
+	check(clt.BreakerHalfOpenCalls > 0, "client.breaker_half_open_calls: must be positive")
+	_, err = Codes(clt.BreakerCodes)
+	check(err == nil, "client.breaker_codes: %v", err)
+	for method, policy := range clt.RetryMethods {
+		_, err := policy.RetryableCodes()
+		check(err == nil, "client.retry_methods: %s: %v", method, err)
+		check(policy.MaxAttempts >= 0 && policy.InitialBackoff >= 0 && policy.MaxBackoff >= 0 &&
+			policy.BackoffMultiplier >= 0 && policy.PerTryTimeout >= 0,
+			"client.retry_methods: %s: settings must not be negative", method)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
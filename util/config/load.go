@@ -0,0 +1,249 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix prefixes the environment variables of the settings,
+// i.e. GOGRPC_CURRENCY_ADDR overrides setting currency.addr
+const EnvPrefix = "GOGRPC_"
+
+// ConfigEnv names the configuration file when flag -config is not set
+const ConfigEnv = EnvPrefix + "CONFIG"
+
+// Load returns the configuration of the program. The settings are the
+// defaults, overridden by the file of flag -config (or of environment
+// variable GOGRPC_CONFIG), then by the environment variables (i.e.
+// GOGRPC_AUTH_SECRET), then by the command line flags (i.e.
+// -currency.addr). The file is YAML (.yaml, .yml) or TOML (.toml), its
+// relative paths are relative to the directory of the file.
+//
+// Load registers the flags on flag.CommandLine and parses the command
+// line: programs define their own flags before calling Load. The
+// configuration is validated before it is returned.
+func Load() (*Config, error) {
+	return LoadArgs(flag.CommandLine, os.Args[1:])
+}
+
+// LoadArgs loads the configuration as Load does,
+// using flag set fs to parse args.
+func LoadArgs(fs *flag.FlagSet, args []string) (*Config, error) {
+	cfg := Default()
+	settings := settingsOf(cfg)
+
+	configFile := fs.String("config", os.Getenv(ConfigEnv), "YAML or TOML configuration file")
+	flagged := make(map[string]string)
+	for _, s := range settings {
+		if s.fileOnly {
+			continue
+		}
+		fs.Var(&flagValue{name: s.name, def: s.String(), flagged: flagged}, s.name,
+			fmt.Sprintf("`%s` setting (env %s)", s.kind(), s.env))
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *configFile != "" {
+		if err := loadFile(cfg, *configFile); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range settings {
+		if s.fileOnly {
+			continue
+		}
+		if val, ok := os.LookupEnv(s.env); ok {
+			if err := s.set(val); err != nil {
+				return nil, fmt.Errorf("env %s: %v", s.env, err)
+			}
+		}
+	}
+	for _, s := range settings {
+		if val, ok := flagged[s.name]; ok {
+			if err := s.set(val); err != nil {
+				return nil, fmt.Errorf("flag -%s: %v", s.name, err)
+			}
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loadFile overrides the settings of cfg with
+// the settings found in the configuration file
+func loadFile(cfg *Config, path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	// defined tells whether the file sets the key of a section,
+	// so that the file can also set zero values (i.e. 0, "")
+	fromFile := new(Config)
+	var defined func(section, key string) bool
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(fromFile); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		var keys map[string]map[string]interface{}
+		if err := yaml.Unmarshal(data, &keys); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		defined = func(section, key string) bool {
+			_, ok := keys[section][key]
+			return ok
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(data), fromFile)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("%s: unknown setting %s", path, undecoded[0])
+		}
+		defined = func(section, key string) bool {
+			return meta.IsDefined(section, key)
+		}
+	default:
+		return fmt.Errorf("%s: unsupported configuration file, expecting .yaml or .toml", path)
+	}
+
+	// settings left out of the file keep their value
+	dir := filepath.Dir(path)
+	fileSettings := settingsOf(fromFile)
+	for i, s := range settingsOf(cfg) {
+		section := s.name[:strings.Index(s.name, ".")]
+		if !defined(section, s.name[len(section)+1:]) {
+			continue
+		}
+		val := fileSettings[i].value
+		if s.path && val.String() != "" && !filepath.IsAbs(val.String()) {
+			val = reflect.ValueOf(filepath.Join(dir, val.String()))
+		}
+		s.value.Set(val)
+	}
+	return nil
+}
+
+// setting is a settable field of a Config
+type setting struct {
+	name     string // i.e. currency.addr
+	env      string // i.e. GOGRPC_CURRENCY_ADDR
+	path     bool   // the setting is a file path
+	fileOnly bool   // the setting (i.e. a map) is only set from the file
+	value    reflect.Value
+}
+
+// settingsOf returns the settings of cfg, section by section,
+// in the order the fields are declared
+func settingsOf(cfg *Config) []setting {
+	var settings []setting
+	sections := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < sections.NumField(); i++ {
+		section := sections.Type().Field(i).Tag.Get("yaml")
+		fields := sections.Field(i)
+		for j := 0; j < fields.NumField(); j++ {
+			field := fields.Type().Field(j)
+			name := section + "." + field.Tag.Get("yaml")
+			settings = append(settings, setting{
+				name:     name,
+				env:      EnvPrefix + strings.ToUpper(strings.Replace(name, ".", "_", -1)),
+				path:     field.Tag.Get("config") == "path",
+				fileOnly: field.Type.Kind() == reflect.Map,
+				value:    fields.Field(j),
+			})
+		}
+	}
+	return settings
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// set parses val into the setting according to its type
+func (s setting) set(val string) error {
+	switch {
+	case s.value.Type() == durationType:
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return err
+		}
+		s.value.SetInt(int64(d))
+	case s.value.Kind() == reflect.String:
+		s.value.SetString(val)
+	case s.value.Kind() == reflect.Int:
+		i, err := strconv.Atoi(val)
+		if err != nil {
+			return err
+		}
+		s.value.SetInt(int64(i))
+	case s.value.Kind() == reflect.Uint32:
+		u, err := strconv.ParseUint(val, 10, 32)
+		if err != nil {
+			return err
+		}
+		s.value.SetUint(u)
+	case s.value.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return err
+		}
+		s.value.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported setting type %s", s.value.Type())
+	}
+	return nil
+}
+
+// kind names the type of the setting in the flags usage
+func (s setting) kind() string {
+	switch {
+	case s.value.Type() == durationType:
+		return "duration"
+	case s.value.Kind() == reflect.Uint32:
+		return "uint"
+	case s.value.Kind() == reflect.Float64:
+		return "float"
+	default:
+		return s.value.Kind().String()
+	}
+}
+
+func (s setting) String() string {
+	return fmt.Sprint(s.value.Interface())
+}
+
+// flagValue records the value of a setting set on the command
+// line, so that flags are applied after the file and environment
+type flagValue struct {
+	name    string
+	def     string
+	flagged map[string]string
+}
+
+func (f *flagValue) String() string {
+	return f.def
+}
+
+func (f *flagValue) Set(val string) error {
+	f.flagged[f.name] = val
+	return nil
+}
@@ -0,0 +1,140 @@
+package util
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// CriticalityHeader is the metadata header that carries
+// the criticality of a call
+const CriticalityHeader = "x-criticality"
+
+// CriticalScope is the scope a caller must be granted for its
+// calls to be handled as critical (see CriticalityFromContext)
+const CriticalScope = "calls.critical"
+
+// Criticality tells how important a call is to its caller. Under
+// load, the servers shed the sheddable calls first and the critical
+// calls last. The zero value is CriticalityDefault.
+type Criticality int
+
+const (
+	// CriticalitySheddable calls can be retried later without harm,
+	// i.e. bulk imports
+	CriticalitySheddable Criticality = iota - 1
+	// CriticalityDefault is the criticality of the calls that carry none
+	CriticalityDefault
+	// CriticalityCritical calls are needed to serve users, i.e. lookups
+	CriticalityCritical
+)
+
+// Criticalities lists the criticalities, least critical first
+var Criticalities = []Criticality{CriticalitySheddable, CriticalityDefault, CriticalityCritical}
+
+func (c Criticality) String() string {
+	switch c {
+	case CriticalitySheddable:
+		return "sheddable"
+	case CriticalityCritical:
+		return "critical"
+	default:
+		return "default"
+	}
+}
+
+// ParseCriticality returns the criticality named s,
+// CriticalityDefault when s names none
+func ParseCriticality(s string) Criticality {
+	switch s {
+	case "sheddable":
+		return CriticalitySheddable
+	case "critical":
+		return CriticalityCritical
+	default:
+		return CriticalityDefault
+	}
+}
+
+type criticalityKey struct{}
+
+// NewCriticalityContext returns a copy of ctx that carries the
+// criticality of the calls made with it
+func NewCriticalityContext(ctx context.Context, c Criticality) context.Context {
+	return context.WithValue(ctx, criticalityKey{}, c)
+}
+
+// CriticalityFromContext returns the criticality of the calls made with
+// ctx: the criticality attached to ctx or, so that a server propagates
+// the criticality of the call it serves to the calls it makes, the
+// criticality sent by its caller. The header is sent by any caller, so
+// a call is only critical when the identity attached to ctx by the
+// authentication stage was granted CriticalScope; the calls of other
+// callers, including those not authenticated yet, are downgraded to
+// CriticalityDefault. Servers read it once the caller is authenticated.
+func CriticalityFromContext(ctx context.Context) Criticality {
+	if c, ok := ctx.Value(criticalityKey{}).(Criticality); ok {
+		return c
+	}
+	meta, _ := metadata.FromIncomingContext(ctx)
+	c := CriticalityFromMD(meta)
+	if c > CriticalityDefault {
+		if id, _ := IdentityFromContext(ctx); !id.HasScope(CriticalScope) {
+			return CriticalityDefault
+		}
+	}
+	return c
+}
+
+// CriticalityFromMD returns the criticality sent in the x-criticality
+// header of md, CriticalityDefault when there is none. It is claimed by
+// the caller: it is only trusted where claiming a higher criticality
+// cannot get a call more than a caller that claims a lower one.
+func CriticalityFromMD(md metadata.MD) Criticality {
+	vals := md.Get(CriticalityHeader)
+	if len(vals) == 0 {
+		return CriticalityDefault
+	}
+	return ParseCriticality(vals[0])
+}
+
+// CriticalityUnaryClientIntercept returns a unary client interceptor
+// that sends the criticality of the call (see CriticalityFromContext)
+// in the x-criticality header.
+func CriticalityUnaryClientIntercept() grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply interface{},
+		conn *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		return invoker(outgoingCriticality(ctx), method, req, reply, conn, opts...)
+	}
+}
+
+// CriticalityStreamClientIntercept returns a stream client interceptor
+// that sends the criticality of the stream in the x-criticality header.
+func CriticalityStreamClientIntercept() grpc.StreamClientInterceptor {
+	return func(
+		ctx context.Context,
+		desc *grpc.StreamDesc,
+		conn *grpc.ClientConn,
+		method string,
+		streamer grpc.Streamer,
+		opts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		return streamer(outgoingCriticality(ctx), desc, conn, method, opts...)
+	}
+}
+
+// outgoingCriticality returns ctx with the criticality of the call
+// added to the outgoing metadata, the default is left implicit
+func outgoingCriticality(ctx context.Context) context.Context {
+	c := CriticalityFromContext(ctx)
+	if c == CriticalityDefault {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, CriticalityHeader, c.String())
+}
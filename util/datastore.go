@@ -2,47 +2,240 @@ package util
 
 import (
 	"encoding/csv"
+	"errors"
 	"io"
+	"log"
 	"os"
 	"strconv"
 	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	pb "github.com/vladimirvivien/go-grpc/protobuf"
 )
 
+// tracerName is the name of the tracer of the data store spans
+const tracerName = "github.com/vladimirvivien/go-grpc/util"
+
 type DataStore struct {
 	mtx      sync.Mutex
 	dataFile string
 	data     []*pb.Currency
+	loaded   time.Time
+	modTime  time.Time
+	onLoad   []func(loading bool)
+
+	// write-ahead log of the added currencies, if any
+	walFile string
+	wal     *os.File
 }
 
 func NewDataStore(file string) *DataStore {
 	return &DataStore{dataFile: file}
 }
 
+// Load reads the data file into the store. The functions registered
+// with OnLoad are called before and after the data is loaded. When the
+// load fails, the store keeps the data previously loaded, if any.
 func (ds *DataStore) Load() error {
+	ds.notify(true)
+	defer ds.notify(false)
+
+	info, err := os.Stat(ds.dataFile)
+	if err != nil {
+		return err
+	}
 	data, err := LoadPbFromCsv(ds.dataFile)
 	if err != nil {
 		return err
 	}
-	ds.data = data
+
+	ds.mtx.Lock()
+	defer ds.mtx.Unlock()
+	// replay the currencies added since the data file was written
+	if ds.walFile != "" {
+		added, err := LoadPbFromCsv(ds.walFile)
+		if err != nil {
+			return err
+		}
+		data = append(data, added...)
+	}
+	ds.data, ds.loaded, ds.modTime = data, time.Now(), info.ModTime()
 	return nil
 }
 
-func (ds *DataStore) Search(code string, number int32) []*pb.Currency {
+// OpenLog opens, or creates, the write-ahead log of the store at
+// path. Currencies added to the store are appended to the log, in
+// the csv format of the data file, before they are added to the
+// store, and the log is replayed each time the store is loaded.
+// OpenLog should be called before Load.
+func (ds *DataStore) OpenLog(path string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	ds.mtx.Lock()
+	ds.walFile, ds.wal = path, file
+	ds.mtx.Unlock()
+	return nil
+}
+
+// Flush commits the write-ahead log, if any, to stable storage.
+// Added currencies are written to the log right away, they survive
+// the crash of the process; Flush protects them from a system crash.
+func (ds *DataStore) Flush() error {
+	ds.mtx.Lock()
+	defer ds.mtx.Unlock()
+	if ds.wal == nil {
+		return nil
+	}
+	return ds.wal.Sync()
+}
+
+// Close flushes then closes the write-ahead log, if any.
+// Currencies can no longer be added once the store is closed.
+func (ds *DataStore) Close() error {
+	if err := ds.Flush(); err != nil {
+		return err
+	}
+	ds.mtx.Lock()
+	defer ds.mtx.Unlock()
+	if ds.wal == nil {
+		return nil
+	}
+	err := ds.wal.Close()
+	ds.wal = nil
+	return err
+}
+
+// OnLoad registers fn to be called with loading set to true when
+// the store starts loading its data, and false once it is done.
+func (ds *DataStore) OnLoad(fn func(loading bool)) {
+	ds.mtx.Lock()
+	ds.onLoad = append(ds.onLoad, fn)
+	ds.mtx.Unlock()
+}
+
+func (ds *DataStore) notify(loading bool) {
+	ds.mtx.Lock()
+	onLoad := ds.onLoad
+	ds.mtx.Unlock()
+	for _, fn := range onLoad {
+		fn(loading)
+	}
+}
+
+// Watch reloads the data file every interval when it has been
+// modified since last loaded. Watch runs until stop is closed.
+func (ds *DataStore) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			info, err := os.Stat(ds.dataFile)
+			if err != nil {
+				continue
+			}
+			ds.mtx.Lock()
+			changed := !info.ModTime().Equal(ds.modTime)
+			ds.mtx.Unlock()
+			if !changed {
+				continue
+			}
+			log.Println("reloading", ds.dataFile)
+			if err := ds.Load(); err != nil {
+				log.Println("failed to reload data:", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Len returns the number of currency items in the store
+func (ds *DataStore) Len() int {
+	ds.mtx.Lock()
+	defer ds.mtx.Unlock()
+	return len(ds.data)
+}
+
+// LoadedAt returns the time the data was last loaded
+func (ds *DataStore) LoadedAt() time.Time {
+	ds.mtx.Lock()
+	defer ds.mtx.Unlock()
+	return ds.loaded
+}
+
+// Search returns the currencies matching code or number. The search
+// is recorded as a span of the trace carried by ctx, if any.
+func (ds *DataStore) Search(ctx context.Context, code string, number int32) []*pb.Currency {
+	_, span := otel.Tracer(tracerName).Start(ctx, "DataStore.Search",
+		trace.WithAttributes(
+			attribute.String("currency.code", code),
+			attribute.Int("currency.number", int(number)),
+		),
+	)
+	defer span.End()
+
+	ds.mtx.Lock()
+	defer ds.mtx.Unlock()
 	var items []*pb.Currency
 	for _, cur := range ds.data {
 		if cur.GetNumber() == number || cur.GetCode() == code {
 			items = append(items, cur)
 		}
 	}
+	span.SetAttributes(attribute.Int("currency.results", len(items)))
 	return items
 }
 
-func (ds *DataStore) Add(items []*pb.Currency) {
+// ResumeAfter returns the items of a resumed stream: the items that
+// follow the item of token (see pb.ResumeToken), or all the items when
+// token is empty. The stream cannot resume when no item has the token.
+func ResumeAfter(items []*pb.Currency, token string) ([]*pb.Currency, error) {
+	if token == "" {
+		return items, nil
+	}
+	for i, cur := range items {
+		if pb.ResumeToken(cur) == token {
+			return items[i+1:], nil
+		}
+	}
+	return nil, status.Errorf(codes.InvalidArgument, "invalid resume token %q", token)
+}
+
+// Add adds items to the store. When the store has a write-ahead
+// log, items are only added once they are written to the log.
+func (ds *DataStore) Add(items []*pb.Currency) error {
 	ds.mtx.Lock()
-	copy(ds.data, items)
-	ds.mtx.Unlock()
+	defer ds.mtx.Unlock()
+	if ds.walFile != "" {
+		if ds.wal == nil {
+			return errors.New("data store closed")
+		}
+		writer := csv.NewWriter(ds.wal)
+		for _, cur := range items {
+			writer.Write([]string{
+				cur.GetCountry(),
+				cur.GetName(),
+				cur.GetCode(),
+				strconv.Itoa(int(cur.GetNumber())),
+			})
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return err
+		}
+	}
+	ds.data = append(ds.data, items...)
+	return nil
 }
 
 // LoadPbFromCsv loads the currency data from csv into protobuf values
@@ -0,0 +1,109 @@
+package util
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Names of the services reported by the health service
+const (
+	CurrencyServiceName = "protobuf.CurrencyService"
+	AuthServiceName     = "protobuf.Auth"
+	QuotaServiceName    = "protobuf.QuotaService"
+)
+
+// RegisterHealth registers the standard health service
+// (grpc.health.v1.Health) on srv and returns it. The named services,
+// and the server as a whole (the empty service name), are reported
+// NOT_SERVING until ds is loaded, and while ds reloads its data. When
+// ds is nil, the services are reported SERVING right away.
+func RegisterHealth(srv *grpc.Server, ds *DataStore, services ...string) *health.Server {
+	hs := health.NewServer()
+	healthpb.RegisterHealthServer(srv, hs)
+
+	services = append(services, "")
+	setStatus := func(stat healthpb.HealthCheckResponse_ServingStatus) {
+		for _, service := range services {
+			hs.SetServingStatus(service, stat)
+		}
+	}
+	if ds == nil {
+		setStatus(healthpb.HealthCheckResponse_SERVING)
+		return hs
+	}
+
+	setStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+	ds.OnLoad(func(loading bool) {
+		// a failed (re)load leaves the store with
+		// the data it had, serve it if there is any
+		if loading || ds.LoadedAt().IsZero() {
+			setStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+			return
+		}
+		setStatus(healthpb.HealthCheckResponse_SERVING)
+	})
+	return hs
+}
+
+// IsHealthMethod returns true if fullMethod is a method of the health
+// service. Health checks are made by probes that carry no credentials,
+// they are not subject to authentication nor to rate limits.
+func IsHealthMethod(fullMethod string) bool {
+	return strings.HasPrefix(fullMethod, "/grpc.health.v1.Health/")
+}
+
+// StopOnSignal stops srv gracefully when the process receives SIGINT
+// or SIGTERM. All services are first reported NOT_SERVING so that
+// health checks fail, then the server stops accepting connections and
+// calls and waits for the pending calls to finish (GracefulStop). The
+// calls still pending after drain are closed (Stop). The cleanup funcs
+// (i.e. flushing a DataStore) are called once the server is stopped.
+//
+// Serve returns as soon as the server stops accepting connections;
+// the returned channel is closed once the shutdown is complete, main
+// should wait on it before exiting.
+func StopOnSignal(
+	srv *grpc.Server,
+	hs *health.Server,
+	drain time.Duration,
+	cleanup ...func() error,
+) <-chan struct{} {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		sig := <-sigs
+		log.Println("received", sig, "draining calls for at most", drain)
+		hs.Shutdown()
+
+		drained := make(chan struct{})
+		go func() {
+			srv.GracefulStop()
+			close(drained)
+		}()
+		select {
+		case <-drained:
+			log.Println("all calls completed, server stopped")
+		case <-time.After(drain):
+			log.Println("drain deadline exceeded, closing pending calls")
+			srv.Stop()
+			<-drained
+		}
+
+		for _, fn := range cleanup {
+			if err := fn(); err != nil {
+				log.Println("shutdown:", err)
+			}
+		}
+	}()
+	return stopped
+}
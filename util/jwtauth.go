@@ -1,6 +1,10 @@
 package util
 
 import (
+	"fmt"
+	"strings"
+
+	jwt "github.com/dgrijalva/jwt-go"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc/credentials"
 )
@@ -27,3 +31,49 @@ func (jwt jwtCreds) GetRequestMetadata(
 func (j jwtCreds) RequireTransportSecurity() bool {
 	return true
 }
+
+// apiKeyCreds implements the gRPC credentials.PerRPCCredentials interface.
+// It can be used to inject an API key into the "x-api-key" metadata header.
+type apiKeyCreds struct {
+	key string
+}
+
+func NewApiKeyCreds(key string) credentials.PerRPCCredentials {
+	return apiKeyCreds{key}
+}
+
+func (k apiKeyCreds) GetRequestMetadata(
+	ctx context.Context,
+	uri ...string,
+) (map[string]string, error) {
+	return map[string]string{
+		"x-api-key": k.key,
+	}, nil
+}
+
+func (k apiKeyCreds) RequireTransportSecurity() bool {
+	return true
+}
+
+// IdentityFromJwt builds an Identity from the "sub", "roles",
+// and "scope" claims of a validated JWT token. Scopes are
+// encoded as a space-delimited string (see RFC 8693).
+func IdentityFromJwt(token *jwt.Token) (*Identity, error) {
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fmt.Errorf("unexpected claims type")
+	}
+	id := new(Identity)
+	id.Subject, _ = claims["sub"].(string)
+	if roles, ok := claims["roles"].([]interface{}); ok {
+		for _, role := range roles {
+			if r, ok := role.(string); ok {
+				id.Roles = append(id.Roles, r)
+			}
+		}
+	}
+	if scope, ok := claims["scope"].(string); ok {
+		id.Scopes = strings.Fields(scope)
+	}
+	return id, nil
+}
@@ -0,0 +1,175 @@
+package logging
+
+import (
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/vladimirvivien/go-grpc/util"
+)
+
+// UnaryClientIntercept returns a unary client interceptor that logs
+// each call once it completes. The request id stored in ctx (see
+// util.NewRequestIDContext), or a new one, is sent in the x-request-id header.
+func UnaryClientIntercept(opts Options) grpc.UnaryClientInterceptor {
+	redact := opts.redactFields()
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply interface{},
+		conn *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		callOpts ...grpc.CallOption,
+	) error {
+		start := time.Now()
+		ctx, requestID := clientRequestID(ctx)
+
+		err := invoker(ctx, method, req, reply, conn, callOpts...)
+
+		code := status.Code(err)
+		if !opts.sampled(code) {
+			return err
+		}
+		attrs := clientAttrs(conn, method, "unary", requestID)
+		attrs = append(attrs,
+			slog.String(FieldCode, code.String()),
+			duration(start),
+			slog.Int(FieldRequestSize, size(req)),
+		)
+		if err == nil {
+			attrs = append(attrs, slog.Int(FieldResponseSize, size(reply)))
+		} else {
+			attrs = append(attrs, slog.String(FieldError, status.Convert(err).Message()))
+		}
+		if opts.LogPayloads {
+			attrs = append(attrs, slog.Any(FieldRequest, payload(req, redact)))
+			if err == nil {
+				attrs = append(attrs, slog.Any(FieldResponse, payload(reply, redact)))
+			}
+		}
+		opts.logger().LogAttrs(ctx, level(code), "finished call", attrs...)
+		return err
+	}
+}
+
+// StreamClientIntercept returns a stream client interceptor that logs
+// each stream once it completes, that is when the last message is
+// received or the stream fails.
+func StreamClientIntercept(opts Options) grpc.StreamClientInterceptor {
+	return func(
+		ctx context.Context,
+		desc *grpc.StreamDesc,
+		conn *grpc.ClientConn,
+		method string,
+		streamer grpc.Streamer,
+		callOpts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		start := time.Now()
+		ctx, requestID := clientRequestID(ctx)
+		mtype := methodType(desc.ClientStreams, desc.ServerStreams)
+
+		stream, err := streamer(ctx, desc, conn, method, callOpts...)
+		counted := &clientStream{
+			ClientStream: stream,
+			serverStream: desc.ServerStreams,
+		}
+		counted.finish = func(err error) {
+			code := status.Code(err)
+			if !opts.sampled(code) {
+				return
+			}
+			attrs := clientAttrs(conn, method, mtype, requestID)
+			attrs = append(attrs,
+				slog.String(FieldCode, code.String()),
+				duration(start),
+				slog.Int64(FieldRequestSize, counted.sentBytes.Load()),
+				slog.Int64(FieldResponseSize, counted.recvBytes.Load()),
+				slog.Int64(FieldMsgsSent, counted.sent.Load()),
+				slog.Int64(FieldMsgsReceived, counted.recv.Load()),
+			)
+			if err != nil {
+				attrs = append(attrs, slog.String(FieldError, status.Convert(err).Message()))
+			}
+			opts.logger().LogAttrs(ctx, level(code), "finished call", attrs...)
+		}
+		if err != nil {
+			counted.done(err)
+			return nil, err
+		}
+		return counted, nil
+	}
+}
+
+// clientRequestID returns ctx with the request id added to
+// the outgoing metadata. A new id is used if ctx has none.
+func clientRequestID(ctx context.Context) (context.Context, string) {
+	requestID := util.RequestIDFromContext(ctx)
+	if requestID == "" {
+		requestID = util.NewRequestID()
+		ctx = util.NewRequestIDContext(ctx, requestID)
+	}
+	return metadata.AppendToOutgoingContext(ctx, util.RequestIDHeader, requestID), requestID
+}
+
+func clientAttrs(conn *grpc.ClientConn, method, mtype, requestID string) []slog.Attr {
+	return []slog.Attr{
+		slog.String(FieldComponent, "client"),
+		slog.String(FieldMethod, method),
+		slog.String(FieldMethodType, mtype),
+		slog.String(FieldRequestID, requestID),
+		slog.String(FieldPeer, conn.Target()),
+	}
+}
+
+// clientStream counts the messages, and their size, sent and
+// received on a stream and logs the stream once it completes.
+type clientStream struct {
+	grpc.ClientStream
+	serverStream         bool
+	sent, recv           atomic.Int64
+	sentBytes, recvBytes atomic.Int64
+	finish               func(error)
+	once                 sync.Once
+}
+
+func (s *clientStream) done(err error) {
+	s.once.Do(func() { s.finish(err) })
+}
+
+func (s *clientStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == nil {
+		s.sent.Add(1)
+		s.sentBytes.Add(int64(size(m)))
+	} else if err != io.EOF {
+		// io.EOF means the stream failed, its status
+		// is returned by RecvMsg
+		s.done(err)
+	}
+	return err
+}
+
+func (s *clientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	switch {
+	case err == nil:
+		s.recv.Add(1)
+		s.recvBytes.Add(int64(size(m)))
+		// without server streaming, the single response ends the call
+		if !s.serverStream {
+			s.done(nil)
+		}
+	case err == io.EOF:
+		s.done(nil)
+	default:
+		s.done(err)
+	}
+	return err
+}
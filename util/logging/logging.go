@@ -0,0 +1,173 @@
+// Package logging provides gRPC client and server interceptors that
+// log each call as a structured log/slog record. Client and server
+// records use the same field names so that both sides of a call can
+// be correlated, i.e. with the request id sent in the x-request-id
+// metadata header (see util.RequestIDHeader).
+package logging
+
+import (
+	"encoding/json"
+	"log/slog"
+	mrand "math/rand"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc/codes"
+)
+
+// Field names used by client and server records
+const (
+	FieldComponent    = "grpc.component"
+	FieldMethod       = "grpc.method"
+	FieldMethodType   = "grpc.method_type"
+	FieldPeer         = "grpc.peer"
+	FieldSubject      = "grpc.subject"
+	FieldRequestID    = "grpc.request_id"
+	FieldCode         = "grpc.code"
+	FieldError        = "grpc.error"
+	FieldDuration     = "grpc.duration_ms"
+	FieldRequestSize  = "grpc.request.size"
+	FieldResponseSize = "grpc.response.size"
+	FieldMsgsSent     = "grpc.stream.msgs_sent"
+	FieldMsgsReceived = "grpc.stream.msgs_received"
+	FieldRequest      = "grpc.request"
+	FieldResponse     = "grpc.response"
+)
+
+// DefaultRedactFields lists the payload fields, by proto name,
+// whose values are never logged.
+var DefaultRedactFields = []string{"pwd", "password", "token", "key", "secret"}
+
+// Options configures the logging interceptors
+type Options struct {
+	// Logger receives the records, slog.Default() when nil
+	Logger *slog.Logger
+
+	// SampleRate is the fraction, between 0 and 1, of successful
+	// calls that are logged. Failed calls are always logged.
+	// A zero value logs all calls.
+	SampleRate float64
+
+	// LogPayloads adds the request and response messages of unary
+	// calls to the records. Stream messages are never logged.
+	LogPayloads bool
+
+	// RedactFields lists the payload fields (proto names) whose
+	// values are replaced, DefaultRedactFields when nil.
+	RedactFields []string
+}
+
+func (o *Options) logger() *slog.Logger {
+	if o.Logger != nil {
+		return o.Logger
+	}
+	return slog.Default()
+}
+
+// sampled returns true if a call that ended with code is logged
+func (o *Options) sampled(code codes.Code) bool {
+	if code != codes.OK || o.SampleRate <= 0 || o.SampleRate >= 1 {
+		return true
+	}
+	return mrand.Float64() < o.SampleRate
+}
+
+func (o *Options) redactFields() map[string]bool {
+	fields := o.RedactFields
+	if fields == nil {
+		fields = DefaultRedactFields
+	}
+	redact := make(map[string]bool)
+	for _, f := range fields {
+		redact[strings.ToLower(f)] = true
+	}
+	return redact
+}
+
+// level maps status codes to log levels: errors caused by the
+// caller are warnings while server-side failures are errors.
+func level(code codes.Code) slog.Level {
+	switch code {
+	case codes.OK:
+		return slog.LevelInfo
+	case codes.Unknown, codes.DeadlineExceeded, codes.Unimplemented,
+		codes.Internal, codes.Unavailable, codes.DataLoss:
+		return slog.LevelError
+	default:
+		return slog.LevelWarn
+	}
+}
+
+func methodType(clientStream, serverStream bool) string {
+	switch {
+	case clientStream && serverStream:
+		return "bidi_stream"
+	case clientStream:
+		return "client_stream"
+	case serverStream:
+		return "server_stream"
+	default:
+		return "unary"
+	}
+}
+
+func duration(start time.Time) slog.Attr {
+	return slog.Float64(FieldDuration, float64(time.Since(start))/float64(time.Millisecond))
+}
+
+// message returns msg as a protobuf message, if it is a non-nil one.
+// Handlers return typed nil messages along with errors.
+func message(msg interface{}) (proto.Message, bool) {
+	pm, ok := msg.(proto.Message)
+	if !ok || pm == nil || reflect.ValueOf(pm).IsNil() {
+		return nil, false
+	}
+	return pm, true
+}
+
+// size returns the encoded size of a protobuf message
+func size(msg interface{}) int {
+	if pm, ok := message(msg); ok {
+		return proto.Size(pm)
+	}
+	return 0
+}
+
+// payload returns msg as a JSON value with the redacted fields replaced
+func payload(msg interface{}, redact map[string]bool) interface{} {
+	pm, ok := message(msg)
+	if !ok {
+		return nil
+	}
+	marshaler := jsonpb.Marshaler{OrigName: true}
+	data, err := marshaler.MarshalToString(pm)
+	if err != nil {
+		return nil
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(data), &value); err != nil {
+		return nil
+	}
+	return redactValue(value, redact)
+}
+
+func redactValue(value interface{}, redact map[string]bool) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, val := range v {
+			if redact[strings.ToLower(key)] {
+				v[key] = "REDACTED"
+				continue
+			}
+			v[key] = redactValue(val, redact)
+		}
+	case []interface{}:
+		for i, val := range v {
+			v[i] = redactValue(val, redact)
+		}
+	}
+	return value
+}
@@ -0,0 +1,147 @@
+package logging
+
+import (
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/vladimirvivien/go-grpc/util"
+)
+
+// UnaryServerIntercept returns a unary server interceptor that logs
+// each call once it completes. The request id is read from the
+// x-request-id header, or generated, and returned as a header.
+// The subject is reported when an authentication interceptor,
+// placed after this one, attaches the caller's identity.
+func UnaryServerIntercept(opts Options) grpc.UnaryServerInterceptor {
+	redact := opts.redactFields()
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		start := time.Now()
+		ctx, requestID := util.IncomingRequestID(ctx)
+		grpc.SetHeader(ctx, metadata.Pairs(util.RequestIDHeader, requestID))
+		ctx, subject := util.WithIdentitySlot(ctx)
+
+		resp, err := handler(ctx, req)
+
+		code := status.Code(err)
+		if !opts.sampled(code) {
+			return resp, err
+		}
+		attrs := serverAttrs(ctx, info.FullMethod, "unary", requestID, subject())
+		attrs = append(attrs,
+			slog.String(FieldCode, code.String()),
+			duration(start),
+			slog.Int(FieldRequestSize, size(req)),
+			slog.Int(FieldResponseSize, size(resp)),
+		)
+		if err != nil {
+			attrs = append(attrs, slog.String(FieldError, status.Convert(err).Message()))
+		}
+		if opts.LogPayloads {
+			attrs = append(attrs,
+				slog.Any(FieldRequest, payload(req, redact)),
+				slog.Any(FieldResponse, payload(resp, redact)),
+			)
+		}
+		opts.logger().LogAttrs(ctx, level(code), "finished call", attrs...)
+		return resp, err
+	}
+}
+
+// StreamServerIntercept returns a stream server interceptor that
+// logs each stream once it completes, along with the number and
+// size of the messages sent and received.
+func StreamServerIntercept(opts Options) grpc.StreamServerInterceptor {
+	return func(
+		server interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		start := time.Now()
+		ctx, requestID := util.IncomingRequestID(stream.Context())
+		stream.SetHeader(metadata.Pairs(util.RequestIDHeader, requestID))
+		ctx, subject := util.WithIdentitySlot(ctx)
+		counted := &serverStream{ServerStream: stream, ctx: ctx}
+
+		err := handler(server, counted)
+
+		code := status.Code(err)
+		if !opts.sampled(code) {
+			return err
+		}
+		mtype := methodType(info.IsClientStream, info.IsServerStream)
+		attrs := serverAttrs(ctx, info.FullMethod, mtype, requestID, subject())
+		attrs = append(attrs,
+			slog.String(FieldCode, code.String()),
+			duration(start),
+			slog.Int64(FieldRequestSize, counted.recvBytes.Load()),
+			slog.Int64(FieldResponseSize, counted.sentBytes.Load()),
+			slog.Int64(FieldMsgsSent, counted.sent.Load()),
+			slog.Int64(FieldMsgsReceived, counted.recv.Load()),
+		)
+		if err != nil {
+			attrs = append(attrs, slog.String(FieldError, status.Convert(err).Message()))
+		}
+		opts.logger().LogAttrs(ctx, level(code), "finished call", attrs...)
+		return err
+	}
+}
+
+func serverAttrs(ctx context.Context, method, mtype, requestID string, id *util.Identity) []slog.Attr {
+	attrs := []slog.Attr{
+		slog.String(FieldComponent, "server"),
+		slog.String(FieldMethod, method),
+		slog.String(FieldMethodType, mtype),
+		slog.String(FieldRequestID, requestID),
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		attrs = append(attrs, slog.String(FieldPeer, p.Addr.String()))
+	}
+	if id != nil {
+		attrs = append(attrs, slog.String(FieldSubject, id.Subject))
+	}
+	return attrs
+}
+
+// serverStream counts the messages, and their size, sent and
+// received on a stream and overrides the stream's context.
+type serverStream struct {
+	grpc.ServerStream
+	ctx                  context.Context
+	sent, recv           atomic.Int64
+	sentBytes, recvBytes atomic.Int64
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *serverStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.sent.Add(1)
+		s.sentBytes.Add(int64(size(m)))
+	}
+	return err
+}
+
+func (s *serverStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.recv.Add(1)
+		s.recvBytes.Add(int64(size(m)))
+	}
+	return err
+}
@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"github.com/vladimirvivien/go-grpc/util/streams"
+)
+
+// UnaryClientIntercept returns a unary client interceptor
+// that records the count and latency of calls.
+func UnaryClientIntercept() grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		fullMethod string,
+		req, reply interface{},
+		conn *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		service, method := splitMethod(fullMethod)
+		clientStarted.WithLabelValues("unary", service, method).Inc()
+		start := time.Now()
+
+		err := invoker(ctx, fullMethod, req, reply, conn, opts...)
+
+		clientHandling.WithLabelValues("unary", service, method).Observe(time.Since(start).Seconds())
+		clientHandled.WithLabelValues("unary", service, method, status.Code(err).String()).Inc()
+		return err
+	}
+}
+
+// StreamClientIntercept returns a stream client interceptor that
+// records the count and latency of calls and the messages streamed.
+// A stream is done when RecvMsg returns an error (io.EOF included), or
+// its single response without server streaming.
+func StreamClientIntercept() grpc.StreamClientInterceptor {
+	return func(
+		ctx context.Context,
+		desc *grpc.StreamDesc,
+		conn *grpc.ClientConn,
+		fullMethod string,
+		streamer grpc.Streamer,
+		opts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		mtype := methodType(desc.ClientStreams, desc.ServerStreams)
+		service, method := splitMethod(fullMethod)
+		clientStarted.WithLabelValues(mtype, service, method).Inc()
+		start := time.Now()
+
+		stream, err := streamer(ctx, desc, conn, fullMethod, opts...)
+		if err != nil {
+			clientHandling.WithLabelValues(mtype, service, method).Observe(time.Since(start).Seconds())
+			clientHandled.WithLabelValues(mtype, service, method, status.Code(err).String()).Inc()
+			return nil, err
+		}
+		stream = streams.OnDone(stream, desc.ServerStreams, func(err error) {
+			clientHandling.WithLabelValues(mtype, service, method).Observe(time.Since(start).Seconds())
+			clientHandled.WithLabelValues(mtype, service, method, status.Code(err).String()).Inc()
+		})
+		return &clientStream{
+			ClientStream: stream,
+			sent:         clientMsgSent.WithLabelValues(mtype, service, method),
+			received:     clientMsgReceived.WithLabelValues(mtype, service, method),
+		}, nil
+	}
+}
+
+// clientStream counts the messages sent and received on a stream
+type clientStream struct {
+	grpc.ClientStream
+	sent, received interface{ Inc() }
+}
+
+func (s *clientStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == nil {
+		s.sent.Inc()
+	}
+	return err
+}
+
+func (s *clientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err == nil {
+		s.received.Inc()
+	}
+	return err
+}
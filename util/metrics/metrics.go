@@ -0,0 +1,341 @@
+// Package metrics provides gRPC client and server interceptors that
+// record Prometheus metrics (RPC counts by method and code, latency
+// histograms, and stream message counts) along with collectors for
+// the currency data store, the servers' rate limiters and concurrency
+// limiters, and the clients' retries, hedged calls and circuit breakers.
+// Metrics are exposed on a /metrics HTTP endpoint started with Serve.
+package metrics
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	serverStarted = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "grpc_server_started_total",
+			Help: "Total number of RPCs started on the server.",
+		},
+		[]string{"grpc_type", "grpc_service", "grpc_method"},
+	)
+	serverHandled = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "grpc_server_handled_total",
+			Help: "Total number of RPCs completed on the server, regardless of success or failure.",
+		},
+		[]string{"grpc_type", "grpc_service", "grpc_method", "grpc_code"},
+	)
+	serverHandling = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "grpc_server_handling_seconds",
+			Help:    "Latency of RPCs handled by the server.",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"grpc_type", "grpc_service", "grpc_method"},
+	)
+	serverMsgReceived = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "grpc_server_msg_received_total",
+			Help: "Total number of stream messages received by the server.",
+		},
+		[]string{"grpc_type", "grpc_service", "grpc_method"},
+	)
+	serverMsgSent = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "grpc_server_msg_sent_total",
+			Help: "Total number of stream messages sent by the server.",
+		},
+		[]string{"grpc_type", "grpc_service", "grpc_method"},
+	)
+
+	clientStarted = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "grpc_client_started_total",
+			Help: "Total number of RPCs started by the client.",
+		},
+		[]string{"grpc_type", "grpc_service", "grpc_method"},
+	)
+	clientHandled = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "grpc_client_handled_total",
+			Help: "Total number of RPCs completed by the client, regardless of success or failure.",
+		},
+		[]string{"grpc_type", "grpc_service", "grpc_method", "grpc_code"},
+	)
+	clientHandling = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "grpc_client_handling_seconds",
+			Help:    "Latency of RPCs, until the last response is received, as seen by the client.",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"grpc_type", "grpc_service", "grpc_method"},
+	)
+	clientMsgReceived = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "grpc_client_msg_received_total",
+			Help: "Total number of stream messages received by the client.",
+		},
+		[]string{"grpc_type", "grpc_service", "grpc_method"},
+	)
+	clientMsgSent = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "grpc_client_msg_sent_total",
+			Help: "Total number of stream messages sent by the client.",
+		},
+		[]string{"grpc_type", "grpc_service", "grpc_method"},
+	)
+
+	clientRetries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "grpc_client_retries_total",
+			Help: "Total number of RPC attempts retried by the client, by code of the failed attempt.",
+		},
+		[]string{"grpc_service", "grpc_method", "grpc_code"},
+	)
+
+	clientHedges = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "grpc_client_hedges_total",
+			Help: "Total number of hedged copies of RPCs sent by the client.",
+		},
+		[]string{"grpc_service", "grpc_method"},
+	)
+
+	circuitState = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "grpc_client_circuit_state",
+			Help: "State of the client circuit breaker of a method, 1 for the current state.",
+		},
+		[]string{"grpc_target", "grpc_service", "grpc_method", "state"},
+	)
+
+	circuitTransitions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "grpc_client_circuit_transitions_total",
+			Help: "Total number of transitions of the client circuit breaker of a method, by new state.",
+		},
+		[]string{"grpc_target", "grpc_service", "grpc_method", "state"},
+	)
+
+	circuitRejected = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "grpc_client_circuit_rejected_total",
+			Help: "Total number of RPCs failed fast by the client circuit breaker.",
+		},
+		[]string{"grpc_target", "grpc_service", "grpc_method"},
+	)
+
+	rateLimited = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "grpc_server_ratelimit_rejections_total",
+			Help: "Total number of RPCs rejected by the server's rate limiter.",
+		},
+		[]string{"grpc_service", "grpc_method", "criticality"},
+	)
+	loadShed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "grpc_server_load_shed_total",
+			Help: "Total number of RPCs shed by the server's concurrency limiter.",
+		},
+		[]string{"grpc_service", "grpc_method", "criticality"},
+	)
+	panics = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "grpc_server_panics_total",
+			Help: "Total number of panics recovered while handling RPCs.",
+		},
+		[]string{"grpc_service", "grpc_method"},
+	)
+	certExpiry = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tls_cert_expiry_timestamp_seconds",
+			Help: "Unix time the loaded certificate expires, by certificate file.",
+		},
+		[]string{"file"},
+	)
+	certExpiryWarnings = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tls_cert_expiry_warnings_total",
+			Help: "Total number of loaded certificates found within their expiry warning window.",
+		},
+		[]string{"file"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(
+		serverStarted, serverHandled, serverHandling, serverMsgReceived, serverMsgSent,
+		clientStarted, clientHandled, clientHandling, clientMsgReceived, clientMsgSent,
+		clientRetries, clientHedges, circuitState, circuitTransitions, circuitRejected,
+		rateLimited, loadShed, panics, certExpiry, certExpiryWarnings,
+	)
+}
+
+// Serve starts serving the metrics on http://addr/metrics in the
+// background. The returned server can be used to shut it down.
+func Serve(addr string) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	srv := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		log.Println("serving metrics on", addr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Println("metrics endpoint failed:", err)
+		}
+	}()
+	return srv
+}
+
+// Retried records a failed attempt of an RPC, by full
+// method name and code, retried by a client.
+func Retried(fullMethod, code string) {
+	service, method := splitMethod(fullMethod)
+	clientRetries.WithLabelValues(service, method, code).Inc()
+}
+
+// Hedged records a hedged copy of an RPC,
+// by full method name, sent by a client.
+func Hedged(fullMethod string) {
+	service, method := splitMethod(fullMethod)
+	clientHedges.WithLabelValues(service, method).Inc()
+}
+
+// CircuitChanged records the transition of the client circuit breaker
+// of a method on target from state from, "" for a new circuit, to state
+// to.
+func CircuitChanged(target, fullMethod, from, to string) {
+	service, method := splitMethod(fullMethod)
+	if from != "" {
+		circuitState.WithLabelValues(target, service, method, from).Set(0)
+		circuitTransitions.WithLabelValues(target, service, method, to).Inc()
+	}
+	circuitState.WithLabelValues(target, service, method, to).Set(1)
+}
+
+// CircuitRejected records an RPC to a method on
+// target failed fast by the client circuit breaker
+func CircuitRejected(target, fullMethod string) {
+	service, method := splitMethod(fullMethod)
+	circuitRejected.WithLabelValues(target, service, method).Inc()
+}
+
+// RateLimited records an RPC, by full method name and
+// criticality, rejected by a rate limiter.
+func RateLimited(fullMethod, criticality string) {
+	service, method := splitMethod(fullMethod)
+	rateLimited.WithLabelValues(service, method, criticality).Inc()
+}
+
+// LoadShed records an RPC, by full method name and
+// criticality, shed by a concurrency limiter.
+func LoadShed(fullMethod, criticality string) {
+	service, method := splitMethod(fullMethod)
+	loadShed.WithLabelValues(service, method, criticality).Inc()
+}
+
+// PanicRecovered records a panic recovered while handling
+// an RPC, by full method name.
+func PanicRecovered(fullMethod string) {
+	service, method := splitMethod(fullMethod)
+	panics.WithLabelValues(service, method).Inc()
+}
+
+// CertLoaded records the expiry time of the certificate loaded from file
+func CertLoaded(file string, notAfter time.Time) {
+	certExpiry.WithLabelValues(file).Set(float64(notAfter.Unix()))
+}
+
+// CertExpiring records a certificate loaded from
+// file that is within its expiry warning window
+func CertExpiring(file string) {
+	certExpiryWarnings.WithLabelValues(file).Inc()
+}
+
+// DataStore is implemented by util.DataStore
+type DataStore interface {
+	Len() int
+	LoadedAt() time.Time
+}
+
+// RegisterDataStore publishes the number of items in ds and
+// the time ds was last loaded. It is called once per process.
+func RegisterDataStore(ds DataStore) {
+	prometheus.MustRegister(
+		prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Name: "currency_datastore_items",
+				Help: "Number of currency items in the data store.",
+			},
+			func() float64 { return float64(ds.Len()) },
+		),
+		prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Name: "currency_datastore_last_reload_timestamp_seconds",
+				Help: "Unix time the data store was last loaded.",
+			},
+			func() float64 {
+				loaded := ds.LoadedAt()
+				if loaded.IsZero() {
+					return 0
+				}
+				return float64(loaded.UnixNano()) / 1e9
+			},
+		),
+	)
+}
+
+// ConcurrencyLimiter is implemented by concurrency.Limiter
+type ConcurrencyLimiter interface {
+	Limit() int
+	InFlight() int
+}
+
+// RegisterConcurrencyLimiter publishes the current limit of l and the
+// number of calls it admitted. It is called once per process.
+func RegisterConcurrencyLimiter(l ConcurrencyLimiter) {
+	prometheus.MustRegister(
+		prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Name: "grpc_server_concurrency_limit",
+				Help: "Number of RPCs the server's adaptive concurrency limiter admits at once.",
+			},
+			func() float64 { return float64(l.Limit()) },
+		),
+		prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Name: "grpc_server_concurrency_in_flight",
+				Help: "Number of RPCs admitted by the server's concurrency limiter being handled.",
+			},
+			func() float64 { return float64(l.InFlight()) },
+		),
+	)
+}
+
+// splitMethod splits a full method name (/package.Service/Method)
+// into its service and method names.
+func splitMethod(fullMethod string) (string, string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.Index(fullMethod, "/"); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return "unknown", fullMethod
+}
+
+func methodType(clientStream, serverStream bool) string {
+	switch {
+	case clientStream && serverStream:
+		return "bidi_stream"
+	case clientStream:
+		return "client_stream"
+	case serverStream:
+		return "server_stream"
+	default:
+		return "unary"
+	}
+}
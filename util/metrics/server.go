@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerIntercept returns a unary server interceptor
+// that records the count and latency of calls.
+func UnaryServerIntercept() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		service, method := splitMethod(info.FullMethod)
+		serverStarted.WithLabelValues("unary", service, method).Inc()
+		start := time.Now()
+
+		resp, err := handler(ctx, req)
+
+		serverHandling.WithLabelValues("unary", service, method).Observe(time.Since(start).Seconds())
+		serverHandled.WithLabelValues("unary", service, method, status.Code(err).String()).Inc()
+		return resp, err
+	}
+}
+
+// StreamServerIntercept returns a stream server interceptor that
+// records the count and latency of calls and the messages streamed.
+func StreamServerIntercept() grpc.StreamServerInterceptor {
+	return func(
+		server interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		mtype := methodType(info.IsClientStream, info.IsServerStream)
+		service, method := splitMethod(info.FullMethod)
+		serverStarted.WithLabelValues(mtype, service, method).Inc()
+		start := time.Now()
+
+		err := handler(server, &serverStream{
+			ServerStream: stream,
+			sent:         serverMsgSent.WithLabelValues(mtype, service, method),
+			received:     serverMsgReceived.WithLabelValues(mtype, service, method),
+		})
+
+		serverHandling.WithLabelValues(mtype, service, method).Observe(time.Since(start).Seconds())
+		serverHandled.WithLabelValues(mtype, service, method, status.Code(err).String()).Inc()
+		return err
+	}
+}
+
+// serverStream counts the messages sent and received on a stream
+type serverStream struct {
+	grpc.ServerStream
+	sent, received interface{ Inc() }
+}
+
+func (s *serverStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.sent.Inc()
+	}
+	return err
+}
+
+func (s *serverStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.received.Inc()
+	}
+	return err
+}
@@ -0,0 +1,214 @@
+package util
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// loadCertPool reads PEM-encoded CA certificates from file caFile
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+	return pool, nil
+}
+
+// NewServerMTLSCreds returns server transport credentials that
+// require clients to present a certificate signed by the CA
+// in caFile (mutual TLS).
+func NewServerMTLSCreds(certFile, keyFile, caFile string) (credentials.TransportCredentials, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := loadCertPool(caFile)
+	if err != nil {
+		return nil, err
+	}
+	return credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}), nil
+}
+
+// NewClientMTLSCreds returns client transport credentials that
+// present the certificate in certFile to the server and validate
+// the server's certificate using the CA in caFile.
+func NewClientMTLSCreds(certFile, keyFile, caFile, serverName string) (credentials.TransportCredentials, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := loadCertPool(caFile)
+	if err != nil {
+		return nil, err
+	}
+	return credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ServerName:   serverName,
+	}), nil
+}
+
+// EphemeralCerts holds an in-memory CA along with a server and a
+// client certificate signed by it, so that test harnesses can use
+// (mutual) TLS without certificate files.
+type EphemeralCerts struct {
+	CA     *CertKeyPair
+	Server *CertKeyPair
+	Client *CertKeyPair
+}
+
+// NewEphemeralCerts creates a CA that is valid for lifetime and issues
+// the server and client certificates from it. Certificates without a
+// lifetime of their own are valid as long as the CA.
+func NewEphemeralCerts(lifetime time.Duration, server, client CertOptions) (*EphemeralCerts, error) {
+	ca, err := NewCA(CertOptions{CommonName: "go-grpc ephemeral CA", Lifetime: lifetime})
+	if err != nil {
+		return nil, err
+	}
+	if server.Lifetime == 0 {
+		server.Lifetime = lifetime
+	}
+	if client.Lifetime == 0 {
+		client.Lifetime = lifetime
+	}
+	srv, err := ca.NewServerCert(server)
+	if err != nil {
+		return nil, err
+	}
+	clt, err := ca.NewClientCert(client)
+	if err != nil {
+		return nil, err
+	}
+	return &EphemeralCerts{CA: ca, Server: srv, Client: clt}, nil
+}
+
+// ServerCreds returns server transport credentials that present the
+// server certificate. When requireClientCert is true, clients must
+// present a certificate signed by the CA (mutual TLS).
+func (e *EphemeralCerts) ServerCreds(requireClientCert bool) (credentials.TransportCredentials, error) {
+	cert, err := e.Server.TLSCertificate()
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if requireClientCert {
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		cfg.ClientCAs = e.CA.CertPool()
+	}
+	return credentials.NewTLS(cfg), nil
+}
+
+// ClientCreds returns client transport credentials that present the
+// client certificate and validate the server's certificate using the CA
+func (e *EphemeralCerts) ClientCreds(serverName string) (credentials.TransportCredentials, error) {
+	cert, err := e.Client.TLSCertificate()
+	if err != nil {
+		return nil, err
+	}
+	return credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      e.CA.CertPool(),
+		ServerName:   serverName,
+	}), nil
+}
+
+// IdentityFromPeer returns the Identity of a caller that was
+// authenticated with a verified client certificate. The subject is
+// taken from the first URI SAN, then the first DNS SAN, then the CN.
+// The certificate's OU values are used as the identity's roles.
+func IdentityFromPeer(ctx context.Context) (*Identity, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return nil, false
+	}
+	chains := tlsInfo.State.VerifiedChains
+	if len(chains) == 0 || len(chains[0]) == 0 {
+		return nil, false
+	}
+	cert := chains[0][0]
+
+	id := &Identity{Roles: cert.Subject.OrganizationalUnit}
+	switch {
+	case len(cert.URIs) > 0:
+		id.Subject = cert.URIs[0].String()
+	case len(cert.DNSNames) > 0:
+		id.Subject = cert.DNSNames[0]
+	default:
+		id.Subject = cert.Subject.CommonName
+	}
+	if id.Subject == "" {
+		return nil, false
+	}
+	return id, true
+}
+
+// peerIdentity returns a copy of ctx that carries the identity of the
+// caller's client certificate, granted the scopes of its roles by p
+func peerIdentity(ctx context.Context, p *Policy) (context.Context, error) {
+	id, ok := IdentityFromPeer(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "missing client certificate")
+	}
+	id.Scopes = p.ScopesFor(id.Roles)
+	return NewIdentityContext(ctx, id), nil
+}
+
+// PeerIdentityUnaryIntercept returns a unary server interceptor that
+// attaches the identity of callers authenticated with a client
+// certificate, with the scopes granted to their roles by p, for the
+// policy to be enforced by AuthzUnaryIntercept. The calls of other
+// callers are rejected with Unauthenticated.
+func PeerIdentityUnaryIntercept(p *Policy) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		ctx, err := peerIdentity(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// PeerIdentityStreamIntercept returns a stream server interceptor that
+// attaches the identity of callers authenticated with a client
+// certificate, as PeerIdentityUnaryIntercept does.
+func PeerIdentityStreamIntercept(p *Policy) grpc.StreamServerInterceptor {
+	return func(
+		server interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		ctx, err := peerIdentity(stream.Context(), p)
+		if err != nil {
+			return err
+		}
+		return handler(server, WrapServerStream(stream, ctx))
+	}
+}
@@ -0,0 +1,106 @@
+package util
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// serveMTLS starts a health server that requires client certificates
+// signed by the ephemeral CA and records the identity of its callers
+func serveMTLS(t *testing.T, certs *EphemeralCerts) (string, <-chan *Identity) {
+	t.Helper()
+	creds, err := certs.ServerCreds(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make(chan *Identity, 1)
+	record := func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		id, _ := IdentityFromPeer(ctx)
+		ids <- id
+		return handler(ctx, req)
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer(grpc.Creds(creds), grpc.UnaryInterceptor(record))
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	return lis.Addr().String(), ids
+}
+
+func checkHealth(t *testing.T, addr string, opts ...grpc.DialOption) error {
+	t.Helper()
+	conn, err := grpc.Dial(addr, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	return err
+}
+
+func TestEphemeralMTLS(t *testing.T) {
+	certs, err := NewEphemeralCerts(
+		time.Hour,
+		CertOptions{DNSNames: []string{"localhost"}, IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)}},
+		CertOptions{CommonName: "batch-job", OrgUnits: []string{"editor"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, ids := serveMTLS(t, certs)
+
+	creds, err := certs.ClientCreds("localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkHealth(t, addr, grpc.WithTransportCredentials(creds)); err != nil {
+		t.Fatal(err)
+	}
+	want := &Identity{Subject: "batch-job", Roles: []string{"editor"}}
+	if id := <-ids; !reflect.DeepEqual(id, want) {
+		t.Errorf("identity = %+v, want %+v", id, want)
+	}
+
+	// a client certificate from another CA is refused
+	other, err := NewEphemeralCerts(time.Hour, CertOptions{}, CertOptions{CommonName: "intruder"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherCreds, err := other.ClientCreds("localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkHealth(t, addr, grpc.WithTransportCredentials(otherCreds)); status.Code(err) != codes.Unavailable {
+		t.Errorf("got %v, want Unavailable", err)
+	}
+}
+
+func TestIssueFromExpiredCA(t *testing.T) {
+	// the CA is backdated to tolerate clock skew, so it is already expired
+	ca, err := NewCA(CertOptions{CommonName: "expired CA", Lifetime: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ca.NewServerCert(CertOptions{CommonName: "localhost", Lifetime: time.Hour}); err == nil {
+		t.Error("issued a certificate from an expired CA")
+	}
+}
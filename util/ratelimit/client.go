@@ -0,0 +1,220 @@
+package ratelimit
+
+import (
+	"log"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"golang.org/x/net/context"
+	"golang.org/x/time/rate"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/vladimirvivien/go-grpc/util/streams"
+)
+
+// minClientRate is the rate the client limiter does not go below
+const minClientRate = 0.1
+
+// ClientLimiter limits the rate of the calls of a client, starting at
+// a configured rate that the server feedback adjusts:
+//
+//   - the x-ratelimit-* trailers of the calls give the rate at which
+//     the server replenishes the client's quota, the client slows
+//     down to that rate
+//   - calls rejected with ResourceExhausted halve the rate, and the
+//     calls wait for the delay of their RetryInfo detail, if any
+//   - calls that succeed restore the configured rate gradually
+//
+// The server's quotas differ per method, so the rate is adjusted per
+// method. Unary and stream calls follow the same policy.
+type ClientLimiter struct {
+	limit float64 // the configured rate
+	burst int
+
+	mtx     sync.Mutex
+	methods map[string]*methodLimiter
+}
+
+// methodLimiter is the limiter of the calls to a method
+type methodLimiter struct {
+	limiter     *rate.Limiter
+	current     float64
+	pausedUntil time.Time
+}
+
+// NewClientLimiter returns a limiter allowing at most limit
+// calls per second to a method, in bursts of burst calls
+func NewClientLimiter(limit float64, burst int) *ClientLimiter {
+	return &ClientLimiter{
+		limit:   limit,
+		burst:   burst,
+		methods: make(map[string]*methodLimiter),
+	}
+}
+
+// Limit returns the current rate of the calls to fullMethod
+func (l *ClientLimiter) Limit(fullMethod string) float64 {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.method(fullMethod).current
+}
+
+// method returns the limiter of fullMethod, l.mtx is held
+func (l *ClientLimiter) method(fullMethod string) *methodLimiter {
+	m, ok := l.methods[fullMethod]
+	if !ok {
+		m = &methodLimiter{
+			limiter: rate.NewLimiter(rate.Limit(l.limit), l.burst),
+			current: l.limit,
+		}
+		l.methods[fullMethod] = m
+	}
+	return m
+}
+
+// wait blocks until a call to fullMethod is allowed, it
+// fails right away when the deadline of ctx would be exceeded
+func (l *ClientLimiter) wait(ctx context.Context, fullMethod string) error {
+	l.mtx.Lock()
+	m := l.method(fullMethod)
+	pause := time.Until(m.pausedUntil)
+	l.mtx.Unlock()
+	if pause > 0 {
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < pause {
+			return status.Error(codes.ResourceExhausted, "client limit reached")
+		}
+		select {
+		case <-time.After(pause):
+		case <-ctx.Done():
+			return status.Error(codes.ResourceExhausted, "client limit reached")
+		}
+	}
+	if err := m.limiter.Wait(ctx); err != nil {
+		return status.Error(codes.ResourceExhausted, "client limit reached")
+	}
+	return nil
+}
+
+// observe adjusts the limiter of fullMethod from the outcome of
+// a call: its error and the trailers returned by the server
+func (l *ClientLimiter) observe(fullMethod string, err error, trailer metadata.MD) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	m := l.method(fullMethod)
+
+	if status.Code(err) == codes.ResourceExhausted {
+		m.setLimit(math.Max(minClientRate, m.current/2))
+		pause := time.Duration(float64(time.Second) / m.current)
+		if delay, ok := retryDelay(err); ok {
+			pause = delay
+		}
+		m.pausedUntil = time.Now().Add(pause)
+		log.Printf("server limit reached for %s, client rate lowered to %.2f/s, pausing %v",
+			fullMethod, m.current, pause)
+		return
+	}
+
+	if serverRate, ok := replenishRate(trailer); ok {
+		m.setLimit(math.Max(minClientRate, math.Min(l.limit, serverRate)))
+		return
+	}
+	if err == nil && m.current < l.limit {
+		m.setLimit(math.Min(l.limit, m.current+l.limit/20))
+	}
+}
+
+// setLimit sets the rate of the limiter
+func (m *methodLimiter) setLimit(limit float64) {
+	m.current = limit
+	m.limiter.SetLimit(rate.Limit(limit))
+}
+
+// retryDelay returns the delay of the RetryInfo detail of err
+func retryDelay(err error) (time.Duration, bool) {
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok {
+			delay, err := ptypes.Duration(info.GetRetryDelay())
+			return delay, err == nil
+		}
+	}
+	return 0, false
+}
+
+// replenishRate returns the rate at which the server replenishes the
+// quota of the client, from the x-ratelimit-* trailers: the calls
+// missing from the burst are replenished by the reset time. The reset
+// time is rounded up to the second, the rate is only told when the
+// reset time is long enough for the rounding not to matter much.
+func replenishRate(trailer metadata.MD) (float64, bool) {
+	limit, lok := trailerInt(trailer, LimitTrailer)
+	remaining, rok := trailerInt(trailer, RemainingTrailer)
+	reset, tok := trailerInt(trailer, ResetTrailer)
+	if !lok || !rok || !tok || remaining >= limit || reset < 2 {
+		return 0, false
+	}
+	return float64(limit-remaining) / float64(reset), true
+}
+
+func trailerInt(trailer metadata.MD, key string) (int, bool) {
+	vals := trailer.Get(key)
+	if len(vals) == 0 {
+		return 0, false
+	}
+	i, err := strconv.Atoi(vals[0])
+	return i, err == nil
+}
+
+// UnaryClientIntercept returns a unary client interceptor that waits
+// for the limiter before the call is sent, then adjusts the limiter
+// from the outcome of the call.
+func (l *ClientLimiter) UnaryClientIntercept() grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply interface{},
+		conn *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		if err := l.wait(ctx, method); err != nil {
+			return err
+		}
+		var trailer metadata.MD
+		err := invoker(ctx, method, req, reply, conn, append(opts, grpc.Trailer(&trailer))...)
+		l.observe(method, err, trailer)
+		return err
+	}
+}
+
+// StreamClientIntercept returns a stream client interceptor that waits
+// for the limiter before the stream is opened, then adjusts the
+// limiter from the outcome of the stream once it ends.
+func (l *ClientLimiter) StreamClientIntercept() grpc.StreamClientInterceptor {
+	return func(
+		ctx context.Context,
+		desc *grpc.StreamDesc,
+		conn *grpc.ClientConn,
+		method string,
+		streamer grpc.Streamer,
+		opts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		if err := l.wait(ctx, method); err != nil {
+			return nil, err
+		}
+		stream, err := streamer(ctx, desc, conn, method, opts...)
+		if err != nil {
+			l.observe(method, err, nil)
+			return nil, err
+		}
+		return streams.OnDone(stream, desc.ServerStreams, func(err error) {
+			l.observe(method, err, stream.Trailer())
+		}), nil
+	}
+}
@@ -0,0 +1,427 @@
+// Package ratelimit limits the rate of the calls made to a server per
+// caller (authenticated subject, API key or peer IP address) and per
+// method. The limits are applied by server interceptors (see
+// Limiter.UnaryServerIntercept), which reject the calls over the limit
+// with RetryInfo and QuotaFailure details and return the state of the
+// limit to the callers that are let through in x-ratelimit-* trailers.
+// A tap handle (see Limiter.TapHandle) cheaply rejects, before the
+// request is read, the callers retrying before they were told to. The
+// limits can be shared by the replicas of a server through a quota
+// service (see Remote). Clients pace their calls from the feedback of
+// the server with a ClientLimiter.
+//
+// The buckets keep a reserve of tokens for the more critical calls
+// (see util.Criticality): sheddable calls are rejected while less than
+// half of the burst is left, default calls while less than a tenth is
+// left, so that the lower classes are rejected first. The criticality
+// is the one granted to the caller (see util.CriticalityFromContext), so
+// the interceptors run after the authentication stage.
+package ratelimit
+
+import (
+	"container/list"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"golang.org/x/net/context"
+	"golang.org/x/time/rate"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/tap"
+
+	"github.com/vladimirvivien/go-grpc/util"
+	"github.com/vladimirvivien/go-grpc/util/metrics"
+)
+
+// Trailers returned with the calls let through by the limiter
+const (
+	// LimitTrailer is the burst of the quota applied to the call
+	LimitTrailer = "x-ratelimit-limit"
+	// RemainingTrailer is the number of calls left in the burst
+	RemainingTrailer = "x-ratelimit-remaining"
+	// ResetTrailer is the number of seconds until the burst is
+	// fully replenished
+	ResetTrailer = "x-ratelimit-reset"
+)
+
+// DefaultMaxKeys is the number of callers tracked when
+// Options.MaxKeys is not set
+const DefaultMaxKeys = 10000
+
+// Quota is a token bucket: Rate calls per second, with bursts of
+// at most Burst calls
+type Quota struct {
+	Rate  float64
+	Burst int
+}
+
+// interval returns the time it takes the bucket to replenish a token
+func (q Quota) interval() time.Duration {
+	if q.Rate <= 0 {
+		return time.Second
+	}
+	return time.Duration(float64(time.Second) / q.Rate)
+}
+
+// KeyFunc returns the key identifying the caller of a call from its
+// context and header metadata, or "" if it cannot identify the caller
+type KeyFunc func(ctx context.Context, md metadata.MD) string
+
+// Options configures a Limiter
+type Options struct {
+	// Quota applies to the calls of each caller, across
+	// the methods that have no quota of their own
+	Quota Quota
+
+	// Methods are quotas applied to the calls of each caller to a
+	// method, by full method name (/package.service/method) or by
+	// method name
+	Methods map[string]Quota
+
+	// Key identifies the callers, PeerKey when nil
+	Key KeyFunc
+
+	// MaxKeys is the number of buckets kept, the least recently
+	// used buckets are evicted first. DefaultMaxKeys when zero.
+	MaxKeys int
+
+	// Remote, when set, draws the tokens from a quota service shared
+	// by the replicas of the server. The local buckets apply while
+	// the quota service is unreachable.
+	Remote *Remote
+}
+
+// Limiter keeps a token bucket per caller and method quota
+type Limiter struct {
+	opts Options
+
+	mtx     sync.Mutex
+	lru     *list.List // of *bucket, most recently used first
+	buckets map[string]*list.Element
+}
+
+type bucket struct {
+	key     string
+	quota   Quota
+	limiter *rate.Limiter
+	// retryAt is the time the calls of each criticality, least
+	// critical first, were told to retry at when last rejected
+	retryAt [3]time.Time
+}
+
+// NewLimiter returns a limiter applying the quotas of opts
+func NewLimiter(opts Options) *Limiter {
+	if opts.Key == nil {
+		opts.Key = PeerKey
+	}
+	if opts.MaxKeys <= 0 {
+		opts.MaxKeys = DefaultMaxKeys
+	}
+	return &Limiter{
+		opts:    opts,
+		lru:     list.New(),
+		buckets: make(map[string]*list.Element),
+	}
+}
+
+// Result is the state of the bucket of a call let through
+// by the limiter, it is attached to the context of the call
+type Result struct {
+	Key       string
+	Quota     Quota
+	Remaining int
+	Reset     time.Duration
+}
+
+type resultKey struct{}
+
+// ResultFromContext returns the result of the limiter for the call
+func ResultFromContext(ctx context.Context) (*Result, bool) {
+	res, ok := ctx.Value(resultKey{}).(*Result)
+	return res, ok
+}
+
+// TapHandle is a tap.ServerInHandle (see grpc.InTapHandle) that rejects
+// the calls of callers retrying before the time they were told to retry
+// at by the limiter, for a method and criticality (or a more critical
+// one). It takes no token: it is a cheap pre-check that spares the
+// server the requests of callers ignoring the RetryInfo of their
+// rejections. The transport aborts these calls before they start, with
+// a ResourceExhausted status but without details or trailers. The
+// caller is not authenticated yet, so the criticality of its header is
+// used: claiming a higher one only lets the call on to the
+// interceptors, which apply the criticality granted to the caller.
+func (l *Limiter) TapHandle(ctx context.Context, info *tap.Info) (context.Context, error) {
+	key := l.opts.Key(ctx, info.Header)
+	quotaName, _ := l.quota(info.FullMethodName)
+	criticality := util.CriticalityFromMD(info.Header)
+
+	now := time.Now()
+	l.mtx.Lock()
+	elem, ok := l.buckets[key+"|"+quotaName]
+	limited := false
+	if ok {
+		retryAt := elem.Value.(*bucket).retryAt
+		for c := criticality; c <= util.CriticalityCritical; c++ {
+			limited = limited || now.Before(retryAt[c-util.CriticalitySheddable])
+		}
+	}
+	l.mtx.Unlock()
+	if limited {
+		metrics.RateLimited(info.FullMethodName, criticality.String())
+		return nil, errRetryEarly
+	}
+	return ctx, nil
+}
+
+// allow takes a token from the bucket of the caller of ctx for
+// fullMethod, leaving the reserve of the more critical calls. The calls
+// of callers out of tokens are rejected with ResourceExhausted, and
+// RetryInfo and QuotaFailure details telling when a token is available.
+func (l *Limiter) allow(ctx context.Context, fullMethod string) (*Result, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	key := l.opts.Key(ctx, md)
+	quotaName, quota := l.quota(fullMethod)
+	bucketKey := key + "|" + quotaName
+	criticality := util.CriticalityFromContext(ctx)
+
+	if l.opts.Remote != nil {
+		allowed, tokens, delay, err := l.opts.Remote.take(ctx, bucketKey, quota, criticality)
+		if err == nil {
+			if !allowed {
+				return nil, l.limited(fullMethod, key, quotaName, quota, criticality, delay)
+			}
+			return newResult(key, quota, float64(tokens)), nil
+		}
+		// the quota service is unreachable: apply the local limits
+	}
+
+	granted, delay := l.grant(bucketKey, quota, 1, reserve(criticality, quota.Burst))
+	if granted == 0 {
+		return nil, l.limited(fullMethod, key, quotaName, quota, criticality, delay)
+	}
+	tokens := l.bucket(bucketKey, quota).limiter.Tokens()
+	return newResult(key, quota, tokens), nil
+}
+
+// limited records that the calls of criticality c of the caller key to
+// quotaName are rejected for delay, and returns the error of the call
+func (l *Limiter) limited(fullMethod, key, quotaName string, quota Quota, c util.Criticality, delay time.Duration) error {
+	b := l.bucket(key+"|"+quotaName, quota)
+	l.mtx.Lock()
+	b.retryAt[c-util.CriticalitySheddable] = time.Now().Add(delay)
+	l.mtx.Unlock()
+	metrics.RateLimited(fullMethod, c.String())
+	return limitedError(key, quotaName, quota, delay)
+}
+
+// Grant takes up to n tokens from the bucket of key, created with
+// quota, and returns the number of tokens taken. When no token is
+// taken, it also returns the time until a token is available.
+func (l *Limiter) Grant(key string, quota Quota, n int) (int, time.Duration) {
+	return l.grant(key, quota, n, 0)
+}
+
+// grant takes up to n tokens from the bucket of key as Grant does,
+// leaving at least keep tokens in the bucket
+func (l *Limiter) grant(key string, quota Quota, n, keep int) (int, time.Duration) {
+	b := l.bucket(key, quota)
+	now := time.Now()
+	tokens := b.limiter.TokensAt(now)
+	available := math.Floor(tokens) - float64(keep)
+	if granted := int(math.Min(float64(n), available)); granted > 0 && b.limiter.AllowN(now, granted) {
+		return granted, 0
+	}
+	if quota.Rate <= 0 {
+		// the quota does not allow any more call
+		return 0, time.Second
+	}
+	return 0, time.Duration((float64(1+keep) - tokens) / quota.Rate * float64(time.Second))
+}
+
+// reserve returns the tokens of a bucket of burst tokens that calls
+// of criticality c leave to the more critical calls
+func reserve(c util.Criticality, burst int) int {
+	switch c {
+	case util.CriticalitySheddable:
+		return burst / 2
+	case util.CriticalityDefault:
+		return burst / 10
+	default:
+		return 0
+	}
+}
+
+// newResult returns the result of a call let through
+// with tokens left in the caller's bucket
+func newResult(key string, quota Quota, tokens float64) *Result {
+	res := &Result{Key: key, Quota: quota, Remaining: int(math.Max(0, tokens))}
+	if quota.Rate > 0 {
+		missing := float64(quota.Burst) - tokens
+		res.Reset = time.Duration(missing / quota.Rate * float64(time.Second))
+	}
+	return res
+}
+
+// quota returns the quota applied to calls of fullMethod, and the
+// name of the quota: the method, or "" for the caller's quota
+func (l *Limiter) quota(fullMethod string) (string, Quota) {
+	if q, ok := l.opts.Methods[fullMethod]; ok {
+		return fullMethod, q
+	}
+	method := fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+	if q, ok := l.opts.Methods[method]; ok {
+		return fullMethod, q
+	}
+	return "", l.opts.Quota
+}
+
+// QuotaOf returns the quota applied to the bucket of bucketKey, the key
+// of a caller and the name of its quota as sent to the quota service
+// (see Remote). It returns false for the quotas the limiter does not know.
+func (l *Limiter) QuotaOf(bucketKey string) (Quota, bool) {
+	i := strings.LastIndex(bucketKey, "|")
+	if i < 0 {
+		return Quota{}, false
+	}
+	quotaName := bucketKey[i+1:]
+	if quotaName == "" {
+		return l.opts.Quota, true
+	}
+	name, quota := l.quota(quotaName)
+	return quota, name != ""
+}
+
+// bucket returns the bucket of key, created with quota if it does
+// not exist, and evicts the least recently used buckets over MaxKeys.
+// The bucket is updated if its quota changed.
+func (l *Limiter) bucket(key string, quota Quota) *bucket {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if elem, ok := l.buckets[key]; ok {
+		l.lru.MoveToFront(elem)
+		b := elem.Value.(*bucket)
+		if b.quota != quota {
+			b.quota = quota
+			b.limiter.SetLimit(rate.Limit(quota.Rate))
+			b.limiter.SetBurst(quota.Burst)
+		}
+		return b
+	}
+
+	b := &bucket{
+		key:     key,
+		quota:   quota,
+		limiter: rate.NewLimiter(rate.Limit(quota.Rate), quota.Burst),
+	}
+	l.buckets[key] = l.lru.PushFront(b)
+	for l.lru.Len() > l.opts.MaxKeys {
+		oldest := l.lru.Back()
+		l.lru.Remove(oldest)
+		delete(l.buckets, oldest.Value.(*bucket).key)
+	}
+	return b
+}
+
+// Len returns the number of buckets kept by the limiter
+func (l *Limiter) Len() int {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.lru.Len()
+}
+
+// errRetryEarly is returned to the calls rejected by the tap handle
+var errRetryEarly = status.Error(codes.ResourceExhausted, "rate limit reached, retry after the delay of the last rejection")
+
+// limitedError returns the ResourceExhausted status of a call rejected
+// by the limiter, with RetryInfo and QuotaFailure details
+func limitedError(key, quotaName string, quota Quota, delay time.Duration) error {
+	stat := status.New(codes.ResourceExhausted, "rate limit reached, try later")
+	description := fmt.Sprintf("%v calls per second, burst of %d", quota.Rate, quota.Burst)
+	if quotaName != "" {
+		description += " for " + quotaName
+	}
+	statDetail, err := stat.WithDetails(
+		&errdetails.RetryInfo{RetryDelay: ptypes.DurationProto(delay)},
+		&errdetails.QuotaFailure{
+			Violations: []*errdetails.QuotaFailure_Violation{
+				{Subject: key, Description: description},
+			},
+		},
+	)
+	if err != nil {
+		return stat.Err()
+	}
+	return statDetail.Err()
+}
+
+// trailer returns the x-ratelimit-* trailers of res
+func (res *Result) trailer() metadata.MD {
+	return metadata.Pairs(
+		LimitTrailer, strconv.Itoa(res.Quota.Burst),
+		RemainingTrailer, strconv.Itoa(res.Remaining),
+		ResetTrailer, strconv.Itoa(int(math.Ceil(res.Reset.Seconds()))),
+	)
+}
+
+// PeerKey identifies callers by the IP address of the peer
+func PeerKey(ctx context.Context, md metadata.MD) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return "ip:unknown"
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		host = p.Addr.String()
+	}
+	return "ip:" + host
+}
+
+// TokenKey identifies callers by the subject of the token sent in the
+// "authorization" header. Tokens are verified, with verify, so that a
+// caller cannot escape its limit with forged subjects.
+func TokenKey(verify func(token string) (subject string, err error)) KeyFunc {
+	return headerKey("authorization", "sub:", verify)
+}
+
+// APIKeyKey identifies callers by the API key sent in the "x-api-key"
+// header, verified with verify, which returns the key's subject.
+func APIKeyKey(verify func(key string) (subject string, err error)) KeyFunc {
+	return headerKey("x-api-key", "", verify)
+}
+
+func headerKey(header, prefix string, verify func(string) (string, error)) KeyFunc {
+	return func(ctx context.Context, md metadata.MD) string {
+		vals := md.Get(header)
+		if len(vals) == 0 {
+			return ""
+		}
+		subject, err := verify(vals[0])
+		if err != nil || subject == "" {
+			return ""
+		}
+		return prefix + subject
+	}
+}
+
+// FirstKey identifies callers with the first of keys that
+// identifies them, i.e. FirstKey(TokenKey(verify), PeerKey)
+func FirstKey(keys ...KeyFunc) KeyFunc {
+	return func(ctx context.Context, md metadata.MD) string {
+		for _, key := range keys {
+			if k := key(ctx, md); k != "" {
+				return k
+			}
+		}
+		return ""
+	}
+}
@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"testing"
+
+	"github.com/vladimirvivien/go-grpc/util"
+)
+
+func TestReserve(t *testing.T) {
+	tests := []struct {
+		criticality util.Criticality
+		burst       int
+		want        int
+	}{
+		{util.CriticalitySheddable, 10, 5},
+		{util.CriticalityDefault, 10, 1},
+		{util.CriticalityCritical, 10, 0},
+		{util.CriticalitySheddable, 1, 0},
+		{util.CriticalityDefault, 5, 0},
+	}
+	for _, test := range tests {
+		if got := reserve(test.criticality, test.burst); got != test.want {
+			t.Errorf("reserve(%v, %d) = %d, want %d", test.criticality, test.burst, got, test.want)
+		}
+	}
+}
+
+func TestGrantByCriticality(t *testing.T) {
+	// the bucket does not refill during the test
+	quota := Quota{Rate: 0.001, Burst: 10}
+	tests := []struct {
+		name        string
+		left        int // tokens left in the bucket
+		criticality util.Criticality
+		want        bool
+	}{
+		{"sheddable, full bucket", 10, util.CriticalitySheddable, true},
+		{"sheddable, above the reserve", 6, util.CriticalitySheddable, true},
+		{"sheddable, at the reserve", 5, util.CriticalitySheddable, false},
+		{"default, at the sheddable reserve", 5, util.CriticalityDefault, true},
+		{"default, above the reserve", 2, util.CriticalityDefault, true},
+		{"default, at the reserve", 1, util.CriticalityDefault, false},
+		{"critical, last token", 1, util.CriticalityCritical, true},
+		{"critical, empty bucket", 0, util.CriticalityCritical, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := NewLimiter(Options{})
+			if spent, _ := l.Grant("caller", quota, quota.Burst-test.left); spent != quota.Burst-test.left {
+				t.Fatalf("spent %d tokens, want %d", spent, quota.Burst-test.left)
+			}
+			granted, delay := l.grant("caller", quota, 1, reserve(test.criticality, quota.Burst))
+			if got := granted == 1; got != test.want {
+				t.Fatalf("granted %d tokens, want allowed %v", granted, test.want)
+			}
+			if !test.want && delay <= 0 {
+				t.Errorf("rejected with delay %v, want a positive delay", delay)
+			}
+		})
+	}
+}
+
+func TestGrantPartial(t *testing.T) {
+	quota := Quota{Rate: 0.001, Burst: 10}
+	l := NewLimiter(Options{})
+	if granted, _ := l.Grant("caller", quota, 7); granted != 7 {
+		t.Fatalf("granted %d tokens, want 7", granted)
+	}
+	// a batch gets what is left of the bucket
+	if granted, _ := l.Grant("caller", quota, 5); granted != 3 {
+		t.Fatalf("granted %d tokens, want 3", granted)
+	}
+	if granted, delay := l.Grant("caller", quota, 5); granted != 0 || delay <= 0 {
+		t.Errorf("granted %d tokens with delay %v, want none and a delay", granted, delay)
+	}
+}
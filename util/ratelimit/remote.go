@@ -0,0 +1,197 @@
+package ratelimit
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	pb "github.com/vladimirvivien/go-grpc/protobuf"
+	"github.com/vladimirvivien/go-grpc/util"
+)
+
+const (
+	// remoteTimeout bounds the calls to the quota service
+	remoteTimeout = 100 * time.Millisecond
+
+	// remoteBackoff is the time the local limits apply
+	// after the quota service failed
+	remoteBackoff = 5 * time.Second
+)
+
+// errUnreachable is returned while the local limits apply
+var errUnreachable = errors.New("quota service unreachable")
+
+// Remote draws the tokens of the buckets from a quota service (see
+// pb.QuotaServiceClient), shared by the replicas of a server. The
+// tokens are acquired in batches, leased for a short time, and spent
+// locally so that calls do not wait for the quota service: a new batch
+// is acquired in the background when half of the lease is spent. When
+// the lease is spent nonetheless, the calls wait for the batch being
+// acquired (at most remoteTimeout), except the sheddable calls, which
+// are rejected right away. They do not fall back to the local buckets:
+// these refill at the full rate of the quota on each replica, so the
+// shared limit would not hold.
+//
+// When the quota service fails, the Limiter applies its local buckets
+// for a few seconds before it tries the quota service again.
+type Remote struct {
+	client pb.QuotaServiceClient
+	batch  int
+
+	mtx       sync.Mutex
+	leases    map[string]*lease
+	downUntil time.Time
+}
+
+// lease is the tokens of a bucket granted by the quota service
+type lease struct {
+	tokens  int
+	expires time.Time
+	retryAt time.Time // the bucket is out of tokens until retryAt
+	// pending is closed once the batch being acquired in the
+	// background arrives, it is nil when no batch is acquired
+	pending chan struct{}
+}
+
+// NewRemote returns a Remote acquiring batches
+// of batch tokens from the quota service client
+func NewRemote(client pb.QuotaServiceClient, batch int) *Remote {
+	if batch <= 0 {
+		batch = 1
+	}
+	return &Remote{
+		client: client,
+		batch:  batch,
+		leases: make(map[string]*lease),
+	}
+}
+
+// take takes a token from the lease of bucket key for a call of
+// criticality c, leaving the reserve of the more critical calls in the
+// lease. A batch is acquired in the background when the lease is spent.
+// take returns whether the call is allowed with the tokens left in the
+// lease, or the time until a token is available. The calls that are not
+// sheddable wait, while ctx is not done, for the batch when the lease
+// is spent. take returns an error when the quota service is unreachable
+// so that the local limits apply.
+func (r *Remote) take(ctx context.Context, key string, quota Quota, c util.Criticality) (bool, int, time.Duration, error) {
+	allowed, remaining, delay, pending, err := r.tryTake(key, quota, c)
+	if pending != nil && c != util.CriticalitySheddable {
+		// the batch is bound to arrive, or fail, within remoteTimeout
+		select {
+		case <-pending:
+			allowed, remaining, delay, pending, err = r.tryTake(key, quota, c)
+		case <-ctx.Done():
+		}
+	}
+	if pending != nil {
+		// the tokens of the batch went to other calls
+		return false, 0, quota.interval(), nil
+	}
+	return allowed, remaining, delay, err
+}
+
+// tryTake takes a token as take does, without waiting: when the lease is
+// spent, it returns the channel closed once the next batch arrives
+func (r *Remote) tryTake(key string, quota Quota, c util.Criticality) (bool, int, time.Duration, <-chan struct{}, error) {
+	now := time.Now()
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if now.Before(r.downUntil) {
+		return false, 0, 0, nil, errUnreachable
+	}
+	l, ok := r.leases[key]
+	if !ok {
+		r.sweep(now)
+		l = new(lease)
+		r.leases[key] = l
+	}
+	if now.After(l.expires) {
+		l.tokens = 0
+	}
+	keep := reserve(c, r.batch)
+	if l.tokens > keep {
+		l.tokens--
+		if l.tokens <= r.batch/2 {
+			r.refill(key, quota, l)
+		}
+		return true, l.tokens, 0, nil, nil
+	}
+	if now.Before(l.retryAt) {
+		return false, 0, l.retryAt.Sub(now), nil, nil
+	}
+	return false, 0, 0, r.refill(key, quota, l), nil
+}
+
+// refill starts acquiring a batch for lease l in the background, unless
+// one is being acquired, and returns the channel closed once it arrives,
+// r.mtx is held
+func (r *Remote) refill(key string, quota Quota, l *lease) <-chan struct{} {
+	if l.pending != nil {
+		return l.pending
+	}
+	pending := make(chan struct{})
+	l.pending = pending
+	go func() {
+		grant, err := r.acquire(key, quota)
+		r.mtx.Lock()
+		defer r.mtx.Unlock()
+		l.pending = nil
+		close(pending)
+		if err != nil {
+			r.down(err)
+			return
+		}
+		l.grant(grant, time.Now())
+	}()
+	return pending
+}
+
+// acquire asks the quota service for a batch of tokens of bucket key
+func (r *Remote) acquire(key string, quota Quota) (*pb.QuotaGrant, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), remoteTimeout)
+	defer cancel()
+	return r.client.Acquire(ctx, &pb.QuotaRequest{
+		Key:    key,
+		Tokens: int64(r.batch),
+		Rate:   quota.Rate,
+		Burst:  int32(quota.Burst),
+	})
+}
+
+// down switches to the local limits for remoteBackoff,
+// r.mtx is held
+func (r *Remote) down(err error) {
+	now := time.Now()
+	if now.Before(r.downUntil) {
+		return
+	}
+	log.Printf("quota service unreachable, using local limits for %v: %v", remoteBackoff, err)
+	r.downUntil = now.Add(remoteBackoff)
+}
+
+// sweep drops the expired leases once there are DefaultMaxKeys
+// leases, r.mtx is held
+func (r *Remote) sweep(now time.Time) {
+	if len(r.leases) < DefaultMaxKeys {
+		return
+	}
+	for key, l := range r.leases {
+		if now.After(l.expires) && now.After(l.retryAt) && l.pending == nil {
+			delete(r.leases, key)
+		}
+	}
+}
+
+// grant adds the tokens granted by the quota service to the lease
+func (l *lease) grant(g *pb.QuotaGrant, now time.Time) {
+	if g.GetTokens() <= 0 {
+		l.retryAt = now.Add(time.Duration(g.GetRetryAfterMs()) * time.Millisecond)
+		return
+	}
+	l.tokens += int(g.GetTokens())
+	l.expires = now.Add(time.Duration(g.GetLeaseMs()) * time.Millisecond)
+}
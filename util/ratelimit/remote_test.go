@@ -0,0 +1,129 @@
+package ratelimit
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	pb "github.com/vladimirvivien/go-grpc/protobuf"
+	"github.com/vladimirvivien/go-grpc/util"
+)
+
+// quotaService grants the tokens of its buckets as the quota service
+// does, after latency, or fails when down
+type quotaService struct {
+	buckets *Limiter
+	latency time.Duration
+	down    bool
+	calls   int32
+}
+
+func (s *quotaService) Acquire(ctx context.Context, req *pb.QuotaRequest, opts ...grpc.CallOption) (*pb.QuotaGrant, error) {
+	atomic.AddInt32(&s.calls, 1)
+	time.Sleep(s.latency)
+	if s.down {
+		return nil, errors.New("quota service down")
+	}
+	quota := Quota{Rate: req.GetRate(), Burst: int(req.GetBurst())}
+	granted, delay := s.buckets.Grant(req.GetKey(), quota, int(req.GetTokens()))
+	if granted == 0 {
+		return &pb.QuotaGrant{RetryAfterMs: delay.Nanoseconds() / int64(time.Millisecond)}, nil
+	}
+	return &pb.QuotaGrant{Tokens: int64(granted), LeaseMs: 2000}, nil
+}
+
+func callerKey(ctx context.Context, md metadata.MD) string {
+	return "caller"
+}
+
+// hammer makes calls to each limiter, from several goroutines, for
+// duration and returns the number of calls allowed
+func hammer(limiters []*Limiter, criticality util.Criticality, duration time.Duration) int {
+	var allowed int32
+	var wg sync.WaitGroup
+	deadline := time.Now().Add(duration)
+	ctx := util.NewCriticalityContext(context.Background(), criticality)
+	for _, l := range limiters {
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(l *Limiter) {
+				defer wg.Done()
+				for time.Now().Before(deadline) {
+					if _, err := l.allow(ctx, "/test.Service/Method"); err == nil {
+						atomic.AddInt32(&allowed, 1)
+					}
+					time.Sleep(time.Millisecond)
+				}
+			}(l)
+		}
+	}
+	wg.Wait()
+	return int(allowed)
+}
+
+func replicas(n int, quota Quota, svc *quotaService, batch int) []*Limiter {
+	var limiters []*Limiter
+	for i := 0; i < n; i++ {
+		limiters = append(limiters, NewLimiter(Options{
+			Quota:  quota,
+			Key:    callerKey,
+			Remote: NewRemote(svc, batch),
+		}))
+	}
+	return limiters
+}
+
+func TestRemoteSharedLimit(t *testing.T) {
+	quota := Quota{Rate: 100, Burst: 10}
+	duration := 2 * time.Second
+	// the quota service grants at most the burst and the rate
+	// over the duration, across the replicas
+	limit := quota.Burst + int(quota.Rate*duration.Seconds())
+
+	tests := []struct {
+		name        string
+		criticality util.Criticality
+	}{
+		{"critical", util.CriticalityCritical},
+		{"default", util.CriticalityDefault},
+		{"sheddable", util.CriticalitySheddable},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			svc := &quotaService{buckets: NewLimiter(Options{}), latency: 5 * time.Millisecond}
+			allowed := hammer(replicas(3, quota, svc, 5), test.criticality, duration)
+			t.Logf("%d calls allowed, the shared quota allows %d", allowed, limit)
+			// a little slack for the time the calls take
+			if allowed > limit+limit/20 {
+				t.Errorf("%d calls allowed, the shared quota allows %d", allowed, limit)
+			}
+			if allowed < limit/2 {
+				t.Errorf("%d calls allowed, want about %d", allowed, limit)
+			}
+		})
+	}
+}
+
+func TestRemoteUnreachable(t *testing.T) {
+	quota := Quota{Rate: 100, Burst: 10}
+	svc := &quotaService{buckets: NewLimiter(Options{}), down: true}
+	limiters := replicas(3, quota, svc, 5)
+	duration := time.Second
+	allowed := hammer(limiters, util.CriticalityCritical, duration)
+
+	// each replica applies its local limits
+	limit := 3 * (quota.Burst + int(quota.Rate*duration.Seconds()))
+	if allowed > limit+limit/20 || allowed < limit/2 {
+		t.Errorf("%d calls allowed, want about %d", allowed, limit)
+	}
+	// the quota service is not called again before remoteBackoff
+	if calls := atomic.LoadInt32(&svc.calls); calls > 3 {
+		t.Errorf("quota service called %d times, want at most once per replica", calls)
+	}
+}
@@ -0,0 +1,55 @@
+package ratelimit
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	"github.com/vladimirvivien/go-grpc/util"
+)
+
+// UnaryServerIntercept returns a unary server interceptor that takes a
+// token from the bucket of the caller for the method (see Options.Key),
+// and rejects the call when the caller is out of tokens. The state of
+// the caller's limit is returned to the calls let through in the
+// x-ratelimit-* trailers. Health checks are never limited.
+func (l *Limiter) UnaryServerIntercept() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		if util.IsHealthMethod(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		res, err := l.allow(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		grpc.SetTrailer(ctx, res.trailer())
+		return handler(context.WithValue(ctx, resultKey{}, res), req)
+	}
+}
+
+// StreamServerIntercept returns a stream server interceptor that
+// limits the streams as UnaryServerIntercept does.
+func (l *Limiter) StreamServerIntercept() grpc.StreamServerInterceptor {
+	return func(
+		server interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		if util.IsHealthMethod(info.FullMethod) {
+			return handler(server, stream)
+		}
+		ctx := stream.Context()
+		res, err := l.allow(ctx, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		stream.SetTrailer(res.trailer())
+		ctx = context.WithValue(ctx, resultKey{}, res)
+		return handler(server, util.WrapServerStream(stream, ctx))
+	}
+}
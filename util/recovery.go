@@ -0,0 +1,71 @@
+package util
+
+import (
+	"log"
+	"runtime/debug"
+
+	"golang.org/x/net/context"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/vladimirvivien/go-grpc/util/metrics"
+)
+
+// RecoveryUnaryIntercept returns a unary server interceptor that
+// recovers from panics raised by the interceptors after it and by
+// the handler. The panic is logged, with its stack and the request
+// id, and the caller receives an Internal status with a generic
+// message so that no internal details are leaked. It should be
+// the first interceptor of the chain (see ServerChain).
+func RecoveryUnaryIntercept() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (resp interface{}, err error) {
+		ctx, requestID := IncomingRequestID(ctx)
+		defer func() {
+			if r := recover(); r != nil {
+				err = recovered(info.FullMethod, requestID, r)
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// RecoveryStreamIntercept returns a stream server interceptor
+// that recovers from panics as RecoveryUnaryIntercept does.
+func RecoveryStreamIntercept() grpc.StreamServerInterceptor {
+	return func(
+		server interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) (err error) {
+		ctx, requestID := IncomingRequestID(stream.Context())
+		defer func() {
+			if r := recover(); r != nil {
+				err = recovered(info.FullMethod, requestID, r)
+			}
+		}()
+		return handler(server, WrapServerStream(stream, ctx))
+	}
+}
+
+// recovered logs and counts a recovered panic and returns the
+// status sent to the caller. The request id is attached as a
+// RequestInfo detail so that the failure can be traced in the logs.
+func recovered(method, requestID string, r interface{}) error {
+	metrics.PanicRecovered(method)
+	log.Printf("panic in %s (request id %s): %v\n%s", method, requestID, r, debug.Stack())
+
+	stat := status.New(codes.Internal, "internal server error")
+	statDetail, err := stat.WithDetails(&errdetails.RequestInfo{RequestId: requestID})
+	if err != nil {
+		return stat.Err()
+	}
+	return statDetail.Err()
+}
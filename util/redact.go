@@ -0,0 +1,17 @@
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// RedactToken returns a printable fingerprint of a secret value
+// (JWT token, API key) so that it can be logged and correlated
+// across log entries without revealing the value itself.
+func RedactToken(token string) string {
+	if token == "" {
+		return "<empty>"
+	}
+	sum := sha256.Sum256([]byte(token))
+	return "<redacted sha256:" + hex.EncodeToString(sum[:4]) + ">"
+}
@@ -0,0 +1,53 @@
+package util
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+)
+
+// RequestIDHeader is the metadata header that carries the request id
+const RequestIDHeader = "x-request-id"
+
+type requestIDKey struct{}
+
+// NewRequestIDContext returns a copy of ctx that carries the request id
+func NewRequestIDContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request id of the call, if any
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// IncomingRequestID returns ctx with the request id of an incoming
+// call: the id already attached to ctx by an outer interceptor, the
+// id sent by the client in the x-request-id header, or a new one.
+func IncomingRequestID(ctx context.Context) (context.Context, string) {
+	if id := RequestIDFromContext(ctx); id != "" {
+		return ctx, id
+	}
+	var id string
+	if meta, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := meta[RequestIDHeader]; len(ids) > 0 {
+			id = ids[0]
+		}
+	}
+	if id == "" {
+		id = NewRequestID()
+	}
+	return NewRequestIDContext(ctx, id), id
+}
+
+// NewRequestID returns a random request id
+func NewRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,49 @@
+package retry
+
+import "sync"
+
+// Budget is a token bucket bounding the extra attempts of calls (retries
+// or hedged copies) to a share of the calls: each call adds ratio tokens
+// to the bucket, up to burst tokens, and each extra attempt takes one.
+// The bucket starts full. A nil Budget does not bound the attempts.
+type Budget struct {
+	ratio float64
+	burst float64
+
+	mtx    sync.Mutex
+	tokens float64
+}
+
+// NewBudget returns a budget of ratio extra attempts per call
+// at most, on average, in bursts of at most burst attempts
+func NewBudget(ratio float64, burst int) *Budget {
+	return &Budget{ratio: ratio, burst: float64(burst), tokens: float64(burst)}
+}
+
+// earn adds the share of a call to the budget
+func (b *Budget) earn() {
+	if b == nil {
+		return
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.tokens += b.ratio
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+// spend takes an attempt from the budget,
+// it returns false when the budget is spent
+func (b *Budget) spend() bool {
+	if b == nil {
+		return true
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,211 @@
+package retry
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/vladimirvivien/go-grpc/util/metrics"
+)
+
+// hedgeBurst is the number of hedged copies the
+// budget lets through at once, at most
+const hedgeBurst = 10
+
+// HedgeOptions configures the hedging of calls
+type HedgeOptions struct {
+	// Methods are the hedged methods, by full method
+	// name (/package.service/method) or by method name
+	Methods []string
+
+	// Delay is the time a call waits for a reply before a copy of
+	// the call is sent, i.e. the 95th percentile of its latency
+	Delay time.Duration
+
+	// MaxAttempts is the number of copies of a call
+	// sent at most, the original call included
+	MaxAttempts int
+
+	// Budget is the number of hedged copies per call at most, on
+	// average, i.e. 0.1 lets at most one call in ten send a copy
+	Budget float64
+
+	// Codes are the non-fatal status codes: a copy failed with one
+	// of them sends the next copy, other failures end the call
+	Codes []codes.Code
+
+	// Replicas are the connections to the replicas of the server the
+	// copies are sent to, in turn. The copies are sent to the
+	// connection of the call when there are no replicas.
+	Replicas []*grpc.ClientConn
+}
+
+// Hedger sends copies of the calls that are slow to reply
+// and takes the first reply, within a budget of copies
+type Hedger struct {
+	opts   HedgeOptions
+	budget *Budget
+}
+
+// NewHedger returns a hedger applying opts
+func NewHedger(opts HedgeOptions) *Hedger {
+	return &Hedger{opts: opts, budget: NewBudget(opts.Budget, hedgeBurst)}
+}
+
+// hedged returns true if the calls of fullMethod are hedged
+func (h *Hedger) hedged(fullMethod string) bool {
+	method := fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+	for _, m := range h.opts.Methods {
+		if m == fullMethod || m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// nonFatal returns true if err, the failure
+// of a copy, lets the call send another copy
+func (h *Hedger) nonFatal(err error) bool {
+	code := status.Code(err)
+	for _, c := range h.opts.Codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// replica returns the connection the copy n of a call is sent to, conn
+// being the connection of the call, which the original call (n = 0) uses
+func (h *Hedger) replica(conn *grpc.ClientConn, n int) *grpc.ClientConn {
+	if n == 0 || len(h.opts.Replicas) == 0 {
+		return conn
+	}
+	return h.opts.Replicas[(n-1)%len(h.opts.Replicas)]
+}
+
+// hedgeResult is the outcome of a copy of a call
+type hedgeResult struct {
+	reply   proto.Message
+	header  metadata.MD
+	trailer metadata.MD
+	err     error
+}
+
+// UnaryClientIntercept returns a unary client interceptor that hedges
+// the calls of the hedged methods: when a call gets no reply within
+// Delay, a copy of the call is sent, to the next replica, and so on up
+// to MaxAttempts copies. A copy is also sent right away when a copy
+// fails with a non-fatal code (see HedgeOptions.Codes), other failures
+// are returned right away. The first successful reply is returned, and
+// the other copies are canceled. The copies are taken from the budget, a call that is
+// out of budget waits for the copies already sent. The copies sent are
+// counted (grpc_client_hedges_total).
+//
+// The hedged methods must be idempotent. The interceptor runs before the
+// circuit breaker and the retry interceptors, so that each copy goes
+// through the circuit of its replica, which fails it fast with
+// Unavailable while open, and is retried on its own.
+func (h *Hedger) UnaryClientIntercept() grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply interface{},
+		conn *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		callOpts ...grpc.CallOption,
+	) error {
+		replyMsg, ok := reply.(proto.Message)
+		if !ok || !h.hedged(method) || h.opts.MaxAttempts < 2 {
+			return invoker(ctx, method, req, reply, conn, callOpts...)
+		}
+		h.budget.earn()
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel() // cancels the copies still in flight
+		// the copies share the call options, except
+		// the header and trailer of the call
+		var shared []grpc.CallOption
+		for _, opt := range callOpts {
+			switch opt.(type) {
+			case grpc.HeaderCallOption, grpc.TrailerCallOption:
+			default:
+				shared = append(shared, opt)
+			}
+		}
+		results := make(chan hedgeResult, h.opts.MaxAttempts)
+		send := func(n int) {
+			res := hedgeResult{reply: proto.Clone(replyMsg)}
+			res.reply.Reset()
+			opts := append(shared[:len(shared):len(shared)], grpc.Header(&res.header), grpc.Trailer(&res.trailer))
+			go func() {
+				res.err = invoker(ctx, method, req, res.reply, h.replica(conn, n), opts...)
+				results <- res
+			}()
+		}
+
+		send(0)
+		sent, inFlight := 1, 1
+		timer := time.NewTimer(h.opts.Delay)
+		defer timer.Stop()
+		var last hedgeResult
+		for inFlight > 0 {
+			hedge := false
+			select {
+			case <-timer.C:
+				hedge = true
+			case res := <-results:
+				inFlight--
+				if res.err == nil {
+					replyMsg.Reset()
+					proto.Merge(replyMsg, res.reply)
+					setHeaderTrailer(callOpts, res.header, res.trailer)
+					return nil
+				}
+				last = res
+				if !h.nonFatal(res.err) {
+					// a fatal failure ends the call
+					inFlight = 0
+					break
+				}
+				hedge = ctx.Err() == nil
+			}
+			if hedge && sent < h.opts.MaxAttempts && h.budget.spend() {
+				metrics.Hedged(method)
+				log.Printf("%s: sending copy %d of the call", method, sent+1)
+				send(sent)
+				sent++
+				inFlight++
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(h.opts.Delay)
+			}
+		}
+		setHeaderTrailer(callOpts, last.header, last.trailer)
+		return last.err
+	}
+}
+
+// setHeaderTrailer sets the header and trailer of
+// the header and trailer call options of a call
+func setHeaderTrailer(callOpts []grpc.CallOption, header, trailer metadata.MD) {
+	for _, opt := range callOpts {
+		switch opt := opt.(type) {
+		case grpc.HeaderCallOption:
+			*opt.HeaderAddr = header
+		case grpc.TrailerCallOption:
+			*opt.TrailerAddr = trailer
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package retry
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// hedgeCopy is the outcome of a copy of a call
+type hedgeCopy struct {
+	delay time.Duration
+	code  codes.Code
+	reply string
+}
+
+// hedgeInvoker returns an invoker replying to the copies of a call as
+// copies does, the next copies wait until they are canceled. The copies
+// canceled before they reply fail with Canceled.
+func hedgeInvoker(copies []hedgeCopy, calls, canceled *int32) grpc.UnaryInvoker {
+	return func(ctx context.Context, method string, req, reply interface{}, conn *grpc.ClientConn, opts ...grpc.CallOption) error {
+		c := hedgeCopy{delay: time.Hour}
+		if n := int(atomic.AddInt32(calls, 1)); n <= len(copies) {
+			c = copies[n-1]
+		}
+		select {
+		case <-time.After(c.delay):
+		case <-ctx.Done():
+			atomic.AddInt32(canceled, 1)
+			return status.Error(codes.Canceled, ctx.Err().Error())
+		}
+		setHeaderTrailer(opts, nil, metadata.Pairs("copy", c.reply))
+		if c.code != codes.OK {
+			return status.Error(c.code, "copy failed")
+		}
+		reply.(*wrappers.StringValue).Value = c.reply
+		return nil
+	}
+}
+
+func TestHedger(t *testing.T) {
+	slow := time.Second
+	tests := []struct {
+		name     string
+		copies   []hedgeCopy
+		reply    string
+		want     codes.Code
+		calls    int32
+		canceled int32
+	}{
+		{"fast reply", []hedgeCopy{{reply: "a"}}, "a", codes.OK, 1, 0},
+		{"hedged reply first", []hedgeCopy{{delay: slow, reply: "a"}, {reply: "b"}}, "b", codes.OK, 2, 1},
+		{"original reply first", []hedgeCopy{{delay: 100 * time.Millisecond, reply: "a"}}, "a", codes.OK, 3, 2},
+		{"non-fatal failure", []hedgeCopy{{code: codes.Unavailable, reply: "a"}, {reply: "b"}}, "b", codes.OK, 2, 0},
+		{"fatal failure", []hedgeCopy{{delay: slow, reply: "a"}, {code: codes.InvalidArgument, reply: "b"}}, "b", codes.InvalidArgument, 2, 1},
+		{"all copies fail", []hedgeCopy{
+			{code: codes.Unavailable, reply: "a"},
+			{code: codes.Unavailable, reply: "b"},
+			{code: codes.Unavailable, reply: "c"},
+		}, "c", codes.Unavailable, 3, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := NewHedger(HedgeOptions{
+				Methods:     []string{"Method"},
+				Delay:       10 * time.Millisecond,
+				MaxAttempts: 3,
+				Budget:      1,
+				Codes:       []codes.Code{codes.Unavailable},
+			})
+			var calls, canceled int32
+			reply := new(wrappers.StringValue)
+			var trailer metadata.MD
+			start := time.Now()
+			err := h.UnaryClientIntercept()(context.Background(), "/test.Service/Method", nil, reply, nil,
+				hedgeInvoker(test.copies, &calls, &canceled), grpc.Trailer(&trailer))
+			if status.Code(err) != test.want {
+				t.Fatalf("got %v, want %v", err, test.want)
+			}
+			if elapsed := time.Since(start); elapsed >= slow {
+				t.Errorf("call took %v, want the first reply or fatal failure", elapsed)
+			}
+			// the reply and trailer are the ones of the copy returned
+			if err == nil && reply.GetValue() != test.reply {
+				t.Errorf("reply %q, want %q", reply.GetValue(), test.reply)
+			}
+			if got := trailer.Get("copy"); len(got) != 1 || got[0] != test.reply {
+				t.Errorf("trailer %v, want the one of copy %q", trailer, test.reply)
+			}
+			if calls := atomic.LoadInt32(&calls); calls != test.calls {
+				t.Errorf("%d copies sent, want %d", calls, test.calls)
+			}
+			// the copies in flight are canceled once the call returns
+			deadline := time.Now().Add(time.Second)
+			for atomic.LoadInt32(&canceled) != test.canceled && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			if canceled := atomic.LoadInt32(&canceled); canceled != test.canceled {
+				t.Errorf("%d copies canceled, want %d", canceled, test.canceled)
+			}
+		})
+	}
+}
+
+func TestHedgerBudget(t *testing.T) {
+	h := NewHedger(HedgeOptions{
+		Methods:     []string{"/test.Service/Method"},
+		Delay:       time.Millisecond,
+		MaxAttempts: 2,
+		Budget:      0,
+	})
+	var copies []hedgeCopy
+	for i := 0; i < 2*(hedgeBurst+5); i++ {
+		copies = append(copies, hedgeCopy{delay: 20 * time.Millisecond})
+	}
+	var calls, canceled int32
+	invoker := hedgeInvoker(copies, &calls, &canceled)
+	for i := 0; i < hedgeBurst+5; i++ {
+		err := h.UnaryClientIntercept()(context.Background(), "/test.Service/Method", nil, new(wrappers.StringValue), nil, invoker)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// without any share of the calls, the burst is all
+	// the hedged copies the budget lets through
+	if hedged := atomic.LoadInt32(&calls) - (hedgeBurst + 5); hedged != hedgeBurst {
+		t.Errorf("%d copies hedged, want %d", hedged, hedgeBurst)
+	}
+}
+
+func TestHedgerNotHedged(t *testing.T) {
+	h := NewHedger(HedgeOptions{Methods: []string{"Other"}, Delay: time.Millisecond, MaxAttempts: 3, Budget: 1})
+	var calls, canceled int32
+	invoker := hedgeInvoker([]hedgeCopy{{delay: 20 * time.Millisecond, reply: "a"}}, &calls, &canceled)
+	reply := new(wrappers.StringValue)
+	if err := h.UnaryClientIntercept()(context.Background(), "/test.Service/Method", nil, reply, nil, invoker); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 || reply.GetValue() != "a" {
+		t.Errorf("%d copies sent, reply %q, want a single call", calls, reply.GetValue())
+	}
+}
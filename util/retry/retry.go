@@ -0,0 +1,234 @@
+// Package retry provides client interceptors that retry the failed
+// attempts of calls according to per-method policies: a maximum
+// number of attempts, the status codes worth retrying, an exponential
+// backoff with jitter between the attempts, and a timeout per attempt.
+// The server can push back on the retries of a call with the
+// grpc-retry-pushback-ms trailer, or with a RetryInfo detail. Broken
+// streams are re-established, resuming after the messages already
+// received (see StreamClientIntercept).
+//
+// A Budget bounds the retries of a client to a share of its calls, so
+// that the retries do not multiply the load of a server that is down.
+package retry
+
+import (
+	"log"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"golang.org/x/net/context"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/vladimirvivien/go-grpc/util/metrics"
+	"github.com/vladimirvivien/go-grpc/util/tracing"
+)
+
+// PushbackHeader is the trailer a server returns with a failed call to
+// tell the client how many milliseconds to wait before it retries the
+// call. A negative or malformed value tells the client not to retry.
+const PushbackHeader = "grpc-retry-pushback-ms"
+
+// Policy tells how the calls to a method are retried
+type Policy struct {
+	// MaxAttempts is the number of attempts of a call,
+	// including the first one
+	MaxAttempts int
+
+	// The backoff before the retry n (from 1) is a random duration up
+	// to InitialBackoff * BackoffMultiplier^(n-1), capped at MaxBackoff
+	InitialBackoff    time.Duration
+	MaxBackoff        time.Duration
+	BackoffMultiplier float64
+
+	// RetryableCodes are the status codes of the
+	// failed attempts that are worth retrying
+	RetryableCodes []codes.Code
+
+	// PerTryTimeout, when set, bounds each attempt within the deadline
+	// of the call. Attempts that time out are retried.
+	PerTryTimeout time.Duration
+}
+
+// Options configures the retries of a client
+type Options struct {
+	// Policy applies to the methods that have no policy of their own
+	Policy Policy
+
+	// Methods are the policies of methods, by full method name
+	// (/package.service/method) or by method name. The fields left
+	// zero are taken from Policy.
+	Methods map[string]Policy
+
+	// StreamBuffer is the number of messages sent on a client
+	// stream that are kept to be replayed on a new stream. The
+	// streams sending more messages are not retried.
+	StreamBuffer int
+
+	// Budget, when set, bounds the retries of all the calls to a
+	// share of the calls, so that the retries do not multiply the
+	// load of a failing server. Out of budget, calls are not retried.
+	Budget *Budget
+}
+
+// policy returns the policy applied to the calls of fullMethod
+func (o Options) policy(fullMethod string) Policy {
+	p, ok := o.Methods[fullMethod]
+	if !ok {
+		p, ok = o.Methods[fullMethod[strings.LastIndex(fullMethod, "/")+1:]]
+	}
+	if !ok {
+		return o.Policy
+	}
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = o.Policy.MaxAttempts
+	}
+	if p.InitialBackoff == 0 {
+		p.InitialBackoff = o.Policy.InitialBackoff
+	}
+	if p.MaxBackoff == 0 {
+		p.MaxBackoff = o.Policy.MaxBackoff
+	}
+	if p.BackoffMultiplier == 0 {
+		p.BackoffMultiplier = o.Policy.BackoffMultiplier
+	}
+	if p.RetryableCodes == nil {
+		p.RetryableCodes = o.Policy.RetryableCodes
+	}
+	if p.PerTryTimeout == 0 {
+		p.PerTryTimeout = o.Policy.PerTryTimeout
+	}
+	return p
+}
+
+// retryable returns true if attempts failing with code are retried
+func (p Policy) retryable(code codes.Code) bool {
+	for _, c := range p.RetryableCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the time to wait before retry n (from 1)
+func (p Policy) backoff(n int) time.Duration {
+	max := float64(p.InitialBackoff) * math.Pow(p.BackoffMultiplier, float64(n-1))
+	max = math.Min(max, float64(p.MaxBackoff))
+	return time.Duration(rand.Float64() * max)
+}
+
+// UnaryClientIntercept returns a unary client interceptor that retries
+// the failed attempts of a call according to the policy of its method.
+// The call's deadline bounds all the attempts. A retry waits for the
+// backoff of the policy, or for the delay pushed back by the server.
+// Each retry is logged and counted (grpc_client_retries_total), and the
+// attempt number is set on the context of the attempt (see
+// tracing.WithAttempt).
+func UnaryClientIntercept(opts Options) grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply interface{},
+		conn *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		callOpts ...grpc.CallOption,
+	) error {
+		policy := opts.policy(method)
+		opts.Budget.earn()
+		for attempt := 1; ; attempt++ {
+			attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+			if policy.PerTryTimeout > 0 {
+				attemptCtx, cancel = context.WithTimeout(ctx, policy.PerTryTimeout)
+			}
+			var trailer metadata.MD
+			err := invoker(tracing.WithAttempt(attemptCtx, attempt), method, req, reply, conn,
+				append(callOpts, grpc.Trailer(&trailer))...)
+			timedOut := attemptCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil
+			cancel()
+			if err == nil {
+				return nil
+			}
+			retryable := timedOut || policy.retryable(status.Code(err))
+			if !backOff(ctx, method, policy, opts.Budget, attempt, retryable, trailer, err) {
+				return err
+			}
+		}
+	}
+}
+
+// backOff waits before the retry of attempt, a failed attempt of a call
+// to method, for the delay pushed back by the server (in trailer or err)
+// or for the backoff of policy. The retry is taken from budget, logged
+// and counted. It returns false, without waiting, when the attempt is
+// not retried.
+func backOff(
+	ctx context.Context,
+	method string,
+	policy Policy,
+	budget *Budget,
+	attempt int,
+	retryable bool,
+	trailer metadata.MD,
+	err error,
+) bool {
+	if attempt >= policy.MaxAttempts || ctx.Err() != nil || !retryable {
+		if attempt > 1 {
+			log.Printf("%s failed after %d attempts: %v", method, attempt, err)
+		}
+		return false
+	}
+	delay, ok := pushback(trailer, err)
+	if !ok {
+		log.Printf("%s: server pushed back on retries: %v", method, err)
+		return false
+	}
+	if delay < 0 {
+		delay = policy.backoff(attempt)
+	}
+	if !budget.spend() {
+		log.Printf("%s: retry budget spent, not retrying: %v", method, err)
+		return false
+	}
+
+	code := status.Code(err)
+	metrics.Retried(method, code.String())
+	log.Printf("%s attempt %d of %d failed with %s, retrying in %v",
+		method, attempt, policy.MaxAttempts, code, delay.Round(time.Millisecond))
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// pushback returns the delay the server asks the client to wait before
+// it retries, -1 when the server did not push back, and false when the
+// server asks the client not to retry
+func pushback(trailer metadata.MD, err error) (time.Duration, bool) {
+	if vals := trailer.Get(PushbackHeader); len(vals) > 0 {
+		ms, convErr := strconv.Atoi(vals[0])
+		if convErr != nil || ms < 0 {
+			return 0, false
+		}
+		return time.Duration(ms) * time.Millisecond, true
+	}
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok {
+			if delay, err := ptypes.Duration(info.GetRetryDelay()); err == nil {
+				return delay, true
+			}
+		}
+	}
+	return -1, true
+}
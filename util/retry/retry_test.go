@@ -0,0 +1,176 @@
+package retry
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"golang.org/x/net/context"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestBackoff(t *testing.T) {
+	p := Policy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond, BackoffMultiplier: 2}
+	tests := []struct {
+		retry int
+		max   time.Duration
+	}{
+		{1, 10 * time.Millisecond},
+		{2, 20 * time.Millisecond},
+		{3, 40 * time.Millisecond},
+		{4, 50 * time.Millisecond},
+		{10, 50 * time.Millisecond},
+	}
+	for _, test := range tests {
+		var longest time.Duration
+		for i := 0; i < 1000; i++ {
+			backoff := p.backoff(test.retry)
+			if backoff < 0 || backoff > test.max {
+				t.Fatalf("backoff(%d) = %v, want at most %v", test.retry, backoff, test.max)
+			}
+			if backoff > longest {
+				longest = backoff
+			}
+		}
+		// the jitter spreads the backoffs up to the max
+		if longest < test.max/2 {
+			t.Errorf("backoff(%d) at most %v, want up to %v", test.retry, longest, test.max)
+		}
+	}
+}
+
+// retryInfo returns an Unavailable status with a RetryInfo of delay
+func retryInfo(delay time.Duration) error {
+	stat, err := status.New(codes.Unavailable, "try later").
+		WithDetails(&errdetails.RetryInfo{RetryDelay: ptypes.DurationProto(delay)})
+	if err != nil {
+		panic(err)
+	}
+	return stat.Err()
+}
+
+func TestPushback(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "down")
+	tests := []struct {
+		name    string
+		trailer metadata.MD
+		err     error
+		delay   time.Duration
+		retry   bool
+	}{
+		{"no pushback", nil, unavailable, -1, true},
+		{"trailer", metadata.Pairs(PushbackHeader, "250"), unavailable, 250 * time.Millisecond, true},
+		{"negative trailer", metadata.Pairs(PushbackHeader, "-1"), unavailable, 0, false},
+		{"malformed trailer", metadata.Pairs(PushbackHeader, "soon"), unavailable, 0, false},
+		{"retry info", nil, retryInfo(2 * time.Second), 2 * time.Second, true},
+		{"trailer over retry info", metadata.Pairs(PushbackHeader, "100"), retryInfo(time.Second), 100 * time.Millisecond, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			delay, retry := pushback(test.trailer, test.err)
+			if retry != test.retry || retry && delay != test.delay {
+				t.Errorf("pushback = %v, %v, want %v, %v", delay, retry, test.delay, test.retry)
+			}
+		})
+	}
+}
+
+// attempt is the outcome of an attempt of a call
+type attempt struct {
+	code    codes.Code
+	hang    bool // the attempt waits for its context
+	trailer metadata.MD
+}
+
+// invoker returns an invoker failing the attempts of a call as
+// attempts does, the calls succeed after the last attempt
+func invoker(attempts []attempt, calls *int32) grpc.UnaryInvoker {
+	return func(ctx context.Context, method string, req, reply interface{}, conn *grpc.ClientConn, opts ...grpc.CallOption) error {
+		n := int(atomic.AddInt32(calls, 1))
+		if n > len(attempts) {
+			return nil
+		}
+		a := attempts[n-1]
+		setHeaderTrailer(opts, nil, a.trailer)
+		if a.hang {
+			<-ctx.Done()
+			return status.Error(codes.DeadlineExceeded, ctx.Err().Error())
+		}
+		return status.Error(a.code, "attempt failed")
+	}
+}
+
+func TestUnaryClientIntercept(t *testing.T) {
+	unavailable := attempt{code: codes.Unavailable}
+	policy := Policy{
+		MaxAttempts:       3,
+		InitialBackoff:    time.Millisecond,
+		MaxBackoff:        5 * time.Millisecond,
+		BackoffMultiplier: 2,
+		RetryableCodes:    []codes.Code{codes.Unavailable},
+		PerTryTimeout:     20 * time.Millisecond,
+	}
+	tests := []struct {
+		name     string
+		attempts []attempt
+		budget   *Budget
+		timeout  time.Duration // of the call
+		calls    int32
+		want     codes.Code
+	}{
+		{"success", nil, nil, time.Second, 1, codes.OK},
+		{"retried", []attempt{unavailable, unavailable}, nil, time.Second, 3, codes.OK},
+		{"not retryable", []attempt{{code: codes.InvalidArgument}}, nil, time.Second, 1, codes.InvalidArgument},
+		{"max attempts", []attempt{unavailable, unavailable, unavailable}, nil, time.Second, 3, codes.Unavailable},
+		{"per-try timeout", []attempt{{hang: true}, {hang: true}}, nil, time.Second, 3, codes.OK},
+		{"call deadline", []attempt{{hang: true}}, nil, 10 * time.Millisecond, 1, codes.DeadlineExceeded},
+		{"pushed back", []attempt{{code: codes.Unavailable, trailer: metadata.Pairs(PushbackHeader, "-1")}}, nil, time.Second, 1, codes.Unavailable},
+		{"out of budget", []attempt{unavailable}, NewBudget(0, 0), time.Second, 1, codes.Unavailable},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), test.timeout)
+			defer cancel()
+			intercept := UnaryClientIntercept(Options{Policy: policy, Budget: test.budget})
+			var calls int32
+			err := intercept(ctx, "/test.Service/Method", nil, nil, nil, invoker(test.attempts, &calls))
+			if status.Code(err) != test.want {
+				t.Errorf("got %v, want %v", err, test.want)
+			}
+			if calls != test.calls {
+				t.Errorf("%d attempts, want %d", calls, test.calls)
+			}
+		})
+	}
+}
+
+func TestMethodPolicy(t *testing.T) {
+	opts := Options{
+		Policy: Policy{MaxAttempts: 3, InitialBackoff: time.Second, RetryableCodes: []codes.Code{codes.Unavailable}},
+		Methods: map[string]Policy{
+			"/test.Service/Full": {MaxAttempts: 5},
+			"Short":              {InitialBackoff: time.Millisecond},
+		},
+	}
+	tests := []struct {
+		method      string
+		maxAttempts int
+		backoff     time.Duration
+	}{
+		{"/test.Service/Full", 5, time.Second},
+		{"/test.Service/Short", 3, time.Millisecond},
+		{"/test.Service/Other", 3, time.Second},
+	}
+	for _, test := range tests {
+		p := opts.policy(test.method)
+		if p.MaxAttempts != test.maxAttempts || p.InitialBackoff != test.backoff || !p.retryable(codes.Unavailable) {
+			t.Errorf("policy of %s = %+v, want %d attempts and a backoff of %v",
+				test.method, p, test.maxAttempts, test.backoff)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package retry
+
+import (
+	"io"
+	"sync"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/vladimirvivien/go-grpc/util/tracing"
+)
+
+// Resumer is implemented by the requests of server streams that can
+// resume after the last message received, i.e. pb.CurrencyRequest
+type Resumer interface {
+	// Resume returns the request resuming the stream after last
+	Resume(last interface{}) interface{}
+}
+
+// StreamClientIntercept returns a stream client interceptor that
+// re-establishes the streams broken by a failure, according to the
+// policy of their method (PerTryTimeout does not apply to streams).
+//
+// The messages sent on a stream are kept, up to opts.StreamBuffer for
+// client streams, and replayed on the new stream, whose replies are
+// skipped until they catch up with the replies already received. The
+// request of a server stream implementing Resumer resumes the stream
+// after the last reply received instead. The messages sent must not
+// be modified, and the replies must be the same on every attempt.
+func StreamClientIntercept(opts Options) grpc.StreamClientInterceptor {
+	return func(
+		ctx context.Context,
+		desc *grpc.StreamDesc,
+		conn *grpc.ClientConn,
+		method string,
+		streamer grpc.Streamer,
+		callOpts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		s := &retryStream{
+			ctx:       ctx,
+			desc:      desc,
+			conn:      conn,
+			method:    method,
+			streamer:  streamer,
+			callOpts:  callOpts,
+			policy:    opts.policy(method),
+			budget:    opts.Budget,
+			maxBuffer: opts.StreamBuffer,
+		}
+		if !desc.ClientStreams {
+			// the request of a server stream is always kept
+			s.maxBuffer = 1
+		}
+
+		s.budget.earn()
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+		if err := s.attach(); err != nil {
+			if err := s.retry(err, nil); err != nil {
+				return nil, err
+			}
+		}
+		return s, nil
+	}
+}
+
+// retryStream is a client stream re-established on failures
+type retryStream struct {
+	ctx       context.Context
+	desc      *grpc.StreamDesc
+	conn      *grpc.ClientConn
+	method    string
+	streamer  grpc.Streamer
+	callOpts  []grpc.CallOption
+	policy    Policy
+	budget    *Budget
+	maxBuffer int
+
+	mtx      sync.Mutex
+	stream   grpc.ClientStream // stream of the current attempt
+	attempt  int
+	sent     []interface{} // messages sent, replayed on a new stream
+	overflow bool          // more than maxBuffer messages were sent
+	closed   bool          // the client is done sending
+	received int           // replies received
+	last     interface{}   // last reply received
+	skip     int           // replies of the attempt already received
+}
+
+// attach starts a new attempt of the stream and replays the
+// messages sent. It is called with mtx held.
+func (s *retryStream) attach() error {
+	s.attempt++
+	stream, err := s.streamer(tracing.WithAttempt(s.ctx, s.attempt), s.desc, s.conn, s.method, s.callOpts...)
+	if err != nil {
+		return err
+	}
+	s.stream = stream
+
+	msgs := s.sent
+	s.skip = s.received
+	if req, ok := s.request(); ok && s.last != nil {
+		msgs = []interface{}{req.Resume(s.last)}
+		s.skip = 0
+	}
+	for _, m := range msgs {
+		if err := stream.SendMsg(m); err != nil {
+			// the stream failed, RecvMsg returns its status
+			return nil
+		}
+	}
+	if s.closed {
+		stream.CloseSend()
+	}
+	return nil
+}
+
+// request returns the request of a server stream, if it is resumable
+func (s *retryStream) request() (Resumer, bool) {
+	if s.desc.ClientStreams || len(s.sent) == 0 {
+		return nil, false
+	}
+	req, ok := s.sent[0].(Resumer)
+	return req, ok
+}
+
+// retry re-establishes the stream after err, the failure of the current
+// attempt, with its trailer. It returns err if the stream is not retried.
+// It is called with mtx held, which blocks the senders while it waits.
+func (s *retryStream) retry(err error, trailer metadata.MD) error {
+	for {
+		retryable := !s.overflow && s.policy.retryable(status.Code(err))
+		if !backOff(s.ctx, s.method, s.policy, s.budget, s.attempt, retryable, trailer, err) {
+			return err
+		}
+		if err = s.attach(); err == nil {
+			return nil
+		}
+		trailer = nil
+	}
+}
+
+// SendMsg keeps m for the next attempts, then sends it without
+// holding mtx, since sending blocks on flow control while RecvMsg
+// needs mtx. When the stream is re-established meanwhile, the new
+// attempt replays m, which is then not sent again.
+func (s *retryStream) SendMsg(m interface{}) error {
+	s.mtx.Lock()
+	if !s.overflow {
+		if len(s.sent) < s.maxBuffer {
+			s.sent = append(s.sent, m)
+		} else {
+			s.overflow, s.sent = true, nil
+		}
+	}
+	stream, attempt := s.stream, s.attempt
+	s.mtx.Unlock()
+
+	err := stream.SendMsg(m)
+	if err == nil {
+		return nil
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if !s.overflow && (err == io.EOF || s.attempt != attempt) {
+		// the stream failed, it is retried when RecvMsg returns
+		// its status (if it was not already) and m is replayed
+		return nil
+	}
+	return err
+}
+
+func (s *retryStream) RecvMsg(m interface{}) error {
+	for {
+		s.mtx.Lock()
+		stream := s.stream
+		s.mtx.Unlock()
+
+		err := stream.RecvMsg(m)
+		s.mtx.Lock()
+		switch {
+		case err == nil && s.skip > 0:
+			// the reply was received before the stream was retried
+			s.skip--
+		case err == nil:
+			s.received++
+			s.last = m
+			s.mtx.Unlock()
+			return nil
+		case err == io.EOF:
+			s.mtx.Unlock()
+			return err
+		default:
+			err = s.retry(err, stream.Trailer())
+			if err != nil {
+				s.mtx.Unlock()
+				return err
+			}
+		}
+		s.mtx.Unlock()
+	}
+}
+
+func (s *retryStream) CloseSend() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.closed = true
+	return s.stream.CloseSend()
+}
+
+func (s *retryStream) Header() (metadata.MD, error) {
+	s.mtx.Lock()
+	stream := s.stream
+	s.mtx.Unlock()
+	return stream.Header()
+}
+
+func (s *retryStream) Trailer() metadata.MD {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.stream.Trailer()
+}
+
+func (s *retryStream) Context() context.Context {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.stream.Context()
+}
@@ -0,0 +1,297 @@
+package retry
+
+import (
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var unavailable = status.Error(codes.Unavailable, "stream broken")
+
+// script is the behavior of the server on an attempt of a stream
+type script struct {
+	replies []int
+	err     error         // returned once the replies are received, io.EOF when nil
+	block   chan struct{} // when set, the sends wait for it to close and fail with err
+	started chan struct{} // when set, closed once a send is waiting
+}
+
+// fakeStream plays a script, and records the messages sent
+type fakeStream struct {
+	grpc.ClientStream
+	ctx    context.Context
+	script script
+
+	mtx    sync.Mutex
+	sent   []interface{}
+	closed bool
+}
+
+func (f *fakeStream) SendMsg(m interface{}) error {
+	if f.script.block != nil {
+		close(f.script.started)
+		<-f.script.block
+		return f.script.err
+	}
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.sent = append(f.sent, m)
+	return nil
+}
+
+func (f *fakeStream) RecvMsg(m interface{}) error {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if len(f.script.replies) == 0 {
+		if f.script.err == nil {
+			return io.EOF
+		}
+		return f.script.err
+	}
+	*m.(*int) = f.script.replies[0]
+	f.script.replies = f.script.replies[1:]
+	return nil
+}
+
+func (f *fakeStream) CloseSend() error {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.closed = true
+	return nil
+}
+
+func (f *fakeStream) Trailer() metadata.MD         { return nil }
+func (f *fakeStream) Context() context.Context     { return f.ctx }
+func (f *fakeStream) Header() (metadata.MD, error) { return nil, nil }
+
+// fakeServer opens the attempts of a stream, each playing its script
+type fakeServer struct {
+	scripts []script
+
+	mtx     sync.Mutex
+	streams []*fakeStream
+}
+
+func (s *fakeServer) streamer(ctx context.Context, desc *grpc.StreamDesc, conn *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	n := len(s.streams)
+	if n >= len(s.scripts) {
+		return nil, unavailable
+	}
+	stream := &fakeStream{ctx: ctx, script: s.scripts[n]}
+	s.streams = append(s.streams, stream)
+	return stream, nil
+}
+
+// sent returns the messages sent on each attempt
+func (s *fakeServer) sent() [][]interface{} {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	var sent [][]interface{}
+	for _, stream := range s.streams {
+		stream.mtx.Lock()
+		sent = append(sent, stream.sent)
+		stream.mtx.Unlock()
+	}
+	return sent
+}
+
+// resumeReq is a resumable request of a server stream
+type resumeReq struct {
+	after int
+}
+
+func (r *resumeReq) Resume(last interface{}) interface{} {
+	return &resumeReq{after: *last.(*int)}
+}
+
+// recvAll receives the replies of a stream until it fails or ends
+func recvAll(stream grpc.ClientStream) ([]int, error) {
+	var replies []int
+	for {
+		reply := new(int)
+		if err := stream.RecvMsg(reply); err != nil {
+			return replies, err
+		}
+		replies = append(replies, *reply)
+	}
+}
+
+var streamOptions = Options{
+	Policy: Policy{
+		MaxAttempts:       3,
+		InitialBackoff:    time.Millisecond,
+		MaxBackoff:        5 * time.Millisecond,
+		BackoffMultiplier: 2,
+		RetryableCodes:    []codes.Code{codes.Unavailable},
+	},
+	StreamBuffer: 2,
+}
+
+func TestStreamClientIntercept(t *testing.T) {
+	serverStream := &grpc.StreamDesc{ServerStreams: true}
+	clientStream := &grpc.StreamDesc{ClientStreams: true}
+	one, two, three := 1, 2, 3
+	plain := &one
+	resumable := &resumeReq{}
+
+	tests := []struct {
+		name     string
+		desc     *grpc.StreamDesc
+		requests []interface{}
+		scripts  []script
+		replies  []int
+		want     error
+		sent     [][]interface{} // on each attempt
+	}{
+		{
+			name:     "server stream, skip the replies received",
+			desc:     serverStream,
+			requests: []interface{}{plain},
+			scripts: []script{
+				{replies: []int{1, 2}, err: unavailable},
+				{replies: []int{1, 2, 3}},
+			},
+			replies: []int{1, 2, 3},
+			want:    io.EOF,
+			sent:    [][]interface{}{{plain}, {plain}},
+		},
+		{
+			name:     "server stream, resume after the last reply",
+			desc:     serverStream,
+			requests: []interface{}{resumable},
+			scripts: []script{
+				{replies: []int{1, 2}, err: unavailable},
+				{replies: []int{3}},
+			},
+			replies: []int{1, 2, 3},
+			want:    io.EOF,
+			sent:    [][]interface{}{{resumable}, {&resumeReq{after: 2}}},
+		},
+		{
+			name:     "client stream, replay the messages sent",
+			desc:     clientStream,
+			requests: []interface{}{&one, &two},
+			scripts: []script{
+				{err: unavailable},
+				{err: unavailable},
+				{replies: []int{3}},
+			},
+			replies: []int{3},
+			want:    io.EOF,
+			sent:    [][]interface{}{{&one, &two}, {&one, &two}, {&one, &two}},
+		},
+		{
+			name:     "client stream over the buffer",
+			desc:     clientStream,
+			requests: []interface{}{&one, &two, &three},
+			scripts: []script{
+				{err: unavailable},
+				{replies: []int{3}},
+			},
+			want: unavailable,
+			sent: [][]interface{}{{&one, &two, &three}},
+		},
+		{
+			name:     "not retryable",
+			desc:     serverStream,
+			requests: []interface{}{plain},
+			scripts: []script{
+				{replies: []int{1}, err: status.Error(codes.InvalidArgument, "bad request")},
+				{replies: []int{1, 2}},
+			},
+			replies: []int{1},
+			want:    status.Error(codes.InvalidArgument, "bad request"),
+			sent:    [][]interface{}{{plain}},
+		},
+		{
+			name:     "max attempts",
+			desc:     serverStream,
+			requests: []interface{}{plain},
+			scripts: []script{
+				{replies: []int{1}, err: unavailable},
+				{err: unavailable},
+				{err: unavailable},
+				{replies: []int{1, 2}},
+			},
+			replies: []int{1},
+			want:    unavailable,
+			sent:    [][]interface{}{{plain}, {plain}, {plain}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := &fakeServer{scripts: test.scripts}
+			intercept := StreamClientIntercept(streamOptions)
+			stream, err := intercept(context.Background(), test.desc, nil, "/test.Service/Method", server.streamer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, req := range test.requests {
+				if err := stream.SendMsg(req); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := stream.CloseSend(); err != nil {
+				t.Fatal(err)
+			}
+			replies, err := recvAll(stream)
+			if !reflect.DeepEqual(replies, test.replies) {
+				t.Errorf("received %v, want %v", replies, test.replies)
+			}
+			if status.Code(err) != status.Code(test.want) || err == io.EOF != (test.want == io.EOF) {
+				t.Errorf("got %v, want %v", err, test.want)
+			}
+			if sent := server.sent(); !reflect.DeepEqual(sent, test.sent) {
+				t.Errorf("sent %v, want %v", sent, test.sent)
+			}
+			for i, attempt := range server.streams {
+				if !attempt.closed {
+					t.Errorf("attempt %d not closed", i+1)
+				}
+			}
+		})
+	}
+}
+
+// A message sent while the stream is re-established is replayed on the
+// new stream, and not sent again when its send on the old one fails
+func TestStreamSendRace(t *testing.T) {
+	block, started := make(chan struct{}), make(chan struct{})
+	server := &fakeServer{scripts: []script{
+		{err: unavailable, block: block, started: started},
+		{replies: []int{1}},
+	}}
+	desc := &grpc.StreamDesc{ClientStreams: true, ServerStreams: true}
+	stream, err := StreamClientIntercept(streamOptions)(context.Background(), desc, nil, "/test.Service/Method", server.streamer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := 1
+	sendErr := make(chan error)
+	go func() { sendErr <- stream.SendMsg(&msg) }()
+	<-started
+	// the first attempt fails while the message is being sent
+	reply := new(int)
+	if err := stream.RecvMsg(reply); err != nil || *reply != 1 {
+		t.Fatalf("received %d, %v, want 1", *reply, err)
+	}
+	close(block)
+	if err := <-sendErr; err != nil {
+		t.Errorf("send failed with %v, want the message replayed", err)
+	}
+	want := [][]interface{}{nil, {&msg}}
+	if sent := server.sent(); !reflect.DeepEqual(sent, want) {
+		t.Errorf("sent %v, want %v", sent, want)
+	}
+}
@@ -0,0 +1,110 @@
+package util
+
+import (
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"golang.org/x/net/context"
+
+	pb "github.com/vladimirvivien/go-grpc/protobuf"
+)
+
+// RevocationList caches, in memory, the ids (jti claims) of the
+// tokens revoked by the auth service. The list is kept up to date
+// by Follow, which subscribes to the auth service revocation feed.
+type RevocationList struct {
+	mtx   sync.RWMutex
+	byJti map[string]time.Time
+}
+
+func NewRevocationList() *RevocationList {
+	return &RevocationList{byJti: make(map[string]time.Time)}
+}
+
+// Revoked returns true if the token, identified by its jti claim, was revoked
+func (r *RevocationList) Revoked(token *jwt.Token) bool {
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return false
+	}
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return false
+	}
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	_, ok = r.byJti[jti]
+	return ok
+}
+
+func (r *RevocationList) add(rev *pb.Revocation) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	now := time.Now()
+	// entries are dropped once their token expires
+	for jti, expires := range r.byJti {
+		if expires.Before(now) {
+			delete(r.byJti, jti)
+		}
+	}
+	r.byJti[rev.GetJti()] = time.Unix(rev.GetExpires(), 0)
+}
+
+// Follow subscribes to the revocation feed of the auth service
+// and adds the received entries to the list. The subscription is
+// renewed, with a backoff, when the feed is interrupted; entries
+// received earlier are kept meanwhile. Follow runs until stop is closed.
+func (r *RevocationList) Follow(client pb.AuthClient, stop <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	backoff := time.Second
+	for {
+		start := time.Now()
+		err := r.watch(ctx, client)
+		if ctx.Err() != nil {
+			return
+		}
+		// a long lived subscription resets the backoff
+		if time.Since(start) > time.Minute {
+			backoff = time.Second
+		}
+		log.Printf("revocation feed interrupted: %v, resubscribing in %v", err, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		if backoff *= 2; backoff > 30*time.Second {
+			backoff = 30 * time.Second
+		}
+	}
+}
+
+// watch receives the revocation feed until it is interrupted
+func (r *RevocationList) watch(ctx context.Context, client pb.AuthClient) error {
+	stream, err := client.WatchRevocations(ctx, &pb.WatchRevocationsRequest{})
+	if err != nil {
+		return err
+	}
+	for {
+		rev, err := stream.Recv()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		r.add(rev)
+	}
+}
@@ -0,0 +1,40 @@
+// Package streams tells the client interceptors when a stream is done.
+// It is a package of its own, without dependencies on the other util
+// packages, so that all the interceptors (util/metrics included, which
+// util depends on) can use it.
+package streams
+
+import (
+	"io"
+	"sync"
+
+	"google.golang.org/grpc"
+)
+
+// OnDone returns stream wrapped so that done is called, once, when the
+// stream is done: when RecvMsg returns an error, with nil for io.EOF,
+// or, without serverStreams, when it returns the single response of
+// the stream, with nil. Interceptors that only need the first receive
+// of a stream (i.e. to tell whether the server is up) pass false.
+func OnDone(stream grpc.ClientStream, serverStreams bool, done func(err error)) grpc.ClientStream {
+	return &clientStream{ClientStream: stream, serverStreams: serverStreams, done: done}
+}
+
+type clientStream struct {
+	grpc.ClientStream
+	serverStreams bool
+	done          func(error)
+	once          sync.Once
+}
+
+func (s *clientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	switch {
+	case err == nil && s.serverStreams:
+	case err == nil, err == io.EOF:
+		s.once.Do(func() { s.done(nil) })
+	default:
+		s.once.Do(func() { s.done(err) })
+	}
+	return err
+}
@@ -0,0 +1,83 @@
+package tracing
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/vladimirvivien/go-grpc/util/streams"
+)
+
+// UnaryClientIntercept returns a unary client interceptor that starts
+// a client span for each invocation and propagates its context to the
+// server in the request metadata. Added after a retry stage (see
+// util.ClientChain), it records a span per attempt of the call.
+func UnaryClientIntercept() grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply interface{},
+		conn *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		ctx, span := startClientSpan(ctx, method)
+		defer span.End()
+
+		err := invoker(ctx, method, req, reply, conn, opts...)
+		endSpan(span, err)
+		return err
+	}
+}
+
+// StreamClientIntercept returns a stream client interceptor that
+// starts a client span for each stream. The span ends when RecvMsg
+// returns an error (io.EOF included), or the single response of a
+// stream without server streaming (i.e. SaveCurrencyStream).
+func StreamClientIntercept() grpc.StreamClientInterceptor {
+	return func(
+		ctx context.Context,
+		desc *grpc.StreamDesc,
+		conn *grpc.ClientConn,
+		method string,
+		streamer grpc.Streamer,
+		opts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		ctx, span := startClientSpan(ctx, method)
+		stream, err := streamer(ctx, desc, conn, method, opts...)
+		if err != nil {
+			endSpan(span, err)
+			span.End()
+			return nil, err
+		}
+		return streams.OnDone(stream, desc.ServerStreams, func(err error) {
+			endSpan(span, err)
+			span.End()
+		}), nil
+	}
+}
+
+// startClientSpan starts the client span of a call and injects
+// its context in the outgoing metadata
+func startClientSpan(ctx context.Context, method string) (context.Context, trace.Span) {
+	attrs := methodAttrs(method)
+	if attempt, ok := attemptFromContext(ctx); ok {
+		attrs = append(attrs, attribute.Int("rpc.attempt", attempt))
+	}
+	ctx, span := tracer().Start(ctx, spanName(method),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+
+	meta, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		meta = meta.Copy()
+	} else {
+		meta = metadata.MD{}
+	}
+	otel.GetTextMapPropagator().Inject(ctx, metadataCarrier(meta))
+	return metadata.NewOutgoingContext(ctx, meta), span
+}
@@ -0,0 +1,212 @@
+package tracing
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"golang.org/x/net/context"
+)
+
+// fileExporter writes each batch of spans as a line of OTLP JSON
+// (an ExportTraceServiceRequest), the format of the collector's file
+// exporter, so that the file can be replayed into a collector or
+// loaded by tools that read OTLP files.
+type fileExporter struct {
+	mtx sync.Mutex
+	out io.WriteCloser
+	enc *json.Encoder
+}
+
+func newFileExporter(out io.WriteCloser) *fileExporter {
+	return &fileExporter{out: out, enc: json.NewEncoder(out)}
+}
+
+func (e *fileExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	req := otlpRequest{}
+	resources := make(map[*resource.Resource]*otlpResourceSpans)
+	scopes := make(map[*otlpResourceSpans]map[instrumentation.Scope]*otlpScopeSpans)
+	for _, span := range spans {
+		rs, ok := resources[span.Resource()]
+		if !ok {
+			req.ResourceSpans = append(req.ResourceSpans, &otlpResourceSpans{
+				Resource: otlpResource{Attributes: otlpAttrs(span.Resource().Attributes())},
+			})
+			rs = req.ResourceSpans[len(req.ResourceSpans)-1]
+			resources[span.Resource()] = rs
+			scopes[rs] = make(map[instrumentation.Scope]*otlpScopeSpans)
+		}
+		ss, ok := scopes[rs][span.InstrumentationScope()]
+		if !ok {
+			scope := span.InstrumentationScope()
+			rs.ScopeSpans = append(rs.ScopeSpans, &otlpScopeSpans{
+				Scope: otlpScope{Name: scope.Name, Version: scope.Version},
+			})
+			ss = rs.ScopeSpans[len(rs.ScopeSpans)-1]
+			scopes[rs][scope] = ss
+		}
+		ss.Spans = append(ss.Spans, otlpFromSpan(span))
+	}
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	return e.enc.Encode(req)
+}
+
+func (e *fileExporter) Shutdown(ctx context.Context) error {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	return e.out.Close()
+}
+
+// The types below mirror the OTLP JSON encoding of traces: ids are
+// hex strings, 64-bit integers are decimal strings, and the span kind
+// and status code use the OTLP enum values.
+type otlpRequest struct {
+	ResourceSpans []*otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource      `json:"resource"`
+	ScopeSpans []*otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Events            []otlpEvent    `json:"events,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	Name         string         `json:"name"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string         `json:"stringValue,omitempty"`
+	BoolValue   *bool           `json:"boolValue,omitempty"`
+	IntValue    *string         `json:"intValue,omitempty"`
+	DoubleValue *float64        `json:"doubleValue,omitempty"`
+	ArrayValue  *otlpArrayValue `json:"arrayValue,omitempty"`
+}
+
+type otlpArrayValue struct {
+	Values []otlpValue `json:"values"`
+}
+
+func otlpFromSpan(span sdktrace.ReadOnlySpan) otlpSpan {
+	s := otlpSpan{
+		TraceID:           span.SpanContext().TraceID().String(),
+		SpanID:            span.SpanContext().SpanID().String(),
+		Name:              span.Name(),
+		Kind:              int(span.SpanKind()), // same values as the OTLP enum
+		StartTimeUnixNano: strconv.FormatInt(span.StartTime().UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(span.EndTime().UnixNano(), 10),
+		Attributes:        otlpAttrs(span.Attributes()),
+		Status:            otlpStatus{Message: span.Status().Description},
+	}
+	if span.Parent().IsValid() {
+		s.ParentSpanID = span.Parent().SpanID().String()
+	}
+	for _, event := range span.Events() {
+		s.Events = append(s.Events, otlpEvent{
+			TimeUnixNano: strconv.FormatInt(event.Time.UnixNano(), 10),
+			Name:         event.Name,
+			Attributes:   otlpAttrs(event.Attributes),
+		})
+	}
+	switch span.Status().Code {
+	case otelcodes.Ok:
+		s.Status.Code = 1
+	case otelcodes.Error:
+		s.Status.Code = 2
+	}
+	return s
+}
+
+func otlpAttrs(attrs []attribute.KeyValue) []otlpKeyValue {
+	var kvs []otlpKeyValue
+	for _, attr := range attrs {
+		kvs = append(kvs, otlpKeyValue{Key: string(attr.Key), Value: otlpFromValue(attr.Value)})
+	}
+	return kvs
+}
+
+func otlpFromValue(v attribute.Value) otlpValue {
+	switch v.Type() {
+	case attribute.BOOL:
+		b := v.AsBool()
+		return otlpValue{BoolValue: &b}
+	case attribute.INT64:
+		i := strconv.FormatInt(v.AsInt64(), 10)
+		return otlpValue{IntValue: &i}
+	case attribute.FLOAT64:
+		f := v.AsFloat64()
+		return otlpValue{DoubleValue: &f}
+	case attribute.BOOLSLICE:
+		var vals []otlpValue
+		for _, b := range v.AsBoolSlice() {
+			vals = append(vals, otlpFromValue(attribute.BoolValue(b)))
+		}
+		return otlpValue{ArrayValue: &otlpArrayValue{Values: vals}}
+	case attribute.INT64SLICE:
+		var vals []otlpValue
+		for _, i := range v.AsInt64Slice() {
+			vals = append(vals, otlpFromValue(attribute.Int64Value(i)))
+		}
+		return otlpValue{ArrayValue: &otlpArrayValue{Values: vals}}
+	case attribute.FLOAT64SLICE:
+		var vals []otlpValue
+		for _, f := range v.AsFloat64Slice() {
+			vals = append(vals, otlpFromValue(attribute.Float64Value(f)))
+		}
+		return otlpValue{ArrayValue: &otlpArrayValue{Values: vals}}
+	case attribute.STRINGSLICE:
+		var vals []otlpValue
+		for _, s := range v.AsStringSlice() {
+			vals = append(vals, otlpFromValue(attribute.StringValue(s)))
+		}
+		return otlpValue{ArrayValue: &otlpArrayValue{Values: vals}}
+	default:
+		s := v.Emit()
+		return otlpValue{StringValue: &s}
+	}
+}
@@ -0,0 +1,75 @@
+package tracing
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/vladimirvivien/go-grpc/util"
+)
+
+// UnaryServerIntercept returns a unary server interceptor that
+// starts a server span for each call, as a child of the span
+// propagated by the client in the request metadata, if any.
+func UnaryServerIntercept() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		ctx, span := startServerSpan(ctx, info.FullMethod)
+		defer span.End()
+
+		resp, err := handler(ctx, req)
+		endSpan(span, err)
+		return resp, err
+	}
+}
+
+// StreamServerIntercept returns a stream server interceptor that
+// starts a server span for each call as UnaryServerIntercept does.
+func StreamServerIntercept() grpc.StreamServerInterceptor {
+	return func(
+		server interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		ctx, span := startServerSpan(stream.Context(), info.FullMethod)
+		defer span.End()
+
+		err := handler(server, util.WrapServerStream(stream, ctx))
+		endSpan(span, err)
+		return err
+	}
+}
+
+// startServerSpan extracts the trace context from the incoming
+// metadata and starts the server span of the call
+func startServerSpan(ctx context.Context, fullMethod string) (context.Context, trace.Span) {
+	if meta, ok := metadata.FromIncomingContext(ctx); ok {
+		ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(meta))
+	}
+	ctx, requestID := util.IncomingRequestID(ctx)
+	return tracer().Start(ctx, spanName(fullMethod),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(methodAttrs(fullMethod)...),
+		trace.WithAttributes(attribute.String("rpc.request_id", requestID)),
+	)
+}
+
+// endSpan records the status code of the call, and its error if any
+func endSpan(span trace.Span, err error) {
+	stat := status.Convert(err)
+	span.SetAttributes(attribute.Int("rpc.grpc.status_code", int(stat.Code())))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, stat.Message())
+	}
+}
@@ -0,0 +1,135 @@
+// Package tracing provides OpenTelemetry tracing for the currency
+// and auth services: gRPC client and server interceptors that start a
+// span per call and propagate the trace context through the gRPC
+// metadata, and a tracer provider that exports the finished spans to
+// stdout or to a file, so that traces can be inspected locally
+// without running a collector.
+package tracing
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+)
+
+// tracerName is the name of the tracer of the interceptors
+const tracerName = "github.com/vladimirvivien/go-grpc/util/tracing"
+
+// Init installs the global tracer provider and propagator for the
+// named service. Spans are exported according to output:
+//
+//	""        tracing is disabled
+//	"stdout"  spans are printed to stdout as indented JSON
+//	path      spans are appended to the file in the OTLP JSON format
+//
+// The returned function flushes the pending spans and closes the
+// exporter; it should be called before the process exits.
+func Init(service, output string) (func(context.Context) error, error) {
+	// propagate the w3c trace context and baggage headers
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+	if output == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var exporter sdktrace.SpanExporter
+	switch output {
+	case "stdout":
+		exp, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		if err != nil {
+			return nil, err
+		}
+		exporter = exp
+	default:
+		file, err := os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("trace output: %v", err)
+		}
+		exporter = newFileExporter(file)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter, sdktrace.WithBatchTimeout(time.Second)),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", service),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// tracer returns the tracer of the interceptors from the global
+// provider, so that it follows the provider installed by Init.
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// attemptKey is the context key of the attempt number of a call
+type attemptKey struct{}
+
+// WithAttempt returns a copy of ctx that carries the attempt number
+// of a call. Retry interceptors set it so that the span of each
+// attempt, started by the client interceptors, records its number.
+func WithAttempt(ctx context.Context, attempt int) context.Context {
+	return context.WithValue(ctx, attemptKey{}, attempt)
+}
+
+func attemptFromContext(ctx context.Context) (int, bool) {
+	attempt, ok := ctx.Value(attemptKey{}).(int)
+	return attempt, ok
+}
+
+// spanName returns the span name of a full method name
+// (/package.Service/Method) as package.Service/Method
+func spanName(fullMethod string) string {
+	return strings.TrimPrefix(fullMethod, "/")
+}
+
+// methodAttrs returns the rpc attributes of a full method name
+func methodAttrs(fullMethod string) []attribute.KeyValue {
+	name := spanName(fullMethod)
+	service, method := "unknown", name
+	if i := strings.Index(name, "/"); i >= 0 {
+		service, method = name[:i], name[i+1:]
+	}
+	return []attribute.KeyValue{
+		attribute.String("rpc.system", "grpc"),
+		attribute.String("rpc.service", service),
+		attribute.String("rpc.method", method),
+	}
+}
+
+// metadataCarrier adapts gRPC metadata to a propagation.TextMapCarrier
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if vals := metadata.MD(c).Get(key); len(vals) > 0 {
+		return vals[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}